@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/sirupsen/logrus"
+)
+
+// AccountService changes the profile of an account and closes it
+type AccountService struct {
+	accounts     IAccountDAO
+	work         IUnitOfWork
+	tokens       IAccountTokenDAO
+	verification *EmailVerificationService
+	sessions     *SessionService
+	mailer       mailer.Mailer
+
+	Now func() time.Time
+}
+
+func NewAccountService(accounts IAccountDAO, work IUnitOfWork, tokens IAccountTokenDAO, verification *EmailVerificationService, sessions *SessionService, m mailer.Mailer) *AccountService {
+	return &AccountService{
+		accounts:     accounts,
+		work:         work,
+		tokens:       tokens,
+		verification: verification,
+		sessions:     sessions,
+		mailer:       m,
+		Now:          time.Now,
+	}
+}
+
+func (s *AccountService) openAccount(accountID string) (*Account, error) {
+	account, err := s.accounts.GetByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, domainerrors.ErrAccountNotFound
+	}
+	if account.Status == AccountStatusClosed {
+		return nil, domainerrors.ErrAccountClosed
+	}
+	return account, nil
+}
+
+// UpdateProfile changes the name and email present in req. A new email puts the
+// account back to pending until the new address is verified.
+func (s *AccountService) UpdateProfile(ctx context.Context, accountID string, req types.UpdateAccountRequest) (*Account, error) {
+	account, err := s.openAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	validation := &domainerrors.ValidationError{}
+	name := account.Name
+	if req.Name != nil {
+		if parsed, err := NewName(*req.Name); err != nil {
+			validation.Add("name", err)
+		} else {
+			name = parsed.String()
+		}
+	}
+	email := account.Email
+	if req.Email != nil {
+		if parsed, err := NewEmail(*req.Email); err != nil {
+			validation.Add("email", err)
+		} else {
+			email = parsed.String()
+		}
+	}
+	emailChanged := !strings.EqualFold(email, account.Email)
+	if emailChanged && !validation.HasErrors() {
+		existing, err := s.accounts.GetByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.AccountID != accountID {
+			validation.Add("email", domainerrors.ErrDuplicateEmail)
+		}
+	}
+	if err := validation.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	previousEmail := account.Email
+	if err := s.accounts.UpdateProfile(accountID, name, email); err != nil {
+		if errors.Is(err, domainerrors.ErrDuplicateEmail) {
+			// Another account took the email after the check above
+			validation.Add("email", err)
+			return nil, validation
+		}
+		return nil, err
+	}
+	updated := &Account{AccountID: accountID, Name: name, Email: email, Document: account.Document, DocumentType: account.DocumentType, Status: account.Status}
+	if !emailChanged {
+		return updated, nil
+	}
+
+	// Links mailed to the previous address must not verify the new one
+	if err := s.tokens.InvalidateAll(accountID, TokenPurposeEmailVerification, s.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.accounts.UpdateStatus(accountID, AccountStatusPending); err != nil {
+		return nil, err
+	}
+	updated.Status = AccountStatusPending
+	logrus.WithField("accountId", accountID).Info("Account email changed, verification required")
+	if err := s.verification.Send(ctx, updated); err != nil {
+		logrus.WithError(err).WithField("accountId", accountID).Error("Failed to send verification email")
+	}
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      previousEmail,
+		Subject: "Your email address was changed",
+		Body:    fmt.Sprintf("Hello %s,\n\nThe email address of your account was changed to %s. If you did not do this, contact support immediately.\n", name, email),
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("accountId", accountID).Error("Failed to notify previous email address")
+	}
+	return updated, nil
+}
+
+// Close marks the account closed once it holds nothing. The row is kept for
+// the trade and audit history. The account is locked while it is checked and
+// closed, deposits and orders wait and then find it closed.
+func (s *AccountService) Close(accountID, password string) error {
+	account, err := s.openAccount(accountID)
+	if err != nil {
+		return err
+	}
+	if !CheckPassword(account.Password, password) {
+		validation := &domainerrors.ValidationError{}
+		validation.Add("password", domainerrors.ErrIncorrectPassword)
+		return validation
+	}
+	err = s.work.Run(func(tx ExchangeTx) error {
+		if err := tx.LockAccount(accountID); err != nil {
+			return err
+		}
+		// Another request may have closed it since it was read
+		locked, err := tx.Accounts.GetByID(accountID)
+		if err != nil {
+			return err
+		}
+		if locked == nil || locked.Status == AccountStatusClosed {
+			return domainerrors.ErrAccountClosed
+		}
+		assets, err := tx.Holdings.NonZeroBalances(accountID)
+		if err != nil {
+			return err
+		}
+		if len(assets) > 0 {
+			logrus.WithFields(logrus.Fields{"accountId": accountID, "assets": assets}).Warn("Account closure refused, balances are not zero")
+			return domainerrors.ErrAccountHasBalance
+		}
+		openOrders, err := tx.Holdings.CountOpenOrders(accountID)
+		if err != nil {
+			return err
+		}
+		if openOrders > 0 {
+			logrus.WithFields(logrus.Fields{"accountId": accountID, "openOrders": openOrders}).Warn("Account closure refused, orders are open")
+			return domainerrors.ErrAccountHasOpenOrders
+		}
+		return tx.Accounts.UpdateStatus(accountID, AccountStatusClosed)
+	})
+	if err != nil {
+		return err
+	}
+	logrus.WithField("accountId", accountID).Info("Account closed")
+	return s.sessions.RevokeAll(accountID)
+}
@@ -2,17 +2,40 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/lib/pq"
+)
+
+// Names of the unique indexes that keep one account per document and per email
+const (
+	accountDocumentConstraint = "account_document_key"
+	accountEmailConstraint    = "account_email_key"
+)
+
+// isUniqueViolation reports whether err was raised by the given unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+const (
+	AccountStatusPending = "pending"
+	AccountStatusActive  = "active"
+	AccountStatusClosed  = "closed"
 )
 
 // Account represents the account data structure
 type Account struct {
-	AccountID string `json:"account_id"`
-	Name      string `json:"name"`
-	Email     string `json:"email"`
-	Document  string `json:"document"`
-	Password  string `json:"password"`
+	AccountID    string `json:"account_id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Document     string `json:"document"`
+	DocumentType string `json:"document_type"`
+	Password     string `json:"password"`
+	Status       string `json:"status"`
 }
 
 // IAccountDAO defines the interface for account data access operations
@@ -20,44 +43,42 @@ type IAccountDAO interface {
 	Save(account *Account) error
 	GetByID(accountID string) (*Account, error)
 	GetByEmail(email string) (*Account, error)
+	// GetByDocument finds the account of a CPF or CNPJ, with or without its punctuation
+	GetByDocument(document string) (*Account, error)
+	UpdateStatus(accountID string, status string) error
+	UpdatePassword(accountID string, passwordHash string) error
+	UpdateProfile(accountID string, name string, email string) error
 }
 
 // AccountDAODatabase implements IAccountDAO using PostgreSQL database
-type AccountDAODatabase struct{}
-
-func NewAccountDAODatabase() *AccountDAODatabase {
-	return &AccountDAODatabase{}
+type AccountDAODatabase struct {
+	db querier
 }
 
-func (dao *AccountDAODatabase) getDB() (*sql.DB, error) {
-	connStr := "host=db port=5432 user=postgres password=postgres dbname=app sslmode=disable"
-	return sql.Open("postgres", connStr)
+func NewAccountDAODatabase(db *Database) *AccountDAODatabase {
+	return &AccountDAODatabase{db: db.DB}
 }
 
+// Accounts created before statuses existed are treated as active
+const accountColumns = "account_id, name, email, document, COALESCE(document_type, ''), password, COALESCE(status, 'active')"
+
 func (dao *AccountDAODatabase) Save(account *Account) error {
-	db, err := dao.getDB()
-	if err != nil {
-		return err
+	query := "INSERT INTO ccca.account (account_id, name, email, document, document_type, password, status) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	_, err := dao.db.Exec(query, account.AccountID, account.Name, account.Email, account.Document, account.DocumentType, account.Password, account.Status)
+	if isUniqueViolation(err, accountDocumentConstraint) {
+		return domainerrors.ErrDuplicateDocument
+	}
+	if isUniqueViolation(err, accountEmailConstraint) {
+		return domainerrors.ErrDuplicateEmail
 	}
-	defer db.Close()
-
-	query := "INSERT INTO ccca.account (account_id, name, email, document, password) VALUES ($1, $2, $3, $4, $5)"
-	_, err = db.Exec(query, account.AccountID, account.Name, account.Email, account.Document, account.Password)
 	return err
 }
 
-func (dao *AccountDAODatabase) GetByID(accountID string) (*Account, error) {
-	db, err := dao.getDB()
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	query := "SELECT account_id, name, email, document, password FROM ccca.account WHERE account_id = $1"
-	row := db.QueryRow(query, accountID)
+func (dao *AccountDAODatabase) getOne(where string, arg interface{}) (*Account, error) {
+	row := dao.db.QueryRow("SELECT "+accountColumns+" FROM ccca.account WHERE "+where, arg)
 
 	account := &Account{}
-	err = row.Scan(&account.AccountID, &account.Name, &account.Email, &account.Document, &account.Password)
+	err := row.Scan(&account.AccountID, &account.Name, &account.Email, &account.Document, &account.DocumentType, &account.Password, &account.Status)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -68,44 +89,61 @@ func (dao *AccountDAODatabase) GetByID(accountID string) (*Account, error) {
 	return account, nil
 }
 
+func (dao *AccountDAODatabase) GetByID(accountID string) (*Account, error) {
+	return dao.getOne("account_id = $1", accountID)
+}
+
 func (dao *AccountDAODatabase) GetByEmail(email string) (*Account, error) {
-	db, err := dao.getDB()
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
+	return dao.getOne("lower(email) = lower($1)", email)
+}
 
-	query := "SELECT account_id, name, email, document, password FROM ccca.account WHERE email = $1"
-	row := db.QueryRow(query, email)
+func (dao *AccountDAODatabase) GetByDocument(document string) (*Account, error) {
+	return dao.getOne("document = $1", NormalizeDocument(document))
+}
 
-	account := &Account{}
-	err = row.Scan(&account.AccountID, &account.Name, &account.Email, &account.Document, &account.Password)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
-	}
+func (dao *AccountDAODatabase) UpdateStatus(accountID string, status string) error {
+	_, err := dao.db.Exec("UPDATE ccca.account SET status = $1 WHERE account_id = $2", status, accountID)
+	return err
+}
 
-	return account, nil
+func (dao *AccountDAODatabase) UpdatePassword(accountID string, passwordHash string) error {
+	_, err := dao.db.Exec("UPDATE ccca.account SET password = $1 WHERE account_id = $2", passwordHash, accountID)
+	return err
+}
+
+func (dao *AccountDAODatabase) UpdateProfile(accountID string, name string, email string) error {
+	_, err := dao.db.Exec("UPDATE ccca.account SET name = $1, email = $2 WHERE account_id = $3", name, email, accountID)
+	if isUniqueViolation(err, accountEmailConstraint) {
+		return domainerrors.ErrDuplicateEmail
+	}
+	return err
 }
 
 // AccountDAOMemory implements IAccountDAO using in-memory storage
 type AccountDAOMemory struct {
-	accounts   map[string]*Account
-	emailIndex map[string]string
+	accounts      map[string]*Account
+	emailIndex    map[string]string
+	documentIndex map[string]string
 }
 
 func NewAccountDAOMemory() *AccountDAOMemory {
 	return &AccountDAOMemory{
-		accounts:   make(map[string]*Account),
-		emailIndex: make(map[string]string),
+		accounts:      make(map[string]*Account),
+		emailIndex:    make(map[string]string),
+		documentIndex: make(map[string]string),
 	}
 }
 
 func (dao *AccountDAOMemory) Save(account *Account) error {
+	if accountID, exists := dao.documentIndex[account.Document]; exists && accountID != account.AccountID {
+		return domainerrors.ErrDuplicateDocument
+	}
+	if accountID, exists := dao.emailIndex[strings.ToLower(account.Email)]; exists && accountID != account.AccountID {
+		return domainerrors.ErrDuplicateEmail
+	}
 	dao.accounts[account.AccountID] = account
-	dao.emailIndex[account.Email] = account.AccountID
+	dao.emailIndex[strings.ToLower(account.Email)] = account.AccountID
+	dao.documentIndex[account.Document] = account.AccountID
 	return nil
 }
 
@@ -118,7 +156,21 @@ func (dao *AccountDAOMemory) GetByID(accountID string) (*Account, error) {
 }
 
 func (dao *AccountDAOMemory) GetByEmail(email string) (*Account, error) {
-	accountID, exists := dao.emailIndex[email]
+	accountID, exists := dao.emailIndex[strings.ToLower(email)]
+	if !exists {
+		return nil, nil
+	}
+
+	account, exists := dao.accounts[accountID]
+	if !exists {
+		return nil, nil
+	}
+
+	return account, nil
+}
+
+func (dao *AccountDAOMemory) GetByDocument(document string) (*Account, error) {
+	accountID, exists := dao.documentIndex[NormalizeDocument(document)]
 	if !exists {
 		return nil, nil
 	}
@@ -130,3 +182,36 @@ func (dao *AccountDAOMemory) GetByEmail(email string) (*Account, error) {
 
 	return account, nil
 }
+
+func (dao *AccountDAOMemory) UpdateStatus(accountID string, status string) error {
+	account, exists := dao.accounts[accountID]
+	if !exists {
+		return domainerrors.ErrAccountNotFound
+	}
+	account.Status = status
+	return nil
+}
+
+func (dao *AccountDAOMemory) UpdatePassword(accountID string, passwordHash string) error {
+	account, exists := dao.accounts[accountID]
+	if !exists {
+		return domainerrors.ErrAccountNotFound
+	}
+	account.Password = passwordHash
+	return nil
+}
+
+func (dao *AccountDAOMemory) UpdateProfile(accountID string, name string, email string) error {
+	account, exists := dao.accounts[accountID]
+	if !exists {
+		return domainerrors.ErrAccountNotFound
+	}
+	if otherID, exists := dao.emailIndex[strings.ToLower(email)]; exists && otherID != accountID {
+		return domainerrors.ErrDuplicateEmail
+	}
+	delete(dao.emailIndex, strings.ToLower(account.Email))
+	dao.emailIndex[strings.ToLower(email)] = accountID
+	account.Name = name
+	account.Email = email
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountDAOMemoryGetByDocument(t *testing.T) {
+	dao := NewAccountDAOMemory()
+	account := &Account{
+		AccountID:    "550e8400-e29b-41d4-a716-446655440000",
+		Name:         "Gustavo B",
+		Email:        "gustavo@example.com",
+		Document:     "11144477735",
+		DocumentType: string(DocumentTypeCPF),
+	}
+	assert.NoError(t, dao.Save(account))
+
+	found, err := dao.GetByDocument("11144477735")
+	assert.NoError(t, err)
+	assert.Equal(t, account, found)
+
+	found, err = dao.GetByDocument("111.444.777-35")
+	assert.NoError(t, err)
+	assert.Equal(t, account, found)
+
+	found, err = dao.GetByDocument("11222333000181")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestAccountDAOMemoryRejectsDuplicateDocument(t *testing.T) {
+	dao := NewAccountDAOMemory()
+	assert.NoError(t, dao.Save(&Account{AccountID: "550e8400-e29b-41d4-a716-446655440000", Email: "a@example.com", Document: "11144477735"}))
+
+	err := dao.Save(&Account{AccountID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Email: "b@example.com", Document: "11144477735"})
+	assert.ErrorIs(t, err, domainerrors.ErrDuplicateDocument)
+
+	found, _ := dao.GetByEmail("b@example.com")
+	assert.Nil(t, found)
+}
+
+func TestAccountDAOMemoryEmailIsCaseInsensitive(t *testing.T) {
+	dao := NewAccountDAOMemory()
+	account := &Account{AccountID: "550e8400-e29b-41d4-a716-446655440000", Email: "Gustavo@example.com", Document: "11144477735"}
+	assert.NoError(t, dao.Save(account))
+
+	found, err := dao.GetByEmail("gustavo@EXAMPLE.com")
+	assert.NoError(t, err)
+	assert.Equal(t, account, found)
+
+	err = dao.Save(&Account{AccountID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Email: "GUSTAVO@example.com", Document: "11222333000181"})
+	assert.ErrorIs(t, err, domainerrors.ErrDuplicateEmail)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// IAccountHoldingsDAO reports what an account still holds on the exchange
+type IAccountHoldingsDAO interface {
+	// NonZeroBalances returns the assets whose balance is not zero
+	NonZeroBalances(accountID string) ([]types.AssetId, error)
+	CountOpenOrders(accountID string) (int, error)
+}
+
+// AccountHoldingsDAODatabase implements IAccountHoldingsDAO using PostgreSQL database
+type AccountHoldingsDAODatabase struct {
+	db querier
+}
+
+func NewAccountHoldingsDAODatabase(db *Database) *AccountHoldingsDAODatabase {
+	return &AccountHoldingsDAODatabase{db: db.DB}
+}
+
+func (dao *AccountHoldingsDAODatabase) NonZeroBalances(accountID string) ([]types.AssetId, error) {
+	rows, err := dao.db.Query("SELECT asset_id FROM ccca.account_asset WHERE account_id = $1 AND (available <> 0 OR on_hold <> 0) ORDER BY asset_id", accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	assets := []types.AssetId{}
+	for rows.Next() {
+		var asset types.AssetId
+		if err := rows.Scan(&asset); err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+func (dao *AccountHoldingsDAODatabase) CountOpenOrders(accountID string) (int, error) {
+	var count int
+	err := dao.db.QueryRow("SELECT count(*) FROM ccca.order WHERE account_id = $1 AND status IN ($2, $3)", accountID, OrderStatusOpen, OrderStatusPending).Scan(&count)
+	return count, err
+}
+
+// AccountHoldingsDAOMemory implements IAccountHoldingsDAO using in-memory storage
+type AccountHoldingsDAOMemory struct {
+	mu         sync.Mutex
+	balances   map[string]map[types.AssetId]decimal.Decimal
+	openOrders map[string]int
+}
+
+func NewAccountHoldingsDAOMemory() *AccountHoldingsDAOMemory {
+	return &AccountHoldingsDAOMemory{
+		balances:   make(map[string]map[types.AssetId]decimal.Decimal),
+		openOrders: make(map[string]int),
+	}
+}
+
+func (dao *AccountHoldingsDAOMemory) SetBalance(accountID string, asset types.AssetId, quantity decimal.Decimal) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	if dao.balances[accountID] == nil {
+		dao.balances[accountID] = make(map[types.AssetId]decimal.Decimal)
+	}
+	dao.balances[accountID][asset] = quantity
+}
+
+func (dao *AccountHoldingsDAOMemory) SetOpenOrders(accountID string, count int) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	dao.openOrders[accountID] = count
+}
+
+func (dao *AccountHoldingsDAOMemory) NonZeroBalances(accountID string) ([]types.AssetId, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	assets := []types.AssetId{}
+	for asset, quantity := range dao.balances[accountID] {
+		if !quantity.IsZero() {
+			assets = append(assets, asset)
+		}
+	}
+	return assets, nil
+}
+
+func (dao *AccountHoldingsDAOMemory) CountOpenOrders(accountID string) (int, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	return dao.openOrders[accountID], nil
+}
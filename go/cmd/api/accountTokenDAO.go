@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// AccountToken records an issued single-use token
+type AccountToken struct {
+	TokenID   string
+	AccountID string
+	Purpose   TokenPurpose
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// IAccountTokenDAO defines the interface for single-use token storage
+type IAccountTokenDAO interface {
+	Save(token *AccountToken) error
+	GetByID(tokenID string) (*AccountToken, error)
+	// MarkUsed consumes the token and returns false if it was already used
+	MarkUsed(tokenID string, usedAt time.Time) (bool, error)
+	CountIssuedSince(accountID string, purpose TokenPurpose, since time.Time) (int, error)
+	// InvalidateAll consumes every unused token of the account for purpose
+	InvalidateAll(accountID string, purpose TokenPurpose, at time.Time) error
+}
+
+// AccountTokenDAODatabase implements IAccountTokenDAO using PostgreSQL database
+type AccountTokenDAODatabase struct {
+	db *Database
+}
+
+func NewAccountTokenDAODatabase(db *Database) *AccountTokenDAODatabase {
+	return &AccountTokenDAODatabase{db: db}
+}
+
+func (dao *AccountTokenDAODatabase) Save(token *AccountToken) error {
+	query := "INSERT INTO ccca.account_token (token_id, account_id, purpose, created_at, expires_at, used_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	_, err := dao.db.DB.Exec(query, token.TokenID, token.AccountID, token.Purpose, token.CreatedAt, token.ExpiresAt, token.UsedAt)
+	return err
+}
+
+func (dao *AccountTokenDAODatabase) GetByID(tokenID string) (*AccountToken, error) {
+	query := "SELECT token_id, account_id, purpose, created_at, expires_at, used_at FROM ccca.account_token WHERE token_id = $1"
+	token := &AccountToken{}
+	var usedAt sql.NullTime
+	err := dao.db.DB.QueryRow(query, tokenID).Scan(&token.TokenID, &token.AccountID, &token.Purpose, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+func (dao *AccountTokenDAODatabase) MarkUsed(tokenID string, usedAt time.Time) (bool, error) {
+	query := "UPDATE ccca.account_token SET used_at = $1 WHERE token_id = $2 AND used_at IS NULL"
+	result, err := dao.db.DB.Exec(query, usedAt, tokenID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (dao *AccountTokenDAODatabase) CountIssuedSince(accountID string, purpose TokenPurpose, since time.Time) (int, error) {
+	query := "SELECT count(*) FROM ccca.account_token WHERE account_id = $1 AND purpose = $2 AND created_at >= $3"
+	var count int
+	err := dao.db.DB.QueryRow(query, accountID, purpose, since).Scan(&count)
+	return count, err
+}
+
+func (dao *AccountTokenDAODatabase) InvalidateAll(accountID string, purpose TokenPurpose, at time.Time) error {
+	query := "UPDATE ccca.account_token SET used_at = $1 WHERE account_id = $2 AND purpose = $3 AND used_at IS NULL"
+	_, err := dao.db.DB.Exec(query, at, accountID, purpose)
+	return err
+}
+
+// AccountTokenDAOMemory implements IAccountTokenDAO using in-memory storage
+type AccountTokenDAOMemory struct {
+	mu     sync.Mutex
+	tokens map[string]*AccountToken
+}
+
+func NewAccountTokenDAOMemory() *AccountTokenDAOMemory {
+	return &AccountTokenDAOMemory{
+		tokens: make(map[string]*AccountToken),
+	}
+}
+
+func (dao *AccountTokenDAOMemory) Save(token *AccountToken) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	stored := *token
+	dao.tokens[token.TokenID] = &stored
+	return nil
+}
+
+func (dao *AccountTokenDAOMemory) GetByID(tokenID string) (*AccountToken, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	token, exists := dao.tokens[tokenID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (dao *AccountTokenDAOMemory) MarkUsed(tokenID string, usedAt time.Time) (bool, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	token, exists := dao.tokens[tokenID]
+	if !exists || token.UsedAt != nil {
+		return false, nil
+	}
+	token.UsedAt = &usedAt
+	return true, nil
+}
+
+func (dao *AccountTokenDAOMemory) CountIssuedSince(accountID string, purpose TokenPurpose, since time.Time) (int, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	count := 0
+	for _, token := range dao.tokens {
+		if token.AccountID == accountID && token.Purpose == purpose && !token.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (dao *AccountTokenDAOMemory) InvalidateAll(accountID string, purpose TokenPurpose, at time.Time) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for _, token := range dao.tokens {
+		if token.AccountID == accountID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &at
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type accountFixture struct {
+	service      *AccountService
+	work         *UnitOfWorkMemory
+	accounts     *AccountDAOMemory
+	holdings     *AccountHoldingsDAOMemory
+	sessions     *SessionService
+	verification *EmailVerificationService
+	mailer       *mailer.MemoryMailer
+}
+
+const accountTestID = "550e8400-e29b-41d4-a716-446655440000"
+
+func newAccountFixture(t *testing.T) *accountFixture {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	sessions, accounts, now := newSessionFixture(t, hash)
+	f := &accountFixture{
+		accounts: accounts,
+		holdings: NewAccountHoldingsDAOMemory(),
+		sessions: sessions,
+		mailer:   &mailer.MemoryMailer{},
+	}
+	tokens := NewAccountTokenDAOMemory()
+	f.verification = NewEmailVerificationService(accounts, tokens, f.mailer, NewTokenSigner([]byte("secret")))
+	f.verification.Now = func() time.Time { return *now }
+	f.work = NewUnitOfWorkMemory(accounts, f.holdings, NewOrderDAOMemory(), NewTradeDAOMemory(), NewBalanceDAOMemory())
+	f.service = NewAccountService(accounts, f.work, tokens, f.verification, sessions, f.mailer)
+	f.service.Now = func() time.Time { return *now }
+	return f
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestUpdateAccountName(t *testing.T) {
+	f := newAccountFixture(t)
+
+	account, err := f.service.UpdateProfile(context.Background(), accountTestID, types.UpdateAccountRequest{Name: stringPointer("  Maria Silva ")})
+	assert.NoError(t, err)
+	assert.Equal(t, "Maria Silva", account.Name)
+	assert.Equal(t, "gustavo@example.com", account.Email)
+	assert.Equal(t, AccountStatusActive, account.Status)
+	assert.Empty(t, f.mailer.Messages("gustavo@example.com"))
+}
+
+func TestUpdateAccountValidation(t *testing.T) {
+	f := newAccountFixture(t)
+	assert.NoError(t, f.accounts.Save(&Account{AccountID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "Other", Email: "other@example.com", Document: "52998224725"}))
+
+	testCases := []struct {
+		name           string
+		req            types.UpdateAccountRequest
+		expectedFields []string
+	}{
+		{"Invalid name", types.UpdateAccountRequest{Name: stringPointer("Gustavo")}, []string{"name"}},
+		{"Invalid email", types.UpdateAccountRequest{Email: stringPointer("invalid")}, []string{"email"}},
+		{"Duplicate email", types.UpdateAccountRequest{Email: stringPointer("OTHER@example.com")}, []string{"email"}},
+		{"Both invalid", types.UpdateAccountRequest{Name: stringPointer(""), Email: stringPointer("invalid")}, []string{"name", "email"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := f.service.UpdateProfile(context.Background(), accountTestID, tc.req)
+			var validationErr *domainerrors.ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields)
+			}
+		})
+	}
+	account, _ := f.accounts.GetByID(accountTestID)
+	assert.Equal(t, "gustavo@example.com", account.Email)
+}
+
+func TestUpdateAccountEmailRequiresVerification(t *testing.T) {
+	f := newAccountFixture(t)
+	account, _ := f.accounts.GetByID(accountTestID)
+	assert.NoError(t, f.verification.Send(context.Background(), account))
+	body := f.mailer.Messages("gustavo@example.com")[0].Body
+	link, err := url.Parse(strings.Fields(body[strings.Index(body, f.verification.VerifyURL):])[0])
+	assert.NoError(t, err)
+
+	updated, err := f.service.UpdateProfile(context.Background(), accountTestID, types.UpdateAccountRequest{Email: stringPointer("new@example.com")})
+	assert.NoError(t, err)
+	assert.Equal(t, "new@example.com", updated.Email)
+	assert.Equal(t, AccountStatusPending, updated.Status)
+
+	stored, _ := f.accounts.GetByEmail("new@example.com")
+	assert.Equal(t, AccountStatusPending, stored.Status)
+	absent, _ := f.accounts.GetByEmail("gustavo@example.com")
+	assert.Nil(t, absent)
+	assert.Len(t, f.mailer.Messages("new@example.com"), 1)
+	notices := f.mailer.Messages("gustavo@example.com")
+	if assert.Len(t, notices, 2) {
+		assert.Equal(t, "Your email address was changed", notices[1].Subject)
+	}
+
+	// The link mailed to the previous address no longer activates the account
+	_, err = f.verification.Verify(link.Query().Get("token"))
+	assert.ErrorIs(t, err, domainerrors.ErrTokenAlreadyUsed)
+}
+
+func TestCloseAccount(t *testing.T) {
+	f := newAccountFixture(t)
+	token, _, err := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, f.service.Close(accountTestID, "Vq7!mZt2Lp9x"))
+
+	account, _ := f.accounts.GetByID(accountTestID)
+	assert.Equal(t, AccountStatusClosed, account.Status)
+	_, err = f.sessions.Authenticate(token)
+	assert.ErrorIs(t, err, domainerrors.ErrAuthenticationRequired)
+	_, _, err = f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.ErrorIs(t, err, domainerrors.ErrAccountClosed)
+	assert.ErrorIs(t, f.service.Close(accountTestID, "Vq7!mZt2Lp9x"), domainerrors.ErrAccountClosed)
+	_, err = f.service.UpdateProfile(context.Background(), accountTestID, types.UpdateAccountRequest{Name: stringPointer("Maria Silva")})
+	assert.ErrorIs(t, err, domainerrors.ErrAccountClosed)
+}
+
+func TestCloseAccountWaitsForADepositInProgress(t *testing.T) {
+	f := newAccountFixture(t)
+	depositing, deposited := make(chan struct{}), make(chan struct{})
+	go f.work.Run(func(tx ExchangeTx) error {
+		assert.NoError(t, tx.ShareAccount(accountTestID))
+		close(depositing)
+		<-deposited
+		f.holdings.SetBalance(accountTestID, types.AssetIdUSD, decimal.RequireFromString("100"))
+		return nil
+	})
+	<-depositing
+
+	closed := make(chan error)
+	go func() { closed <- f.service.Close(accountTestID, "Vq7!mZt2Lp9x") }()
+	close(deposited)
+
+	assert.ErrorIs(t, <-closed, domainerrors.ErrAccountHasBalance)
+	account, _ := f.accounts.GetByID(accountTestID)
+	assert.Equal(t, AccountStatusActive, account.Status)
+}
+
+func TestCloseAccountRefusals(t *testing.T) {
+	testCases := []struct {
+		name        string
+		setup       func(f *accountFixture)
+		password    string
+		expectedErr error
+	}{
+		{"Wrong password", func(f *accountFixture) {}, "wrong", domainerrors.ErrIncorrectPassword},
+		{"Non-zero balance", func(f *accountFixture) {
+			f.holdings.SetBalance(accountTestID, types.AssetIdBTC, decimal.RequireFromString("0.0001"))
+		}, "Vq7!mZt2Lp9x", domainerrors.ErrAccountHasBalance},
+		{"Open orders", func(f *accountFixture) {
+			f.holdings.SetBalance(accountTestID, types.AssetIdBTC, decimal.Zero)
+			f.holdings.SetOpenOrders(accountTestID, 1)
+		}, "Vq7!mZt2Lp9x", domainerrors.ErrAccountHasOpenOrders},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newAccountFixture(t)
+			tc.setup(f)
+
+			err := f.service.Close(accountTestID, tc.password)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+			account, _ := f.accounts.GetByID(accountTestID)
+			assert.Equal(t, AccountStatusActive, account.Status)
+		})
+	}
+}
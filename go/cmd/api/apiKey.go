@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/sirupsen/logrus"
+)
+
+// API key scopes
+const (
+	APIKeyScopeRead     = "read"
+	APIKeyScopeTrade    = "trade"
+	APIKeyScopeWithdraw = "withdraw"
+)
+
+var apiKeyScopes = []string{APIKeyScopeRead, APIKeyScopeTrade, APIKeyScopeWithdraw}
+
+// Headers of a request signed with an API key
+const (
+	HeaderAPIKey       = "X-API-Key"
+	HeaderAPITimestamp = "X-API-Timestamp"
+	HeaderAPINonce     = "X-API-Nonce"
+	HeaderAPISignature = "X-API-Signature"
+)
+
+// Fiber local set by AllowAPIKey for requests authenticated with an API key
+const localAPIKeyID = "apiKeyId"
+
+const maxAPIKeyNameLength = 64
+
+// SignAPIRequest returns the hex HMAC-SHA256 signature a client sends in X-API-Signature.
+// The signed payload is the timestamp, nonce, method, path with query and body, one per line.
+func SignAPIRequest(secret, timestamp, nonce, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + strings.ToUpper(method) + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedRequest is what a request signed with an API key carries
+type SignedRequest struct {
+	KeyID     string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	Path      string
+	Body      []byte
+	IP        string
+}
+
+// APIKeyService issues API keys and authenticates the requests signed with them
+type APIKeyService struct {
+	keys   IAPIKeyDAO
+	signer *TokenSigner
+
+	Now func() time.Time
+	// MaxClockSkew bounds how far the request timestamp may be from the server clock
+	MaxClockSkew time.Duration
+}
+
+func NewAPIKeyService(keys IAPIKeyDAO, signer *TokenSigner) *APIKeyService {
+	return &APIKeyService{
+		keys:         keys,
+		signer:       signer,
+		Now:          time.Now,
+		MaxClockSkew: 30 * time.Second,
+	}
+}
+
+// errSealedSecret means the stored secret of a key cannot be decrypted, the server
+// secret changed since the key was issued or the row was tampered with
+var errSealedSecret = errors.New("api key: cannot open the sealed secret")
+
+// secretCipher encrypts the secrets of the keys, which the server needs to check signatures,
+// so a copy of the database is not enough to sign requests
+func (s *APIKeyService) secretCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.signer.DeriveKey("api-key"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret encrypts secret bound to keyID, a sealed secret moved to another key does not open
+func (s *APIKeyService) sealSecret(keyID, secret string) (string, error) {
+	aead, err := s.secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), []byte(keyID))), nil
+}
+
+func (s *APIKeyService) openSecret(key *APIKey) (string, error) {
+	aead, err := s.secretCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := hex.DecodeString(key.EncryptedSecret)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errSealedSecret
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(key.KeyID))
+	if err != nil {
+		return "", errSealedSecret
+	}
+	return string(secret), nil
+}
+
+func validateCreateAPIKeyRequest(req types.CreateAPIKeyRequest, now time.Time) error {
+	validation := &domainerrors.ValidationError{}
+	if name := strings.TrimSpace(req.Name); name == "" || len(name) > maxAPIKeyNameLength {
+		validation.Add("name", domainerrors.ErrInvalidAPIKeyName)
+	}
+	if len(req.Scopes) == 0 {
+		validation.Add("scopes", domainerrors.ErrInvalidAPIKeyScope)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			validation.Add("scopes", domainerrors.ErrInvalidAPIKeyScope)
+			break
+		}
+	}
+	for _, entry := range req.AllowedIPs {
+		if _, err := parseAllowedIP(entry); err != nil {
+			validation.Add("allowedIps", domainerrors.ErrInvalidIPAddress)
+			break
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		validation.Add("expiresAt", domainerrors.ErrInvalidExpiry)
+	}
+	return validation.ErrorOrNil()
+}
+
+// parseAllowedIP accepts a single address or a CIDR range
+func parseAllowedIP(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+func ipAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if prefix, err := parseAllowedIP(entry); err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create issues a key and returns its secret, which is only ever shown here
+func (s *APIKeyService) Create(accountID string, req types.CreateAPIKeyRequest) (*APIKey, string, error) {
+	now := s.Now()
+	if err := validateCreateAPIKeyRequest(req, now); err != nil {
+		return nil, "", err
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	key := &APIKey{
+		KeyID:      "ak_" + hex.EncodeToString(random),
+		AccountID:  accountID,
+		Name:       strings.TrimSpace(req.Name),
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		AllowedIPs: req.AllowedIPs,
+		CreatedAt:  now,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if key.AllowedIPs == nil {
+		key.AllowedIPs = []string{}
+	}
+	random = make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	secret := hex.EncodeToString(random)
+	sealed, err := s.sealSecret(key.KeyID, secret)
+	if err != nil {
+		return nil, "", err
+	}
+	key.EncryptedSecret = sealed
+	if err := s.keys.Save(key); err != nil {
+		return nil, "", err
+	}
+	logrus.WithFields(logrus.Fields{"accountId": accountID, "keyId": key.KeyID, "scopes": key.Scopes}).Info("API key created")
+	return key, secret, nil
+}
+
+// List returns every key of the account, revoked and expired ones included
+func (s *APIKeyService) List(accountID string) ([]APIKey, error) {
+	return s.keys.ListByAccount(accountID)
+}
+
+func (s *APIKeyService) Revoke(accountID, keyID string) error {
+	revoked, err := s.keys.Revoke(accountID, keyID, s.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return domainerrors.ErrAPIKeyNotFound
+	}
+	logrus.WithFields(logrus.Fields{"accountId": accountID, "keyId": keyID}).Info("API key revoked")
+	return nil
+}
+
+// Authenticate checks the key, its signature and freshness, then that it grants scope
+func (s *APIKeyService) Authenticate(req SignedRequest, scope string) (*APIKey, error) {
+	now := s.Now()
+	key, err := s.keys.GetByID(req.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, domainerrors.ErrInvalidAPIKey
+	}
+	secret, err := s.openSecret(key)
+	if err != nil {
+		logrus.WithError(err).WithField("keyId", key.KeyID).Warn("API key secret does not open")
+		return nil, domainerrors.ErrInvalidAPIKey
+	}
+	if !ipAllowed(key.AllowedIPs, req.IP) {
+		return nil, domainerrors.ErrIPNotAllowed
+	}
+	expected := SignAPIRequest(secret, req.Timestamp, req.Nonce, req.Method, req.Path, req.Body)
+	if req.Nonce == "" || !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Signature))) {
+		return nil, domainerrors.ErrInvalidSignature
+	}
+	// Only checked once the signature is valid so nobody else can burn nonces
+	seconds, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, domainerrors.ErrRequestExpired
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > s.MaxClockSkew || skew < -s.MaxClockSkew {
+		return nil, domainerrors.ErrRequestExpired
+	}
+	fresh, err := s.keys.UseNonce(key.KeyID, req.Nonce, now, 2*s.MaxClockSkew)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, domainerrors.ErrReplayedRequest
+	}
+	if !slices.Contains(key.Scopes, scope) {
+		return nil, domainerrors.ErrInsufficientScope
+	}
+	if err := s.keys.Touch(key.KeyID, now); err != nil {
+		logrus.WithError(err).WithField("keyId", key.KeyID).Warn("Failed to record API key use")
+	}
+	return key, nil
+}
+
+// AllowAPIKey authenticates requests that carry X-API-Key and requires scope.
+// Requests without the header are passed through unchanged.
+func AllowAPIKey(keys *APIKeyService, scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keyID := c.Get(HeaderAPIKey)
+		if keyID == "" {
+			return c.Next()
+		}
+		key, err := keys.Authenticate(SignedRequest{
+			KeyID:     keyID,
+			Timestamp: c.Get(HeaderAPITimestamp),
+			Nonce:     c.Get(HeaderAPINonce),
+			Signature: c.Get(HeaderAPISignature),
+			Method:    c.Method(),
+			Path:      c.OriginalURL(),
+			Body:      c.Body(),
+			IP:        c.IP(),
+		}, scope)
+		if err != nil {
+			var domainErr *domainerrors.Error
+			if !errors.As(err, &domainErr) {
+				logrus.WithError(err).Error("Error authenticating API key")
+				return domainerrors.ErrInternal
+			}
+			logrus.WithError(err).WithFields(logrus.Fields{"keyId": keyID, "ip": c.IP()}).Warn("API key request rejected")
+			return err
+		}
+		c.Locals(localAccountID, key.AccountID)
+		c.Locals(localAPIKeyID, key.KeyID)
+		return c.Next()
+	}
+}
+
+// RequireAuthentication accepts either a request signed with an API key that has
+// scope or a session
+func RequireAuthentication(sessions *SessionService, keys *APIKeyService, scope string) fiber.Handler {
+	requireSession := RequireSession(sessions)
+	allowAPIKey := AllowAPIKey(keys, scope)
+	return func(c *fiber.Ctx) error {
+		if c.Get(HeaderAPIKey) != "" {
+			return allowAPIKey(c)
+		}
+		return requireSession(c)
+	}
+}
+
+// AllowAuthentication authenticates the requests that carry an API key or a session
+// like RequireAuthentication and lets the others through anonymously
+func AllowAuthentication(sessions *SessionService, keys *APIKeyService, scope string) fiber.Handler {
+	requireAuthentication := RequireAuthentication(sessions, keys, scope)
+	return func(c *fiber.Ctx) error {
+		if c.Get(HeaderAPIKey) == "" && c.Get(fiber.HeaderAuthorization) == "" {
+			return c.Next()
+		}
+		return requireAuthentication(c)
+	}
+}
+
+// requireOwnAccount rejects anonymous requests and requests authenticated for
+// another account than accountID
+func requireOwnAccount(c *fiber.Ctx, accountID string) error {
+	owner, authenticated := c.Locals(localAccountID).(string)
+	if !authenticated {
+		return domainerrors.ErrAuthenticationRequired
+	}
+	if owner != accountID {
+		return domainerrors.ErrAccountAccessDenied
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey lets a program act on an account within its scopes. Its secret is random
+// and only stored encrypted, the server needs it to check request signatures.
+type APIKey struct {
+	KeyID           string
+	AccountID       string
+	Name            string
+	Scopes          []string
+	AllowedIPs      []string
+	EncryptedSecret string
+	CreatedAt       time.Time
+	ExpiresAt       *time.Time
+	RevokedAt       *time.Time
+	LastUsedAt      *time.Time
+}
+
+// IAPIKeyDAO defines the interface for API key and request nonce storage
+type IAPIKeyDAO interface {
+	Save(key *APIKey) error
+	GetByID(keyID string) (*APIKey, error)
+	ListByAccount(accountID string) ([]APIKey, error)
+	// Revoke returns false when the account has no active key with that ID
+	Revoke(accountID, keyID string, at time.Time) (bool, error)
+	Touch(keyID string, at time.Time) error
+	// UseNonce records the nonce of a signed request and returns false if the key
+	// already used it within window
+	UseNonce(keyID, nonce string, at time.Time, window time.Duration) (bool, error)
+}
+
+// APIKeyDAODatabase implements IAPIKeyDAO using PostgreSQL database
+type APIKeyDAODatabase struct {
+	db *Database
+}
+
+func NewAPIKeyDAODatabase(db *Database) *APIKeyDAODatabase {
+	return &APIKeyDAODatabase{db: db}
+}
+
+func (dao *APIKeyDAODatabase) Save(key *APIKey) error {
+	query := `INSERT INTO ccca.api_key (key_id, account_id, name, scopes, allowed_ips, encrypted_secret, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := dao.db.DB.Exec(query, key.KeyID, key.AccountID, key.Name, strings.Join(key.Scopes, ","), strings.Join(key.AllowedIPs, ","), key.EncryptedSecret, key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+const apiKeyColumns = "key_id, account_id, name, scopes, allowed_ips, encrypted_secret, created_at, expires_at, revoked_at, last_used_at"
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes, allowedIPs string
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := row.Scan(&key.KeyID, &key.AccountID, &key.Name, &scopes, &allowedIPs, &key.EncryptedSecret, &key.CreatedAt, &expiresAt, &revokedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = splitList(scopes)
+	key.AllowedIPs = splitList(allowedIPs)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return key, nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func (dao *APIKeyDAODatabase) GetByID(keyID string) (*APIKey, error) {
+	key, err := scanAPIKey(dao.db.DB.QueryRow("SELECT "+apiKeyColumns+" FROM ccca.api_key WHERE key_id = $1", keyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (dao *APIKeyDAODatabase) ListByAccount(accountID string) ([]APIKey, error) {
+	rows, err := dao.db.DB.Query("SELECT "+apiKeyColumns+" FROM ccca.api_key WHERE account_id = $1 ORDER BY created_at", accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (dao *APIKeyDAODatabase) Revoke(accountID, keyID string, at time.Time) (bool, error) {
+	result, err := dao.db.DB.Exec("UPDATE ccca.api_key SET revoked_at = $1 WHERE key_id = $2 AND account_id = $3 AND revoked_at IS NULL", at, keyID, accountID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (dao *APIKeyDAODatabase) Touch(keyID string, at time.Time) error {
+	_, err := dao.db.DB.Exec("UPDATE ccca.api_key SET last_used_at = $1 WHERE key_id = $2", at, keyID)
+	return err
+}
+
+func (dao *APIKeyDAODatabase) UseNonce(keyID, nonce string, at time.Time, window time.Duration) (bool, error) {
+	// Nonces older than the window cannot be replayed anyway because their timestamp is rejected
+	if _, err := dao.db.DB.Exec("DELETE FROM ccca.api_key_nonce WHERE key_id = $1 AND seen_at < $2", keyID, at.Add(-window)); err != nil {
+		return false, err
+	}
+	result, err := dao.db.DB.Exec("INSERT INTO ccca.api_key_nonce (key_id, nonce, seen_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", keyID, nonce, at)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// APIKeyDAOMemory implements IAPIKeyDAO using in-memory storage
+type APIKeyDAOMemory struct {
+	mu     sync.Mutex
+	keys   map[string]*APIKey
+	nonces map[string]time.Time
+}
+
+func NewAPIKeyDAOMemory() *APIKeyDAOMemory {
+	return &APIKeyDAOMemory{
+		keys:   make(map[string]*APIKey),
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func copyAPIKey(key *APIKey) *APIKey {
+	copied := *key
+	copied.Scopes = slices.Clone(key.Scopes)
+	copied.AllowedIPs = slices.Clone(key.AllowedIPs)
+	return &copied
+}
+
+func (dao *APIKeyDAOMemory) Save(key *APIKey) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	dao.keys[key.KeyID] = copyAPIKey(key)
+	return nil
+}
+
+func (dao *APIKeyDAOMemory) GetByID(keyID string) (*APIKey, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	key, exists := dao.keys[keyID]
+	if !exists {
+		return nil, nil
+	}
+	return copyAPIKey(key), nil
+}
+
+func (dao *APIKeyDAOMemory) ListByAccount(accountID string) ([]APIKey, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	keys := []APIKey{}
+	for _, key := range dao.keys {
+		if key.AccountID == accountID {
+			keys = append(keys, *copyAPIKey(key))
+		}
+	}
+	slices.SortFunc(keys, func(a, b APIKey) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return keys, nil
+}
+
+func (dao *APIKeyDAOMemory) Revoke(accountID, keyID string, at time.Time) (bool, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	key, exists := dao.keys[keyID]
+	if !exists || key.AccountID != accountID || key.RevokedAt != nil {
+		return false, nil
+	}
+	key.RevokedAt = &at
+	return true, nil
+}
+
+func (dao *APIKeyDAOMemory) Touch(keyID string, at time.Time) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	if key, exists := dao.keys[keyID]; exists {
+		key.LastUsedAt = &at
+	}
+	return nil
+}
+
+func (dao *APIKeyDAOMemory) UseNonce(keyID, nonce string, at time.Time, window time.Duration) (bool, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	id := keyID + "|" + nonce
+	if seenAt, exists := dao.nonces[id]; exists && !seenAt.Before(at.Add(-window)) {
+		return false, nil
+	}
+	dao.nonces[id] = at
+	return true, nil
+}
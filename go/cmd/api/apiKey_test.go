@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const apiKeyTestAccountID = "550e8400-e29b-41d4-a716-446655440000"
+
+func newAPIKeyFixture(t *testing.T) (*APIKeyService, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := NewAPIKeyService(NewAPIKeyDAOMemory(), NewTokenSigner([]byte("secret")))
+	service.Now = func() time.Time { return now }
+	return service, &now
+}
+
+func createTestAPIKey(t *testing.T, service *APIKeyService, req types.CreateAPIKeyRequest) (*APIKey, string) {
+	key, secret, err := service.Create(apiKeyTestAccountID, req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return key, secret
+}
+
+func signedRequest(key *APIKey, secret string, now time.Time, nonce string) SignedRequest {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"assetId":"BTC"}`)
+	return SignedRequest{
+		KeyID:     key.KeyID,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		Signature: SignAPIRequest(secret, timestamp, nonce, "POST", "/withdraw", body),
+		Method:    "POST",
+		Path:      "/withdraw",
+		Body:      body,
+		IP:        "203.0.113.7",
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	service, now := newAPIKeyFixture(t)
+	past := now.Add(-time.Hour)
+	testCases := []struct {
+		name           string
+		req            types.CreateAPIKeyRequest
+		expectedFields []string
+	}{
+		{"Valid", types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read", "trade"}, AllowedIPs: []string{"10.0.0.1", "192.168.0.0/16"}}, nil},
+		{"Missing name", types.CreateAPIKeyRequest{Scopes: []string{"read"}}, []string{"name"}},
+		{"No scopes", types.CreateAPIKeyRequest{Name: "bot"}, []string{"scopes"}},
+		{"Unknown scope", types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"admin"}}, []string{"scopes"}},
+		{"Invalid IP", types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}, AllowedIPs: []string{"10.0.0"}}, []string{"allowedIps"}},
+		{"Expiry in the past", types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}, ExpiresAt: &past}, []string{"expiresAt"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := service.Create(apiKeyTestAccountID, tc.req)
+			if tc.expectedFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *domainerrors.ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKeyStoresOnlyEncryptedSecret(t *testing.T) {
+	service, _ := newAPIKeyFixture(t)
+	key, secret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"trade", "read", "trade"}})
+	other, otherSecret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}})
+
+	assert.True(t, strings.HasPrefix(key.KeyID, "ak_"))
+	assert.Equal(t, []string{"read", "trade"}, key.Scopes)
+	assert.NotEqual(t, secret, otherSecret)
+	stored, err := service.keys.GetByID(key.KeyID)
+	assert.NoError(t, err)
+	assert.NotContains(t, stored.EncryptedSecret, secret)
+	opened, err := service.openSecret(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, opened)
+	// A sealed secret only opens for the key it was issued to
+	other.EncryptedSecret = stored.EncryptedSecret
+	_, err = service.openSecret(other)
+	assert.ErrorIs(t, err, errSealedSecret)
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	service, now := newAPIKeyFixture(t)
+	key, secret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read", "withdraw"}})
+
+	authenticated, err := service.Authenticate(signedRequest(key, secret, *now, "n1"), APIKeyScopeWithdraw)
+	assert.NoError(t, err)
+	assert.Equal(t, apiKeyTestAccountID, authenticated.AccountID)
+
+	_, err = service.Authenticate(signedRequest(key, secret, *now, "n1"), APIKeyScopeWithdraw)
+	assert.ErrorIs(t, err, domainerrors.ErrReplayedRequest)
+
+	_, err = service.Authenticate(signedRequest(key, secret, *now, "n2"), APIKeyScopeTrade)
+	assert.ErrorIs(t, err, domainerrors.ErrInsufficientScope)
+
+	tampered := signedRequest(key, secret, *now, "n3")
+	tampered.Body = []byte(`{"assetId":"USD"}`)
+	_, err = service.Authenticate(tampered, APIKeyScopeWithdraw)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidSignature)
+
+	_, err = service.Authenticate(signedRequest(key, "wrong", *now, "n4"), APIKeyScopeWithdraw)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidSignature)
+
+	_, err = service.Authenticate(signedRequest(key, secret, now.Add(-time.Minute), "n5"), APIKeyScopeWithdraw)
+	assert.ErrorIs(t, err, domainerrors.ErrRequestExpired)
+
+	unknown := signedRequest(key, secret, *now, "n6")
+	unknown.KeyID = "ak_unknown"
+	_, err = service.Authenticate(unknown, APIKeyScopeRead)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidAPIKey)
+}
+
+func TestAPIKeyAuthenticateRejectsKeyFromOtherServerSecret(t *testing.T) {
+	service, now := newAPIKeyFixture(t)
+	key, secret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}})
+
+	service.signer = NewTokenSigner([]byte("rotated"))
+	_, err := service.Authenticate(signedRequest(key, secret, *now, "n1"), APIKeyScopeRead)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidAPIKey)
+}
+
+func TestAPIKeyIPAllowlist(t *testing.T) {
+	service, now := newAPIKeyFixture(t)
+	key, secret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}, AllowedIPs: []string{"203.0.113.0/24", "10.0.0.1"}})
+
+	testCases := []struct {
+		ip          string
+		expectedErr error
+	}{
+		{"203.0.113.7", nil},
+		{"10.0.0.1", nil},
+		{"::ffff:10.0.0.1", nil},
+		{"10.0.0.2", domainerrors.ErrIPNotAllowed},
+		{"invalid", domainerrors.ErrIPNotAllowed},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			req := signedRequest(key, secret, *now, strconv.Itoa(i))
+			req.IP = tc.ip
+			_, err := service.Authenticate(req, APIKeyScopeRead)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestAPIKeyExpiryAndRevocation(t *testing.T) {
+	service, now := newAPIKeyFixture(t)
+	expiresAt := now.Add(time.Hour)
+	expiring, expiringSecret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "expiring", Scopes: []string{"read"}, ExpiresAt: &expiresAt})
+	revoked, revokedSecret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "revoked", Scopes: []string{"read"}})
+
+	assert.NoError(t, service.Revoke(apiKeyTestAccountID, revoked.KeyID))
+	assert.ErrorIs(t, service.Revoke(apiKeyTestAccountID, revoked.KeyID), domainerrors.ErrAPIKeyNotFound)
+	assert.ErrorIs(t, service.Revoke("00000000-0000-0000-0000-000000000000", expiring.KeyID), domainerrors.ErrAPIKeyNotFound)
+	_, err := service.Authenticate(signedRequest(revoked, revokedSecret, *now, "n1"), APIKeyScopeRead)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidAPIKey)
+
+	*now = expiresAt
+	_, err = service.Authenticate(signedRequest(expiring, expiringSecret, *now, "n2"), APIKeyScopeRead)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidAPIKey)
+}
+
+func TestAllowAPIKey(t *testing.T) {
+	service, _ := newAPIKeyFixture(t)
+	service.Now = time.Now
+	key, secret := createTestAPIKey(t, service, types.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"read"}})
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/accounts/:accountId", AllowAPIKey(service, APIKeyScopeRead), func(c *fiber.Ctx) error {
+		if err := requireOwnAccount(c, c.Params("accountId")); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	testCases := []struct {
+		name           string
+		path           string
+		signedPath     string
+		sign           bool
+		expectedStatus int
+	}{
+		{"Anonymous", "/accounts/" + apiKeyTestAccountID, "", false, fiber.StatusUnauthorized},
+		{"Signed", "/accounts/" + apiKeyTestAccountID, "/accounts/" + apiKeyTestAccountID, true, fiber.StatusOK},
+		{"Other account", "/accounts/00000000-0000-0000-0000-000000000000", "/accounts/00000000-0000-0000-0000-000000000000", true, fiber.StatusForbidden},
+		{"Signature for another path", "/accounts/" + apiKeyTestAccountID, "/accounts", true, fiber.StatusUnauthorized},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.sign {
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				nonce := strconv.Itoa(i)
+				req.Header.Set(HeaderAPIKey, key.KeyID)
+				req.Header.Set(HeaderAPITimestamp, timestamp)
+				req.Header.Set(HeaderAPINonce, nonce)
+				req.Header.Set(HeaderAPISignature, SignAPIRequest(secret, timestamp, nonce, "GET", tc.signedPath, nil))
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+		})
+	}
+}
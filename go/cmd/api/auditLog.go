@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit event types
+const (
+	AuditLoginLocked   = "login_locked"
+	AuditLoginIPLocked = "login_ip_locked"
+	AuditLoginUnlocked = "login_unlocked"
+)
+
+// AuditEvent is a security relevant fact kept for later investigation
+type AuditEvent struct {
+	EventID    string
+	Type       string
+	AccountID  string
+	IP         string
+	Detail     string
+	OccurredAt time.Time
+}
+
+// IAuditLog defines the interface for appending and reading audit events
+type IAuditLog interface {
+	Record(event *AuditEvent) error
+	ListByAccount(accountID string) ([]AuditEvent, error)
+}
+
+// AuditLogDatabase implements IAuditLog using PostgreSQL database
+type AuditLogDatabase struct {
+	db *Database
+}
+
+func NewAuditLogDatabase(db *Database) *AuditLogDatabase {
+	return &AuditLogDatabase{db: db}
+}
+
+func (log *AuditLogDatabase) Record(event *AuditEvent) error {
+	if event.EventID == "" {
+		event.EventID = uuid.NewString()
+	}
+	query := "INSERT INTO ccca.audit_event (event_id, type, account_id, ip, detail, occurred_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	var accountID sql.NullString
+	if event.AccountID != "" {
+		accountID = sql.NullString{String: event.AccountID, Valid: true}
+	}
+	_, err := log.db.DB.Exec(query, event.EventID, event.Type, accountID, event.IP, event.Detail, event.OccurredAt)
+	return err
+}
+
+func (log *AuditLogDatabase) ListByAccount(accountID string) ([]AuditEvent, error) {
+	query := "SELECT event_id, type, account_id, ip, detail, occurred_at FROM ccca.audit_event WHERE account_id = $1 ORDER BY occurred_at"
+	rows, err := log.db.DB.Query(query, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		if err := rows.Scan(&event.EventID, &event.Type, &event.AccountID, &event.IP, &event.Detail, &event.OccurredAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// AuditLogMemory implements IAuditLog using in-memory storage
+type AuditLogMemory struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func NewAuditLogMemory() *AuditLogMemory {
+	return &AuditLogMemory{}
+}
+
+func (log *AuditLogMemory) Record(event *AuditEvent) error {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if event.EventID == "" {
+		event.EventID = uuid.NewString()
+	}
+	log.events = append(log.events, *event)
+	return nil
+}
+
+func (log *AuditLogMemory) ListByAccount(accountID string) ([]AuditEvent, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	var events []AuditEvent
+	for _, event := range log.events {
+		if event.AccountID == accountID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Events returns every recorded event, oldest first
+func (log *AuditLogMemory) Events() []AuditEvent {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return append([]AuditEvent(nil), log.events...)
+}
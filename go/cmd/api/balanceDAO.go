@@ -0,0 +1,342 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Balance is what an account holds of an asset. OnHold is locked by open orders
+// and only leaves through their fills or goes back to Available.
+type Balance struct {
+	Available decimal.Decimal
+	OnHold    decimal.Decimal
+}
+
+func (b Balance) Total() decimal.Decimal {
+	return b.Available.Add(b.OnHold)
+}
+
+// BalanceEntry is an entry of the ledger: a balance as it was right after it changed.
+// Entries are numbered in the order the changes of each balance happened.
+type BalanceEntry struct {
+	EntryID   int64
+	AccountID string
+	AssetID   types.AssetId
+	Balance   Balance
+	Timestamp time.Time
+}
+
+// errOnHoldExceeded means a release or spend asked for more than the funds on hold,
+// the orders and the balances disagree
+var errOnHoldExceeded = errors.New("balance: quantity exceeds the funds on hold")
+
+// IBalanceDAO defines the interface for the asset balances kept in ccca.account_asset.
+// Every change of a balance is recorded in the ledger, ccca.balance_entry, along with it.
+type IBalanceDAO interface {
+	Get(accountID string, asset types.AssetId) (Balance, error)
+	// Credit adds to the available balance
+	Credit(accountID string, asset types.AssetId, quantity decimal.Decimal) error
+	// Debit removes quantity from the available balance, failing with ErrInsufficientFunds
+	// instead of leaving it negative
+	Debit(accountID string, asset types.AssetId, quantity decimal.Decimal) error
+	// Hold moves quantity from available to on hold, failing with ErrInsufficientFunds
+	// instead of leaving a negative available balance
+	Hold(accountID string, asset types.AssetId, quantity decimal.Decimal) error
+	// Release moves quantity from on hold back to available, failing instead of
+	// leaving a negative on hold balance
+	Release(accountID string, asset types.AssetId, quantity decimal.Decimal) error
+	// Spend removes quantity from on hold, it is what a fill pays. It fails instead
+	// of leaving a negative on hold balance.
+	Spend(accountID string, asset types.AssetId, quantity decimal.Decimal) error
+	// EntriesAfter returns up to limit ledger entries of an account after entryID, oldest first.
+	// An entry committed later never has a lower id than one already returned.
+	EntriesAfter(accountID string, entryID int64, limit int) ([]BalanceEntry, error)
+	// LatestEntries returns the last ledger entry of each asset of an account, oldest first
+	LatestEntries(accountID string) ([]BalanceEntry, error)
+}
+
+// BalanceDAODatabase implements IBalanceDAO using PostgreSQL database
+type BalanceDAODatabase struct {
+	db querier
+	// ledger holds the entries of a unit of work until it commits, nil when every
+	// change writes its own
+	ledger *[]BalanceEntry
+}
+
+func NewBalanceDAODatabase(db *Database) *BalanceDAODatabase {
+	return &BalanceDAODatabase{db: db.DB}
+}
+
+func (dao *BalanceDAODatabase) Get(accountID string, asset types.AssetId) (Balance, error) {
+	var balance Balance
+	err := dao.db.QueryRow("SELECT available, on_hold FROM ccca.account_asset WHERE account_id = $1 AND asset_id = $2", accountID, asset).Scan(&balance.Available, &balance.OnHold)
+	if err == sql.ErrNoRows {
+		return Balance{}, nil
+	}
+	return balance, err
+}
+
+// change runs query, an update of a balance returning the new available and on hold
+// quantities, and records the result in the ledger. A query that updates nothing
+// returns sql.ErrNoRows and leaves the ledger alone. Both writes share the transaction
+// the DAO runs in, or one of their own. In a unit of work the entry waits in the
+// ledger batch until the unit commits.
+func (dao *BalanceDAODatabase) change(accountID string, asset types.AssetId, query string, args ...any) error {
+	if dao.ledger != nil {
+		balance, err := updateBalance(dao.db, query, args...)
+		if err != nil {
+			return err
+		}
+		*dao.ledger = append(*dao.ledger, BalanceEntry{AccountID: accountID, AssetID: asset, Balance: balance})
+		return nil
+	}
+	return inTransaction(dao.db, func(tx querier) error {
+		balance, err := updateBalance(tx, query, args...)
+		if err != nil {
+			return err
+		}
+		return writeLedger(tx, []BalanceEntry{{AccountID: accountID, AssetID: asset, Balance: balance}}, "")
+	})
+}
+
+func updateBalance(tx querier, query string, args ...any) (Balance, error) {
+	var balance Balance
+	err := tx.QueryRow(query+" RETURNING available, on_hold", args...).Scan(&balance.Available, &balance.OnHold)
+	return balance, err
+}
+
+// writeLedger inserts entries, in order, as the last writes of the transaction tx.
+//
+// Entry ids come from a sequence and are taken before commit, so two transactions could
+// commit the entries of an account out of order and a reader following entry ids would
+// skip the later one for good. The ledger of each account is locked until the transaction
+// ends before its entries take their ids: they are committed one transaction at a time, in
+// entry id order. The locks are taken in account order, once the balances are written, so
+// transactions waiting on them hold nothing the others wait on.
+//
+// unordered, when set, is an account left unlocked. Its entries may be committed out of
+// entry id order, it is meant for the house account every trade pays fees to.
+func writeLedger(tx querier, entries []BalanceEntry, unordered string) error {
+	accounts := []string{}
+	for _, entry := range entries {
+		if entry.AccountID != unordered && !slices.Contains(accounts, entry.AccountID) {
+			accounts = append(accounts, entry.AccountID)
+		}
+	}
+	slices.Sort(accounts)
+	for _, accountID := range accounts {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", "ledger:"+accountID); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if _, err := tx.Exec("INSERT INTO ccca.balance_entry (account_id, asset_id, available, on_hold) VALUES ($1, $2, $3, $4)", entry.AccountID, entry.AssetID, entry.Balance.Available, entry.Balance.OnHold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dao *BalanceDAODatabase) Credit(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	if quantity.IsZero() {
+		return nil
+	}
+	query := `INSERT INTO ccca.account_asset (account_id, asset_id, available, on_hold) VALUES ($1, $2, $3, 0) ON CONFLICT (account_id, asset_id) DO UPDATE SET available = ccca.account_asset.available + EXCLUDED.available`
+	return dao.change(accountID, asset, query, accountID, asset, quantity)
+}
+
+func (dao *BalanceDAODatabase) Debit(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	if quantity.IsZero() {
+		return nil
+	}
+	err := dao.change(accountID, asset, "UPDATE ccca.account_asset SET available = available - $1 WHERE account_id = $2 AND asset_id = $3 AND available >= $1", quantity, accountID, asset)
+	if err == sql.ErrNoRows {
+		return domainerrors.ErrInsufficientFunds
+	}
+	return err
+}
+
+func (dao *BalanceDAODatabase) Hold(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	if quantity.IsZero() {
+		return nil
+	}
+	err := dao.change(accountID, asset, "UPDATE ccca.account_asset SET available = available - $1, on_hold = on_hold + $1 WHERE account_id = $2 AND asset_id = $3 AND available >= $1", quantity, accountID, asset)
+	if err == sql.ErrNoRows {
+		return domainerrors.ErrInsufficientFunds
+	}
+	return err
+}
+
+func (dao *BalanceDAODatabase) Release(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	if quantity.IsZero() {
+		return nil
+	}
+	err := dao.change(accountID, asset, "UPDATE ccca.account_asset SET available = available + $1, on_hold = on_hold - $1 WHERE account_id = $2 AND asset_id = $3 AND on_hold >= $1", quantity, accountID, asset)
+	if err == sql.ErrNoRows {
+		return errOnHoldExceeded
+	}
+	return err
+}
+
+func (dao *BalanceDAODatabase) Spend(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	if quantity.IsZero() {
+		return nil
+	}
+	err := dao.change(accountID, asset, "UPDATE ccca.account_asset SET on_hold = on_hold - $1 WHERE account_id = $2 AND asset_id = $3 AND on_hold >= $1", quantity, accountID, asset)
+	if err == sql.ErrNoRows {
+		return errOnHoldExceeded
+	}
+	return err
+}
+
+const balanceEntryColumns = "entry_id, account_id, asset_id, available, on_hold, timestamp"
+
+func (dao *BalanceDAODatabase) entries(query string, args ...any) ([]BalanceEntry, error) {
+	rows, err := dao.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []BalanceEntry{}
+	for rows.Next() {
+		var entry BalanceEntry
+		if err := rows.Scan(&entry.EntryID, &entry.AccountID, &entry.AssetID, &entry.Balance.Available, &entry.Balance.OnHold, &entry.Timestamp); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (dao *BalanceDAODatabase) EntriesAfter(accountID string, entryID int64, limit int) ([]BalanceEntry, error) {
+	return dao.entries("SELECT "+balanceEntryColumns+" FROM ccca.balance_entry WHERE account_id = $1 AND entry_id > $2 ORDER BY entry_id LIMIT $3", accountID, entryID, limit)
+}
+
+func (dao *BalanceDAODatabase) LatestEntries(accountID string) ([]BalanceEntry, error) {
+	return dao.entries("SELECT "+balanceEntryColumns+" FROM (SELECT DISTINCT ON (asset_id) "+balanceEntryColumns+" FROM ccca.balance_entry WHERE account_id = $1 ORDER BY asset_id, entry_id DESC) latest ORDER BY entry_id", accountID)
+}
+
+// BalanceDAOMemory implements IBalanceDAO using in-memory storage
+type BalanceDAOMemory struct {
+	mu       sync.Mutex
+	balances map[string]map[types.AssetId]Balance
+	entries  []BalanceEntry
+}
+
+func NewBalanceDAOMemory() *BalanceDAOMemory {
+	return &BalanceDAOMemory{
+		balances: make(map[string]map[types.AssetId]Balance),
+	}
+}
+
+func (dao *BalanceDAOMemory) Get(accountID string, asset types.AssetId) (Balance, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	return dao.balances[accountID][asset], nil
+}
+
+// update applies change to a balance, creating it when the account never held the
+// asset, and records it in the ledger
+func (dao *BalanceDAOMemory) update(accountID string, asset types.AssetId, quantity decimal.Decimal, change func(*Balance) error) error {
+	if quantity.IsZero() {
+		return nil
+	}
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	balance := dao.balances[accountID][asset]
+	if err := change(&balance); err != nil {
+		return err
+	}
+	if dao.balances[accountID] == nil {
+		dao.balances[accountID] = make(map[types.AssetId]Balance)
+	}
+	dao.balances[accountID][asset] = balance
+	dao.entries = append(dao.entries, BalanceEntry{EntryID: int64(len(dao.entries) + 1), AccountID: accountID, AssetID: asset, Balance: balance, Timestamp: time.Now()})
+	return nil
+}
+
+func (dao *BalanceDAOMemory) Credit(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	return dao.update(accountID, asset, quantity, func(balance *Balance) error {
+		balance.Available = balance.Available.Add(quantity)
+		return nil
+	})
+}
+
+func (dao *BalanceDAOMemory) Debit(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	return dao.update(accountID, asset, quantity, func(balance *Balance) error {
+		if balance.Available.LessThan(quantity) {
+			return domainerrors.ErrInsufficientFunds
+		}
+		balance.Available = balance.Available.Sub(quantity)
+		return nil
+	})
+}
+
+func (dao *BalanceDAOMemory) Hold(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	return dao.update(accountID, asset, quantity, func(balance *Balance) error {
+		if balance.Available.LessThan(quantity) {
+			return domainerrors.ErrInsufficientFunds
+		}
+		balance.Available = balance.Available.Sub(quantity)
+		balance.OnHold = balance.OnHold.Add(quantity)
+		return nil
+	})
+}
+
+func (dao *BalanceDAOMemory) Release(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	return dao.update(accountID, asset, quantity, func(balance *Balance) error {
+		if balance.OnHold.LessThan(quantity) {
+			return errOnHoldExceeded
+		}
+		balance.Available = balance.Available.Add(quantity)
+		balance.OnHold = balance.OnHold.Sub(quantity)
+		return nil
+	})
+}
+
+func (dao *BalanceDAOMemory) Spend(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	return dao.update(accountID, asset, quantity, func(balance *Balance) error {
+		if balance.OnHold.LessThan(quantity) {
+			return errOnHoldExceeded
+		}
+		balance.OnHold = balance.OnHold.Sub(quantity)
+		return nil
+	})
+}
+
+func (dao *BalanceDAOMemory) EntriesAfter(accountID string, entryID int64, limit int) ([]BalanceEntry, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	entries := []BalanceEntry{}
+	for _, entry := range dao.entries {
+		if len(entries) == limit {
+			break
+		}
+		if entry.AccountID == accountID && entry.EntryID > entryID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (dao *BalanceDAOMemory) LatestEntries(accountID string) ([]BalanceEntry, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	entries := []BalanceEntry{}
+	for i, entry := range dao.entries {
+		superseded := slices.ContainsFunc(dao.entries[i+1:], func(later BalanceEntry) bool {
+			return later.AccountID == accountID && later.AssetID == entry.AssetID
+		})
+		if entry.AccountID == accountID && !superseded {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
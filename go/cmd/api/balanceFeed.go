@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/sirupsen/logrus"
+)
+
+// BalanceListener is told about the balances that change outside the exchange,
+// through deposits and withdrawals
+type BalanceListener interface {
+	OnBalanceChange(accountID string, asset types.AssetId)
+}
+
+// BalanceListeners tells every listener in turn
+type BalanceListeners []BalanceListener
+
+func (l BalanceListeners) OnBalanceChange(accountID string, asset types.AssetId) {
+	for _, listener := range l {
+		listener.OnBalanceChange(accountID, asset)
+	}
+}
+
+// Defaults of the balance feed
+const (
+	DefaultBalanceFeedHeartbeat = 15 * time.Second
+	balanceFeedPageSize         = 100
+)
+
+// BalanceFeed streams the ledger of an account as Server-Sent Events. Each event is
+// a ledger entry and carries its id, so a client that reconnects with Last-Event-ID
+// gets the entries it missed. Changes wake the streams of their account up, the
+// heartbeat also looks at the ledger for the changes nobody announced.
+type BalanceFeed struct {
+	balances IBalanceDAO
+
+	Heartbeat time.Duration
+
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func NewBalanceFeed(balances IBalanceDAO) *BalanceFeed {
+	return &BalanceFeed{
+		balances:  balances,
+		Heartbeat: DefaultBalanceFeedHeartbeat,
+		waiters:   make(map[string]map[chan struct{}]bool),
+		closed:    make(chan struct{}),
+	}
+}
+
+// parseLastEventID reads the Last-Event-ID a client resumes from, nil when it starts afresh
+func parseLastEventID(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	entryID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || entryID < 0 {
+		return nil, domainerrors.ErrInvalidLastEventID
+	}
+	return &entryID, nil
+}
+
+// Close ends every stream, the server is shutting down
+func (f *BalanceFeed) Close() {
+	f.once.Do(func() { close(f.closed) })
+}
+
+func (f *BalanceFeed) wait(accountID string) (chan struct{}, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// One pending wake up is enough, the stream reads everything new when it runs
+	changed := make(chan struct{}, 1)
+	if f.waiters[accountID] == nil {
+		f.waiters[accountID] = make(map[chan struct{}]bool)
+	}
+	f.waiters[accountID][changed] = true
+	return changed, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.waiters[accountID], changed)
+		if len(f.waiters[accountID]) == 0 {
+			delete(f.waiters, accountID)
+		}
+	}
+}
+
+func (f *BalanceFeed) wake(accountID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for changed := range f.waiters[accountID] {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// OnBalanceChange wakes the streams of the account up
+func (f *BalanceFeed) OnBalanceChange(accountID string, asset types.AssetId) {
+	f.wake(accountID)
+}
+
+// OnBookChange wakes the streams of the accounts whose orders changed, their fills
+// and holds moved their balances
+func (f *BalanceFeed) OnBookChange(change BookChange) {
+	for _, order := range change.Orders {
+		f.wake(order.AccountID)
+	}
+}
+
+// Serve writes the ledger of an account to w until the client goes away or the feed
+// is closed. Without lastEventID it starts with the latest entry of each asset.
+func (f *BalanceFeed) Serve(w *bufio.Writer, accountID string, lastEventID *int64) {
+	changed, stop := f.wait(accountID)
+	defer stop()
+	heartbeat := time.NewTicker(f.Heartbeat)
+	defer heartbeat.Stop()
+
+	var last int64
+	if lastEventID != nil {
+		last = *lastEventID
+	} else {
+		entries, err := f.balances.LatestEntries(accountID)
+		if err != nil {
+			logrus.WithError(err).WithField("accountId", accountID).Error("Error reading balance ledger")
+			return
+		}
+		if last, err = writeBalanceEvents(w, entries, last); err != nil {
+			return
+		}
+	}
+	for {
+		entries, err := f.balances.EntriesAfter(accountID, last, balanceFeedPageSize)
+		if err != nil {
+			logrus.WithError(err).WithField("accountId", accountID).Error("Error reading balance ledger")
+			return
+		}
+		if last, err = writeBalanceEvents(w, entries, last); err != nil {
+			return
+		}
+		if len(entries) == balanceFeedPageSize {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			// A comment keeps proxies from timing the connection out and tells
+			// whether the client is still there
+			if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// writeBalanceEvents writes entries as balance events and returns the id of the last one
+func writeBalanceEvents(w *bufio.Writer, entries []BalanceEntry, last int64) (int64, error) {
+	for _, entry := range entries {
+		data, err := json.Marshal(fiber.Map{
+			"assetId":   entry.AssetID,
+			"quantity":  entry.Balance.Total(),
+			"available": entry.Balance.Available,
+			"onHold":    entry.Balance.OnHold,
+			"timestamp": entry.Timestamp,
+		})
+		if err != nil {
+			return last, err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: balance\ndata: %s\n\n", entry.EntryID, data); err != nil {
+			return last, err
+		}
+		last = entry.EntryID
+	}
+	if len(entries) == 0 {
+		return last, nil
+	}
+	return last, w.Flush()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type balanceEvent struct {
+	ID        string
+	AssetID   types.AssetId `json:"assetId"`
+	Available string        `json:"available"`
+	OnHold    string        `json:"onHold"`
+}
+
+// serveFeed runs feed for accountID as a client reading the stream would see it,
+// the returned channel is closed once Serve returns
+func serveFeed(t *testing.T, feed *BalanceFeed, accountID string, lastEventID *int64) (*bufio.Reader, chan struct{}) {
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer writer.Close()
+		feed.Serve(bufio.NewWriter(writer), accountID, lastEventID)
+	}()
+	t.Cleanup(func() {
+		feed.Close()
+		reader.Close()
+		<-done
+	})
+	return bufio.NewReader(reader), done
+}
+
+// readBlock reads the lines of the next event or comment
+func readBlock(t *testing.T, reader *bufio.Reader) []string {
+	lines := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func readBalanceEvent(t *testing.T, reader *bufio.Reader) balanceEvent {
+	lines := readBlock(t, reader)
+	if !assert.Len(t, lines, 3) {
+		t.FailNow()
+	}
+	assert.Equal(t, "event: balance", lines[1])
+	var event balanceEvent
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event))
+	event.ID = strings.TrimPrefix(lines[0], "id: ")
+	return event
+}
+
+func TestBalanceFeedStartsFromLatestEntries(t *testing.T) {
+	f := newExchangeFixture(t)
+	feed := NewBalanceFeed(f.balances)
+	f.exchange.AddBookListener(feed)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	assert.NoError(t, f.balances.Debit(buyer, types.AssetIdUSD, dec("100")))
+
+	reader, _ := serveFeed(t, feed, buyer, nil)
+
+	usd := readBalanceEvent(t, reader)
+	assert.Equal(t, types.AssetIdUSD, usd.AssetID)
+	assert.Equal(t, "900", usd.Available)
+	// The fill moves both assets of the buyer and wakes the stream up
+	f.limit(t, buyer, OrderSideBuy, "1", "100")
+	events := []balanceEvent{readBalanceEvent(t, reader), readBalanceEvent(t, reader), readBalanceEvent(t, reader)}
+	assert.Equal(t, balanceEvent{AssetID: types.AssetIdUSD, Available: "800", OnHold: "100"}, withoutID(events[0]))
+	assert.Equal(t, balanceEvent{AssetID: types.AssetIdUSD, Available: "800", OnHold: "0"}, withoutID(events[1]))
+	assert.Equal(t, balanceEvent{AssetID: types.AssetIdBTC, Available: "1", OnHold: "0"}, withoutID(events[2]))
+}
+
+func withoutID(event balanceEvent) balanceEvent {
+	event.ID = ""
+	return event
+}
+
+func TestBalanceFeedResumesFromLastEventID(t *testing.T) {
+	f := newExchangeFixture(t)
+	feed := NewBalanceFeed(f.balances)
+	accountID := f.account(t, "1", "1000")
+	assert.NoError(t, f.balances.Credit(accountID, types.AssetIdBTC, dec("2")))
+	entries, _ := f.balances.EntriesAfter(accountID, 0, 10)
+	lastEventID := entries[0].EntryID
+
+	reader, _ := serveFeed(t, feed, accountID, &lastEventID)
+
+	usd := readBalanceEvent(t, reader)
+	btc := readBalanceEvent(t, reader)
+	assert.Equal(t, balanceEvent{AssetID: types.AssetIdUSD, Available: "1000", OnHold: "0"}, withoutID(usd))
+	assert.Equal(t, balanceEvent{AssetID: types.AssetIdBTC, Available: "3", OnHold: "0"}, withoutID(btc))
+	// A deposit announces itself, other accounts are not streamed
+	f.account(t, "5", "5")
+	assert.NoError(t, f.balances.Credit(accountID, types.AssetIdUSD, dec("1")))
+	feed.OnBalanceChange(accountID, types.AssetIdUSD)
+	assert.Equal(t, balanceEvent{AssetID: types.AssetIdUSD, Available: "1001", OnHold: "0"}, withoutID(readBalanceEvent(t, reader)))
+}
+
+func TestBalanceFeedHeartbeat(t *testing.T) {
+	f := newExchangeFixture(t)
+	feed := NewBalanceFeed(f.balances)
+	feed.Heartbeat = 10 * time.Millisecond
+	accountID := f.account(t, "0", "0")
+
+	reader, _ := serveFeed(t, feed, accountID, nil)
+
+	assert.Equal(t, []string{": heartbeat"}, readBlock(t, reader))
+	// Changes nobody announced show up with the next heartbeat
+	assert.NoError(t, f.balances.Credit(accountID, types.AssetIdBTC, dec("1")))
+	for {
+		lines := readBlock(t, reader)
+		if lines[0] != ": heartbeat" {
+			assert.Equal(t, "event: balance", lines[1])
+			break
+		}
+	}
+}
+
+func TestBalanceFeedClose(t *testing.T) {
+	f := newExchangeFixture(t)
+	feed := NewBalanceFeed(f.balances)
+	accountID := f.account(t, "0", "0")
+	_, done := serveFeed(t, feed, accountID, nil)
+
+	feed.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after close")
+	}
+	assert.Empty(t, feed.waiters)
+}
+
+func TestParseLastEventID(t *testing.T) {
+	testCases := []struct {
+		name          string
+		value         string
+		expected      *int64
+		expectedError error
+	}{
+		{"Missing", "", nil, nil},
+		{"Entry", "42", func() *int64 { id := int64(42); return &id }(), nil},
+		{"Not a number", "abc", nil, domainerrors.ErrInvalidLastEventID},
+		{"Negative", "-1", nil, domainerrors.ErrInvalidLastEventID},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entryID, err := parseLastEventID(tc.value)
+			assert.ErrorIs(t, err, tc.expectedError)
+			assert.Equal(t, tc.expected, entryID)
+		})
+	}
+}
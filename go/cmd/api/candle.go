@@ -0,0 +1,229 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// CandleIntervals are the bar widths candles are kept for. Bars start at multiples
+// of the width in UTC, so a day runs from midnight to midnight UTC.
+var CandleIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// Bounds of a candle series
+const (
+	DefaultCandleCount = 100
+	MaxCandleCount     = 1000
+)
+
+// Candle is the OHLCV bar of the trades of a market in the interval starting at OpenTime
+type Candle struct {
+	MarketID   string
+	Interval   string
+	OpenTime   time.Time
+	Open       decimal.Decimal
+	High       decimal.Decimal
+	Low        decimal.Decimal
+	Close      decimal.Decimal
+	Volume     decimal.Decimal
+	TradeCount int
+}
+
+// candleOf is the bar of a single trade
+func candleOf(trade Trade, interval string, width time.Duration) Candle {
+	return Candle{
+		MarketID:   trade.MarketID,
+		Interval:   interval,
+		OpenTime:   trade.Timestamp.UTC().Truncate(width),
+		Open:       trade.Price,
+		High:       trade.Price,
+		Low:        trade.Price,
+		Close:      trade.Price,
+		Volume:     trade.Quantity,
+		TradeCount: 1,
+	}
+}
+
+// merge returns the bar of c followed by the trades of next, in the same interval
+func (c Candle) merge(next Candle) Candle {
+	c.High = decimal.Max(c.High, next.High)
+	c.Low = decimal.Min(c.Low, next.Low)
+	c.Close = next.Close
+	c.Volume = c.Volume.Add(next.Volume)
+	c.TradeCount += next.TradeCount
+	return c
+}
+
+// flat is the bar of an interval without trades that follows c
+func (c Candle) flat(openTime time.Time) Candle {
+	return Candle{
+		MarketID: c.MarketID,
+		Interval: c.Interval,
+		OpenTime: openTime,
+		Open:     c.Close,
+		High:     c.Close,
+		Low:      c.Close,
+		Close:    c.Close,
+		Volume:   decimal.Zero,
+	}
+}
+
+// CandleService keeps the candles of every market up to date with the trades of the
+// exchange and serves them as gap free series
+type CandleService struct {
+	candles ICandleDAO
+	trades  ITradeDAO
+
+	Markets map[string]Market
+	Now     func() time.Time
+}
+
+func NewCandleService(candles ICandleDAO, trades ITradeDAO) *CandleService {
+	return &CandleService{
+		candles: candles,
+		trades:  trades,
+		Markets: DefaultMarkets,
+		Now:     time.Now,
+	}
+}
+
+// OnTrade folds a settled trade into the bars of every interval. A failure leaves
+// the bars behind until the next Backfill, it never fails the trade.
+func (s *CandleService) OnTrade(trade Trade) {
+	for interval, width := range CandleIntervals {
+		if err := s.candles.Merge(candleOf(trade, interval, width)); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"tradeId": trade.TradeID, "interval": interval}).Error("Error updating candle")
+		}
+	}
+}
+
+// Backfill rebuilds from the trade history the bars of a market covering from up to to
+func (s *CandleService) Backfill(marketID string, from, to time.Time) error {
+	for interval, width := range CandleIntervals {
+		start := from.UTC().Truncate(width)
+		end := to.UTC().Truncate(width).Add(width)
+		trades, err := s.trades.ListRange(marketID, start, end)
+		if err != nil {
+			return err
+		}
+		bars := []Candle{}
+		for _, trade := range trades {
+			bar := candleOf(trade, interval, width)
+			if last := len(bars) - 1; last >= 0 && bars[last].OpenTime.Equal(bar.OpenTime) {
+				bars[last] = bars[last].merge(bar)
+				continue
+			}
+			bars = append(bars, bar)
+		}
+		if err := s.candles.Replace(marketID, interval, start, end, bars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillMarkets catches every market up with the trades made while candles were
+// not being kept, starting from the day of the latest bar or from the first trade
+func (s *CandleService) BackfillMarkets() error {
+	now := s.Now()
+	for marketID := range s.Markets {
+		latest, err := s.candles.Before(marketID, "1d", now.Add(CandleIntervals["1d"]))
+		if err != nil {
+			return err
+		}
+		from := now
+		if latest != nil {
+			from = latest.OpenTime
+		} else {
+			first, err := s.trades.First(marketID)
+			if err != nil {
+				return err
+			}
+			if first == nil {
+				continue
+			}
+			from = first.Timestamp
+		}
+		if err := s.Backfill(marketID, from, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Series returns the bars of a market opening from from up to but excluding to. Empty
+// intervals are flat bars at the previous close, nothing is returned before the
+// first trade or after the current interval. An empty to is now, an empty from
+// DefaultCandleCount intervals before to.
+func (s *CandleService) Series(marketID, interval, from, to string) ([]Candle, error) {
+	width, exists := CandleIntervals[interval]
+	if !exists {
+		return nil, domainerrors.ErrInvalidInterval
+	}
+	if _, exists := s.Markets[marketID]; !exists {
+		return nil, domainerrors.ErrMarketNotFound
+	}
+	now := s.Now()
+	start, end, err := candleRange(from, to, width, now)
+	if err != nil {
+		return nil, err
+	}
+	if current := now.UTC().Truncate(width).Add(width); end.After(current) {
+		end = current
+	}
+	stored, err := s.candles.List(marketID, interval, start, end)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.candles.Before(marketID, interval, start)
+	if err != nil {
+		return nil, err
+	}
+	series := []Candle{}
+	for openTime := start; openTime.Before(end); openTime = openTime.Add(width) {
+		if len(stored) > 0 && stored[0].OpenTime.Equal(openTime) {
+			previous, stored = &stored[0], stored[1:]
+			series = append(series, *previous)
+			continue
+		}
+		if previous != nil {
+			series = append(series, previous.flat(openTime))
+		}
+	}
+	return series, nil
+}
+
+// candleRange parses the bounds of a series, aligning from to the start of its interval
+func candleRange(from, to string, width time.Duration, now time.Time) (time.Time, time.Time, error) {
+	end := now
+	if to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, domainerrors.ErrInvalidTimeRange
+		}
+		end = parsed
+	}
+	start := end.Add(-DefaultCandleCount * width)
+	if from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, domainerrors.ErrInvalidTimeRange
+		}
+		start = parsed
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, domainerrors.ErrInvalidTimeRange
+	}
+	start = start.UTC().Truncate(width)
+	if end.Sub(start) > MaxCandleCount*width {
+		return time.Time{}, time.Time{}, domainerrors.ErrInvalidTimeRange
+	}
+	return start, end.UTC(), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ICandleDAO defines the interface for the candles kept in ccca.candle
+type ICandleDAO interface {
+	// Merge folds candle into the stored one with the same market, interval and open time
+	Merge(candle Candle) error
+	// Replace drops the candles of a market and interval opening in [from, to) and saves candles instead
+	Replace(marketID, interval string, from, to time.Time, candles []Candle) error
+	// List returns the candles opening in [from, to), oldest first
+	List(marketID, interval string, from, to time.Time) ([]Candle, error)
+	// Before returns the latest candle opening before at, nil when there is none
+	Before(marketID, interval string, at time.Time) (*Candle, error)
+}
+
+// CandleDAODatabase implements ICandleDAO using PostgreSQL database
+type CandleDAODatabase struct {
+	db *Database
+}
+
+func NewCandleDAODatabase(db *Database) *CandleDAODatabase {
+	return &CandleDAODatabase{db: db}
+}
+
+const candleColumns = "market_id, interval, open_time, open, high, low, close, volume, trade_count"
+
+func (dao *CandleDAODatabase) Merge(candle Candle) error {
+	query := "INSERT INTO ccca.candle (" + candleColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) " +
+		"ON CONFLICT (market_id, interval, open_time) DO UPDATE SET high = greatest(ccca.candle.high, EXCLUDED.high), low = least(ccca.candle.low, EXCLUDED.low), " +
+		"close = EXCLUDED.close, volume = ccca.candle.volume + EXCLUDED.volume, trade_count = ccca.candle.trade_count + EXCLUDED.trade_count"
+	_, err := dao.db.DB.Exec(query, candle.MarketID, candle.Interval, candle.OpenTime, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, candle.TradeCount)
+	return err
+}
+
+func (dao *CandleDAODatabase) Replace(marketID, interval string, from, to time.Time, candles []Candle) error {
+	tx, err := dao.db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM ccca.candle WHERE market_id = $1 AND interval = $2 AND open_time >= $3 AND open_time < $4", marketID, interval, from, to); err != nil {
+		return err
+	}
+	for _, candle := range candles {
+		query := "INSERT INTO ccca.candle (" + candleColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+		if _, err := tx.Exec(query, candle.MarketID, candle.Interval, candle.OpenTime, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, candle.TradeCount); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func scanCandle(row interface{ Scan(...any) error }) (*Candle, error) {
+	candle := &Candle{}
+	err := row.Scan(&candle.MarketID, &candle.Interval, &candle.OpenTime, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume, &candle.TradeCount)
+	return candle, err
+}
+
+func (dao *CandleDAODatabase) List(marketID, interval string, from, to time.Time) ([]Candle, error) {
+	rows, err := dao.db.DB.Query("SELECT "+candleColumns+" FROM ccca.candle WHERE market_id = $1 AND interval = $2 AND open_time >= $3 AND open_time < $4 ORDER BY open_time", marketID, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	candles := []Candle{}
+	for rows.Next() {
+		candle, err := scanCandle(rows)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, *candle)
+	}
+	return candles, rows.Err()
+}
+
+func (dao *CandleDAODatabase) Before(marketID, interval string, at time.Time) (*Candle, error) {
+	candle, err := scanCandle(dao.db.DB.QueryRow("SELECT "+candleColumns+" FROM ccca.candle WHERE market_id = $1 AND interval = $2 AND open_time < $3 ORDER BY open_time DESC LIMIT 1", marketID, interval, at))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return candle, err
+}
+
+// CandleDAOMemory implements ICandleDAO using in-memory storage
+type CandleDAOMemory struct {
+	mu      sync.Mutex
+	candles map[string]Candle
+}
+
+func NewCandleDAOMemory() *CandleDAOMemory {
+	return &CandleDAOMemory{
+		candles: make(map[string]Candle),
+	}
+}
+
+func candleKey(marketID, interval string, openTime time.Time) string {
+	return marketID + "|" + interval + "|" + openTime.UTC().Format(time.RFC3339Nano)
+}
+
+func (dao *CandleDAOMemory) Merge(candle Candle) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	key := candleKey(candle.MarketID, candle.Interval, candle.OpenTime)
+	if stored, exists := dao.candles[key]; exists {
+		candle = stored.merge(candle)
+	}
+	dao.candles[key] = candle
+	return nil
+}
+
+// matching returns the stored candles of a market and interval accepted by keep, oldest first
+func (dao *CandleDAOMemory) matching(marketID, interval string, keep func(openTime time.Time) bool) []Candle {
+	candles := []Candle{}
+	for _, candle := range dao.candles {
+		if candle.MarketID == marketID && candle.Interval == interval && keep(candle.OpenTime) {
+			candles = append(candles, candle)
+		}
+	}
+	slices.SortFunc(candles, func(a, b Candle) int { return a.OpenTime.Compare(b.OpenTime) })
+	return candles
+}
+
+func inRange(from, to time.Time) func(time.Time) bool {
+	return func(openTime time.Time) bool { return !openTime.Before(from) && openTime.Before(to) }
+}
+
+func (dao *CandleDAOMemory) Replace(marketID, interval string, from, to time.Time, candles []Candle) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for _, stale := range dao.matching(marketID, interval, inRange(from, to)) {
+		delete(dao.candles, candleKey(marketID, interval, stale.OpenTime))
+	}
+	for _, candle := range candles {
+		dao.candles[candleKey(candle.MarketID, candle.Interval, candle.OpenTime)] = candle
+	}
+	return nil
+}
+
+func (dao *CandleDAOMemory) List(marketID, interval string, from, to time.Time) ([]Candle, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	return dao.matching(marketID, interval, inRange(from, to)), nil
+}
+
+func (dao *CandleDAOMemory) Before(marketID, interval string, at time.Time) (*Candle, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	candles := dao.matching(marketID, interval, func(openTime time.Time) bool { return openTime.Before(at) })
+	if len(candles) == 0 {
+		return nil, nil
+	}
+	return &candles[len(candles)-1], nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandlesFollowTrades(t *testing.T) {
+	f := newExchangeFixture(t)
+	candles := NewCandleService(NewCandleDAOMemory(), f.exchange.trades)
+	candles.Now = func() time.Time { return f.now }
+	f.exchange.AddTradeListener(candles)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+
+	_, _, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("2.5")})
+	assert.NoError(t, err)
+	f.exchange.Flush()
+	series, err := candles.Series("BTC-USD", "1m", "", "")
+
+	assert.NoError(t, err)
+	if assert.Len(t, series, 1) {
+		assert.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), series[0].OpenTime)
+		assert.Equal(t, "100", series[0].Open.String())
+		assert.Equal(t, "110", series[0].High.String())
+		assert.Equal(t, "100", series[0].Low.String())
+		assert.Equal(t, "110", series[0].Close.String())
+		assert.Equal(t, "2.5", series[0].Volume.String())
+		assert.Equal(t, 3, series[0].TradeCount)
+	}
+}
+
+// candleTrades saves trades of BTC-USD at 12:00:10 and 12:03:30
+func candleTrades(t *testing.T) *TradeDAOMemory {
+	trades := NewTradeDAOMemory()
+	for _, trade := range []struct {
+		at       time.Time
+		quantity string
+		price    string
+	}{
+		{time.Date(2025, 1, 1, 12, 0, 10, 0, time.UTC), "1", "100"},
+		{time.Date(2025, 1, 1, 12, 0, 40, 0, time.UTC), "2", "98"},
+		{time.Date(2025, 1, 1, 12, 3, 30, 0, time.UTC), "0.5", "105"},
+	} {
+		assert.NoError(t, trades.Save(&Trade{TradeID: uuid.NewString(), MarketID: "BTC-USD", Side: OrderSideBuy, Quantity: dec(trade.quantity), Price: dec(trade.price), Timestamp: trade.at}))
+	}
+	return trades
+}
+
+func TestCandleSeriesFillsEmptyIntervals(t *testing.T) {
+	candles := NewCandleService(NewCandleDAOMemory(), candleTrades(t))
+	candles.Now = func() time.Time { return time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC) }
+	assert.NoError(t, candles.BackfillMarkets())
+
+	series, err := candles.Series("BTC-USD", "1m", "2025-01-01T11:58:00Z", "2025-01-01T12:05:00Z")
+
+	assert.NoError(t, err)
+	expected := []struct {
+		minute int
+		ohlc   [4]string
+		volume string
+		trades int
+	}{
+		{0, [4]string{"100", "100", "98", "98"}, "3", 2},
+		{1, [4]string{"98", "98", "98", "98"}, "0", 0},
+		{2, [4]string{"98", "98", "98", "98"}, "0", 0},
+		{3, [4]string{"105", "105", "105", "105"}, "0.5", 1},
+		{4, [4]string{"105", "105", "105", "105"}, "0", 0},
+	}
+	if assert.Len(t, series, len(expected)) {
+		for i, candle := range series {
+			assert.Equal(t, time.Date(2025, 1, 1, 12, expected[i].minute, 0, 0, time.UTC), candle.OpenTime)
+			assert.Equal(t, expected[i].ohlc, [4]string{candle.Open.String(), candle.High.String(), candle.Low.String(), candle.Close.String()})
+			assert.Equal(t, expected[i].volume, candle.Volume.String())
+			assert.Equal(t, expected[i].trades, candle.TradeCount)
+		}
+	}
+}
+
+func TestCandleBackfillMatchesIncrementalBars(t *testing.T) {
+	trades := candleTrades(t)
+	incremental := NewCandleDAOMemory()
+	listener := NewCandleService(incremental, trades)
+	all, err := trades.ListRange("BTC-USD", time.Time{}, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	for _, trade := range all {
+		listener.OnTrade(trade)
+	}
+	backfilled := NewCandleDAOMemory()
+	// A stale bar is replaced by the one rebuilt from the trades
+	assert.NoError(t, backfilled.Merge(Candle{MarketID: "BTC-USD", Interval: "1h", OpenTime: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), Open: dec("1"), High: dec("1"), Low: dec("1"), Close: dec("1"), Volume: dec("1"), TradeCount: 1}))
+	backfill := NewCandleService(backfilled, trades)
+
+	assert.NoError(t, backfill.Backfill("BTC-USD", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)))
+
+	for interval := range CandleIntervals {
+		from, to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+		expected, err := incremental.List("BTC-USD", interval, from, to)
+		assert.NoError(t, err)
+		actual, err := backfilled.List("BTC-USD", interval, from, to)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, interval)
+	}
+}
+
+func TestCandleSeriesRejections(t *testing.T) {
+	candles := NewCandleService(NewCandleDAOMemory(), NewTradeDAOMemory())
+	candles.Now = func() time.Time { return time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC) }
+	testCases := []struct {
+		name        string
+		marketID    string
+		interval    string
+		from        string
+		to          string
+		expectedErr error
+	}{
+		{"Unknown interval", "BTC-USD", "15m", "", "", domainerrors.ErrInvalidInterval},
+		{"Missing interval", "BTC-USD", "", "", "", domainerrors.ErrInvalidInterval},
+		{"Unknown market", "ETH-USD", "1m", "", "", domainerrors.ErrMarketNotFound},
+		{"From not a time", "BTC-USD", "1m", "yesterday", "", domainerrors.ErrInvalidTimeRange},
+		{"To not a time", "BTC-USD", "1m", "", "2025-01-01", domainerrors.ErrInvalidTimeRange},
+		{"From after to", "BTC-USD", "1m", "2025-01-01T11:00:00Z", "2025-01-01T10:00:00Z", domainerrors.ErrInvalidTimeRange},
+		{"Too many candles", "BTC-USD", "1m", "2024-12-31T00:00:00Z", "2025-01-01T12:00:00Z", domainerrors.ErrInvalidTimeRange},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := candles.Series(tc.marketID, tc.interval, tc.from, tc.to)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DocumentType identifies which Brazilian tax id a document holds
+type DocumentType string
+
+const (
+	DocumentTypeUnknown DocumentType = ""
+	DocumentTypeCPF     DocumentType = "CPF"
+	DocumentTypeCNPJ    DocumentType = "CNPJ"
+)
+
+const (
+	cpfLength  = 11
+	cnpjLength = 14
+)
+
+// Sequences that pass the check digit calculation but are never issued
+var knownInvalidDocuments = map[string]bool{
+	"12345678909": true,
+}
+
+var cnpjPattern = regexp.MustCompile(`^[0-9A-Z]{12}[0-9]{2}$`)
+
+// Document is a CPF or CNPJ. Validate normalizes Digits and detects Type.
+// CNPJs may use the alphanumeric format, so Digits can hold uppercase letters.
+type Document struct {
+	Digits string
+	Type   DocumentType
+}
+
+func (d *Document) Validate() bool {
+	if d.Digits == "" {
+		return false
+	}
+	d.detectType()
+	if d.allDigitsSame() || knownInvalidDocuments[d.Digits] {
+		return false
+	}
+	switch d.Type {
+	case DocumentTypeCPF:
+		return d.extractDigits() == fmt.Sprintf("%d%d", d.calculateDigit(10), d.calculateDigit(11))
+	case DocumentTypeCNPJ:
+		return cnpjPattern.MatchString(d.Digits) &&
+			d.Digits[12:] == fmt.Sprintf("%d%d", d.calculateCNPJDigit(12), d.calculateCNPJDigit(13))
+	default:
+		return false
+	}
+}
+
+// Format returns the document with its usual punctuation, or the normalized value if the type is unknown
+func (d *Document) Format() string {
+	switch {
+	case d.Type == DocumentTypeCPF && len(d.Digits) == cpfLength:
+		return fmt.Sprintf("%s.%s.%s-%s", d.Digits[0:3], d.Digits[3:6], d.Digits[6:9], d.Digits[9:])
+	case d.Type == DocumentTypeCNPJ && len(d.Digits) == cnpjLength:
+		return fmt.Sprintf("%s.%s.%s/%s-%s", d.Digits[0:2], d.Digits[2:5], d.Digits[5:8], d.Digits[8:12], d.Digits[12:])
+	default:
+		return d.Digits
+	}
+}
+
+// FormatDocument formats a stored document for responses. Documents stored before
+// their type was recorded have it detected again.
+func FormatDocument(digits, documentType string) string {
+	document := Document{Digits: digits, Type: DocumentType(documentType)}
+	if document.Type == DocumentTypeUnknown {
+		document.detectType()
+	}
+	return document.Format()
+}
+
+// NormalizeDocument strips the punctuation of a CPF or CNPJ the way Validate stores it
+func NormalizeDocument(document string) string {
+	normalized := Document{Digits: document}
+	normalized.detectType()
+	return normalized.Digits
+}
+
+// detectType normalizes Digits for the detected document type
+func (d *Document) detectType() {
+	alphanumeric := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'Z':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return -1
+		}
+	}, d.Digits)
+	if len(alphanumeric) == cnpjLength {
+		d.Digits = alphanumeric
+		d.Type = DocumentTypeCNPJ
+		return
+	}
+	d.clean()
+	switch len(d.Digits) {
+	case cpfLength:
+		d.Type = DocumentTypeCPF
+	case cnpjLength:
+		d.Type = DocumentTypeCNPJ
+	default:
+		d.Type = DocumentTypeUnknown
+	}
+}
+
+func (d *Document) clean() {
+	// Remove non-numeric characters
+	re := regexp.MustCompile(`\D`)
+	d.Digits = re.ReplaceAllString(d.Digits, "")
+}
+
+func (d *Document) allDigitsSame() bool {
+	if len(d.Digits) == 0 {
+		return false
+	}
+	firstDigit := d.Digits[0]
+	for i := 1; i < len(d.Digits); i++ {
+		if d.Digits[i] != firstDigit {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Document) calculateDigit(factor int) int {
+	sum := 0
+	digitsToProcess := factor - 1
+	for i := 0; i < digitsToProcess && i < len(d.Digits); i++ {
+		digit := int(d.Digits[i] - '0')
+		sum += digit * (factor - i)
+	}
+	remainder := sum % 11
+	if remainder < 2 {
+		return 0
+	}
+	return 11 - remainder
+}
+
+// calculateCNPJDigit computes the check digit over the first length characters.
+// Each character is worth its ASCII code minus 48, so digits keep their value and
+// letters of the alphanumeric CNPJ map from A=17 onwards.
+func (d *Document) calculateCNPJDigit(length int) int {
+	sum := 0
+	weight := length - 7
+	for i := 0; i < length && i < len(d.Digits); i++ {
+		sum += int(d.Digits[i]-'0') * weight
+		weight--
+		if weight < 2 {
+			weight = 9
+		}
+	}
+	remainder := sum % 11
+	if remainder < 2 {
+		return 0
+	}
+	return 11 - remainder
+}
+
+func (d *Document) extractDigits() string {
+	return d.Digits[9:]
+}
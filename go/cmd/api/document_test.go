@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentValidateCNPJ(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"Valid CNPJ", "11222333000181", true},
+		{"Valid CNPJ formatted", "11.222.333/0001-81", true},
+		{"Valid alphanumeric CNPJ", "12ABC34501DE35", true},
+		{"Valid alphanumeric CNPJ formatted", "12.ABC.345/01DE-35", true},
+		{"Valid alphanumeric CNPJ lowercase", "12.abc.345/01de-35", true},
+		{"Invalid CNPJ - wrong digits", "11222333000182", false},
+		{"Invalid alphanumeric CNPJ - wrong digits", "12ABC34501DE36", false},
+		{"Invalid CNPJ - letter in check digits", "12ABC34501DE3A", false},
+		{"Invalid CNPJ - all same digits", "00000000000000", false},
+		{"Invalid CNPJ - too short", "1122233300018", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := Document{Digits: tc.input}
+			assert.Equal(t, tc.expected, doc.Validate())
+		})
+	}
+}
+
+func TestDocumentDetectsType(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          string
+		expectedType   DocumentType
+		expectedDigits string
+	}{
+		{"CPF", "111.444.777-35", DocumentTypeCPF, "11144477735"},
+		{"CNPJ", "11.222.333/0001-81", DocumentTypeCNPJ, "11222333000181"},
+		{"Alphanumeric CNPJ", "12.abc.345/01de-35", DocumentTypeCNPJ, "12ABC34501DE35"},
+		{"Unknown length", "1234", DocumentTypeUnknown, "1234"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := Document{Digits: tc.input}
+			doc.Validate()
+			assert.Equal(t, tc.expectedType, doc.Type)
+			assert.Equal(t, tc.expectedDigits, doc.Digits)
+		})
+	}
+}
+
+func TestDocumentRejectsKnownInvalidSequences(t *testing.T) {
+	doc := Document{Digits: "123.456.789-09"}
+	assert.False(t, doc.Validate())
+	assert.Equal(t, DocumentTypeCPF, doc.Type)
+}
+
+func TestDocumentFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"CPF", "11144477735", "111.444.777-35"},
+		{"CNPJ", "11222333000181", "11.222.333/0001-81"},
+		{"Alphanumeric CNPJ", "12abc34501de35", "12.ABC.345/01DE-35"},
+		{"Unknown", "1234", "1234"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := Document{Digits: tc.input}
+			doc.Validate()
+			assert.Equal(t, tc.expected, doc.Format())
+		})
+	}
+}
+
+func TestFormatDocument(t *testing.T) {
+	assert.Equal(t, "111.444.777-35", FormatDocument("11144477735", "CPF"))
+	assert.Equal(t, "11.222.333/0001-81", FormatDocument("11222333000181", "CNPJ"))
+	// Rows stored before the type was recorded
+	assert.Equal(t, "111.444.777-35", FormatDocument("11144477735", ""))
+}
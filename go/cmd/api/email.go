@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/idna"
+)
+
+var (
+	emailLocalPartPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+$`)
+	emailDomainPattern    = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+([a-z]{2,}|xn--[a-z0-9-]+)$`)
+)
+
+// Throwaway inbox providers that are refused at signup, subdomains included
+var defaultDisposableDomains = []string{
+	"10minutemail.com",
+	"dispostable.com",
+	"getnada.com",
+	"guerrillamail.com",
+	"mailinator.com",
+	"maildrop.cc",
+	"sharklasers.com",
+	"temp-mail.org",
+	"tempmail.com",
+	"throwawaymail.com",
+	"trashmail.com",
+	"yopmail.com",
+}
+
+// MXResolver looks up mail exchangers; *net.Resolver satisfies it and tests can stub it
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// EmailPolicy configures the checks applied when parsing an email address
+type EmailPolicy struct {
+	DisposableDomains map[string]bool
+	CheckMX           bool
+	Resolver          MXResolver
+	LookupTimeout     time.Duration
+}
+
+var DefaultEmailPolicy = NewEmailPolicy(defaultDisposableDomains)
+
+func NewEmailPolicy(disposableDomains []string) EmailPolicy {
+	policy := EmailPolicy{
+		DisposableDomains: make(map[string]bool),
+		Resolver:          net.DefaultResolver,
+		LookupTimeout:     3 * time.Second,
+	}
+	for _, domain := range disposableDomains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			policy.DisposableDomains[domain] = true
+		}
+	}
+	return policy
+}
+
+// NewEmailPolicyFromEnv enables MX checks with EMAIL_CHECK_MX=true and extends the
+// disposable domain list with the comma separated EMAIL_DISPOSABLE_DOMAINS
+func NewEmailPolicyFromEnv() EmailPolicy {
+	domains := append([]string(nil), defaultDisposableDomains...)
+	domains = append(domains, strings.Split(os.Getenv("EMAIL_DISPOSABLE_DOMAINS"), ",")...)
+	policy := NewEmailPolicy(domains)
+	policy.CheckMX = strings.EqualFold(os.Getenv("EMAIL_CHECK_MX"), "true")
+	return policy
+}
+
+// Email is an address whose domain is mapped and normalized as IDNA2008 lookups do
+// and encoded in its ASCII (punycode) form, so lookalike spellings of a domain
+// such as decomposed accents or fullwidth letters give the same address
+type Email struct {
+	localPart string
+	domain    string
+}
+
+func NewEmail(raw string) (Email, error) {
+	return DefaultEmailPolicy.Parse(raw)
+}
+
+// ParseSyntax normalizes raw without the disposable domain and MX checks
+func (p EmailPolicy) ParseSyntax(raw string) (Email, error) {
+	raw = strings.TrimSpace(raw)
+	at := strings.LastIndex(raw, "@")
+	if at <= 0 || at == len(raw)-1 {
+		return Email{}, domainerrors.ErrInvalidEmail
+	}
+	localPart, domain := raw[:at], strings.ToLower(raw[at+1:])
+	if !emailLocalPartPattern.MatchString(localPart) {
+		return Email{}, domainerrors.ErrInvalidEmail
+	}
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || len(domain) > 253 || !emailDomainPattern.MatchString(domain) {
+		return Email{}, domainerrors.ErrInvalidEmail
+	}
+	return Email{localPart: localPart, domain: domain}, nil
+}
+
+func (p EmailPolicy) Parse(raw string) (Email, error) {
+	email, err := p.ParseSyntax(raw)
+	if err != nil {
+		return Email{}, err
+	}
+	if p.isDisposable(email.domain) {
+		return Email{}, domainerrors.ErrDisposableEmail
+	}
+	if p.CheckMX && !p.acceptsMail(email.domain) {
+		return Email{}, domainerrors.ErrEmailUndeliverable
+	}
+	return email, nil
+}
+
+func (p EmailPolicy) isDisposable(domain string) bool {
+	for {
+		if p.DisposableDomains[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// acceptsMail fails only when DNS says the domain cannot receive mail, so a
+// resolver outage never blocks signups
+func (p EmailPolicy) acceptsMail(domain string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.LookupTimeout)
+	defer cancel()
+	records, err := p.Resolver.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false
+		}
+		logrus.WithError(err).WithField("domain", domain).Warn("MX lookup failed, accepting email")
+		return true
+	}
+	// A single "." exchanger is the RFC 7505 null MX
+	if len(records) == 0 || (len(records) == 1 && records[0].Host == ".") {
+		return false
+	}
+	return true
+}
+
+func (e Email) String() string {
+	return e.localPart + "@" + e.domain
+}
+
+func (e Email) Domain() string {
+	return e.domain
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/sirupsen/logrus"
+)
+
+// EmailVerificationService issues single-use verification links and activates accounts
+type EmailVerificationService struct {
+	accounts IAccountDAO
+	tokens   IAccountTokenDAO
+	mailer   mailer.Mailer
+	signer   *TokenSigner
+
+	Now            func() time.Time
+	VerifyURL      string
+	TokenTTL       time.Duration
+	ResendCooldown time.Duration
+	ResendWindow   time.Duration
+	ResendLimit    int
+}
+
+func NewEmailVerificationService(accounts IAccountDAO, tokens IAccountTokenDAO, m mailer.Mailer, signer *TokenSigner) *EmailVerificationService {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+	return &EmailVerificationService{
+		accounts:       accounts,
+		tokens:         tokens,
+		mailer:         m,
+		signer:         signer,
+		Now:            time.Now,
+		VerifyURL:      baseURL + "/verify-email",
+		TokenTTL:       24 * time.Hour,
+		ResendCooldown: time.Minute,
+		ResendWindow:   time.Hour,
+		ResendLimit:    5,
+	}
+}
+
+// Send issues a new verification token for account and emails the link
+func (s *EmailVerificationService) Send(ctx context.Context, account *Account) error {
+	now := s.Now()
+	token, claims := s.signer.Sign(TokenPurposeEmailVerification, account.AccountID, now.Add(s.TokenTTL))
+	err := s.tokens.Save(&AccountToken{
+		TokenID:   claims.ID,
+		AccountID: account.AccountID,
+		Purpose:   TokenPurposeEmailVerification,
+		CreatedAt: now,
+		ExpiresAt: claims.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	link := s.VerifyURL + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      account.Email,
+		Subject: "Confirm your email address",
+		Body:    fmt.Sprintf("Hello %s,\n\nConfirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n", account.Name, link, s.TokenTTL),
+	})
+}
+
+// Verify consumes token and activates the account it was issued for
+func (s *EmailVerificationService) Verify(token string) (*Account, error) {
+	claims, err := s.signer.Verify(TokenPurposeEmailVerification, token, s.Now())
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.tokens.GetByID(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.AccountID != claims.Subject || stored.Purpose != TokenPurposeEmailVerification {
+		return nil, domainerrors.ErrInvalidToken
+	}
+	account, err := s.accounts.GetByID(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, domainerrors.ErrInvalidToken
+	}
+	consumed, err := s.tokens.MarkUsed(claims.ID, s.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, domainerrors.ErrTokenAlreadyUsed
+	}
+	if account.Status == AccountStatusPending {
+		if err := s.accounts.UpdateStatus(account.AccountID, AccountStatusActive); err != nil {
+			return nil, err
+		}
+		account.Status = AccountStatusActive
+	}
+	return account, nil
+}
+
+// Resend mails a new link to a pending account. Unknown or already verified
+// addresses are ignored so the endpoint does not reveal which emails exist.
+func (s *EmailVerificationService) Resend(ctx context.Context, email string) error {
+	account, err := s.accounts.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	if account == nil || account.Status != AccountStatusPending {
+		return nil
+	}
+	now := s.Now()
+	recent, err := s.tokens.CountIssuedSince(account.AccountID, TokenPurposeEmailVerification, now.Add(-s.ResendCooldown))
+	if err != nil {
+		return err
+	}
+	inWindow, err := s.tokens.CountIssuedSince(account.AccountID, TokenPurposeEmailVerification, now.Add(-s.ResendWindow))
+	if err != nil {
+		return err
+	}
+	if recent > 0 || inWindow >= s.ResendLimit {
+		logrus.WithField("accountId", account.AccountID).Warn("Verification email resend rate limited")
+		return domainerrors.ErrTooManyRequests
+	}
+	return s.Send(ctx, account)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+type emailVerificationFixture struct {
+	service  *EmailVerificationService
+	accounts *AccountDAOMemory
+	mailer   *mailer.MemoryMailer
+	now      time.Time
+	account  *Account
+}
+
+func newEmailVerificationFixture(t *testing.T) *emailVerificationFixture {
+	f := &emailVerificationFixture{
+		accounts: NewAccountDAOMemory(),
+		mailer:   &mailer.MemoryMailer{},
+		now:      time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		account: &Account{
+			AccountID: "550e8400-e29b-41d4-a716-446655440000",
+			Name:      "Gustavo B",
+			Email:     "gustavo@example.com",
+			Document:  "11144477735",
+			Status:    AccountStatusPending,
+		},
+	}
+	f.service = NewEmailVerificationService(f.accounts, NewAccountTokenDAOMemory(), f.mailer, NewTokenSigner([]byte("secret")))
+	f.service.VerifyURL = "http://localhost:3000/verify-email"
+	f.service.Now = func() time.Time { return f.now }
+	assert.NoError(t, f.accounts.Save(f.account))
+	return f
+}
+
+// lastToken extracts the token from the most recent link mailed to the account
+func (f *emailVerificationFixture) lastToken(t *testing.T) string {
+	messages := f.mailer.Messages(f.account.Email)
+	if !assert.NotEmpty(t, messages) {
+		t.FailNow()
+	}
+	body := messages[len(messages)-1].Body
+	start := strings.Index(body, f.service.VerifyURL)
+	link := strings.Fields(body[start:])[0]
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	return parsed.Query().Get("token")
+}
+
+func TestEmailVerificationActivatesAccount(t *testing.T) {
+	f := newEmailVerificationFixture(t)
+	assert.NoError(t, f.service.Send(context.Background(), f.account))
+
+	account, err := f.service.Verify(f.lastToken(t))
+	assert.NoError(t, err)
+	assert.Equal(t, AccountStatusActive, account.Status)
+	stored, _ := f.accounts.GetByID(f.account.AccountID)
+	assert.Equal(t, AccountStatusActive, stored.Status)
+}
+
+func TestEmailVerificationTokenIsSingleUse(t *testing.T) {
+	f := newEmailVerificationFixture(t)
+	assert.NoError(t, f.service.Send(context.Background(), f.account))
+	token := f.lastToken(t)
+
+	_, err := f.service.Verify(token)
+	assert.NoError(t, err)
+	_, err = f.service.Verify(token)
+	assert.ErrorIs(t, err, domainerrors.ErrTokenAlreadyUsed)
+}
+
+func TestEmailVerificationTokenExpires(t *testing.T) {
+	f := newEmailVerificationFixture(t)
+	assert.NoError(t, f.service.Send(context.Background(), f.account))
+	f.now = f.now.Add(f.service.TokenTTL)
+
+	_, err := f.service.Verify(f.lastToken(t))
+	assert.ErrorIs(t, err, domainerrors.ErrTokenExpired)
+	stored, _ := f.accounts.GetByID(f.account.AccountID)
+	assert.Equal(t, AccountStatusPending, stored.Status)
+}
+
+func TestEmailVerificationRejectsUnknownToken(t *testing.T) {
+	f := newEmailVerificationFixture(t)
+	// Correctly signed but never stored, e.g. issued before a database reset
+	token, _ := NewTokenSigner([]byte("secret")).Sign(TokenPurposeEmailVerification, f.account.AccountID, f.now.Add(time.Hour))
+
+	_, err := f.service.Verify(token)
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidToken)
+}
+
+func TestEmailVerificationResendRateLimit(t *testing.T) {
+	f := newEmailVerificationFixture(t)
+	f.service.ResendLimit = 3
+	assert.NoError(t, f.service.Send(context.Background(), f.account))
+
+	assert.ErrorIs(t, f.service.Resend(context.Background(), f.account.Email), domainerrors.ErrTooManyRequests)
+
+	f.now = f.now.Add(f.service.ResendCooldown + time.Second)
+	assert.NoError(t, f.service.Resend(context.Background(), "GUSTAVO@example.com"))
+	f.now = f.now.Add(f.service.ResendCooldown + time.Second)
+	assert.NoError(t, f.service.Resend(context.Background(), f.account.Email))
+	f.now = f.now.Add(f.service.ResendCooldown + time.Second)
+	assert.ErrorIs(t, f.service.Resend(context.Background(), f.account.Email), domainerrors.ErrTooManyRequests)
+	assert.Len(t, f.mailer.Messages(f.account.Email), 3)
+
+	f.now = f.now.Add(f.service.ResendWindow)
+	assert.NoError(t, f.service.Resend(context.Background(), f.account.Email))
+}
+
+func TestEmailVerificationResendIgnoresUnknownAndActiveAccounts(t *testing.T) {
+	f := newEmailVerificationFixture(t)
+	assert.NoError(t, f.service.Resend(context.Background(), "nobody@example.com"))
+
+	assert.NoError(t, f.accounts.UpdateStatus(f.account.AccountID, AccountStatusActive))
+	assert.NoError(t, f.service.Resend(context.Background(), f.account.Email))
+	assert.Empty(t, f.mailer.Messages(f.account.Email))
+}
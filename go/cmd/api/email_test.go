@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubMXResolver struct {
+	records map[string][]*net.MX
+	err     error
+	lookups int
+}
+
+func (r *stubMXResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	records, ok := r.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestNewEmail(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expected      string
+		expectedError error
+	}{
+		{"Lowercases the domain", "Foo.Bar@Example.COM", "Foo.Bar@example.com", nil},
+		{"Trims whitespace", "  foo@example.com ", "foo@example.com", nil},
+		{"IDN domain", "contato@Exemplo-Ação.com.br", "contato@xn--exemplo-ao-n5a1c.com.br", nil},
+		{"IDN TLD", "user@пример.рф", "user@xn--e1afmkfd.xn--p1ai", nil},
+		{"Decomposed accents", "contato@exemplo-ac\u0327a\u0303o.com.br", "contato@xn--exemplo-ao-n5a1c.com.br", nil},
+		{"Fullwidth letters", "foo@ｅｘａｍｐｌｅ.com", "foo@example.com", nil},
+		{"Uppercase IDN", "foo@MÜNCHEN.de", "foo@xn--mnchen-3ya.de", nil},
+		{"Disposable domain", "foo@mailinator.com", "", domainerrors.ErrDisposableEmail},
+		{"Disposable subdomain", "foo@inbox.Mailinator.com", "", domainerrors.ErrDisposableEmail},
+		{"Missing local part", "@example.com", "", domainerrors.ErrInvalidEmail},
+		{"Missing domain", "foo@", "", domainerrors.ErrInvalidEmail},
+		{"Domain without TLD", "foo@localhost", "", domainerrors.ErrInvalidEmail},
+		{"Label starting with hyphen", "foo@-example.com", "", domainerrors.ErrInvalidEmail},
+		{"Non ASCII local part", "joão@example.com", "", domainerrors.ErrInvalidEmail},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			email, err := NewEmail(tc.input)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, email.String())
+		})
+	}
+}
+
+func TestEmailPolicyMXCheck(t *testing.T) {
+	resolver := &stubMXResolver{records: map[string][]*net.MX{
+		"example.com":        {{Host: "mx.example.com.", Pref: 10}},
+		"nomail.example.org": {{Host: ".", Pref: 0}},
+		"xn--mnchen-3ya.de":  {{Host: "mx.xn--mnchen-3ya.de.", Pref: 10}},
+	}}
+	policy := NewEmailPolicy(nil)
+	policy.CheckMX = true
+	policy.Resolver = resolver
+
+	_, err := policy.Parse("foo@example.com")
+	assert.NoError(t, err)
+	_, err = policy.Parse("foo@münchen.de")
+	assert.NoError(t, err)
+	_, err = policy.Parse("foo@nomail.example.org")
+	assert.ErrorIs(t, err, domainerrors.ErrEmailUndeliverable)
+	_, err = policy.Parse("foo@unknown.example.net")
+	assert.ErrorIs(t, err, domainerrors.ErrEmailUndeliverable)
+
+	// Syntax errors never reach the resolver
+	lookups := resolver.lookups
+	_, err = policy.Parse("not-an-email")
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidEmail)
+	assert.Equal(t, lookups, resolver.lookups)
+}
+
+func TestEmailPolicyAcceptsOnResolverFailure(t *testing.T) {
+	policy := NewEmailPolicy(nil)
+	policy.CheckMX = true
+	policy.Resolver = &stubMXResolver{err: errors.New("i/o timeout")}
+
+	_, err := policy.Parse("foo@example.com")
+	assert.NoError(t, err)
+}
+
+func TestNewEmailPolicyFromEnv(t *testing.T) {
+	t.Setenv("EMAIL_CHECK_MX", "TRUE")
+	t.Setenv("EMAIL_DISPOSABLE_DOMAINS", " Burner.io ,")
+	policy := NewEmailPolicyFromEnv()
+	assert.True(t, policy.CheckMX)
+	assert.True(t, policy.DisposableDomains["burner.io"])
+	assert.True(t, policy.DisposableDomains["mailinator.com"])
+}
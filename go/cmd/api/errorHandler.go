@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/i18n"
+	"github.com/sirupsen/logrus"
+)
+
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response body
+type Problem struct {
+	Type     string                    `json:"type"`
+	Title    string                    `json:"title"`
+	Status   int                       `json:"status"`
+	Detail   string                    `json:"detail,omitempty"`
+	Instance string                    `json:"instance,omitempty"`
+	Code     string                    `json:"code"`
+	Errors   []domainerrors.FieldError `json:"errors,omitempty"`
+}
+
+func statusForKind(kind domainerrors.Kind) int {
+	switch kind {
+	case domainerrors.KindMalformed:
+		return fiber.StatusBadRequest
+	case domainerrors.KindValidation, domainerrors.KindBusinessRule:
+		return fiber.StatusUnprocessableEntity
+	case domainerrors.KindNotFound:
+		return fiber.StatusNotFound
+	case domainerrors.KindUnauthorized:
+		return fiber.StatusUnauthorized
+	case domainerrors.KindForbidden:
+		return fiber.StatusForbidden
+	case domainerrors.KindRateLimited:
+		return fiber.StatusTooManyRequests
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
+
+func problemType(code string) string {
+	return "/problems/" + strings.ReplaceAll(code, "_", "-")
+}
+
+// ErrorHandler maps errors returned by handlers to application/problem+json responses
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var validationErr *domainerrors.ValidationError
+	var domainErr *domainerrors.Error
+	var fiberErr *fiber.Error
+	var problem Problem
+	switch {
+	case errors.As(err, &validationErr):
+		failed := domainerrors.ErrValidationFailed
+		problem = Problem{Status: statusForKind(failed.Kind), Code: failed.Code, Detail: failed.Message, Errors: validationErr.Fields}
+	case errors.As(err, &domainErr):
+		problem = Problem{Status: statusForKind(domainErr.Kind), Code: domainErr.Code, Detail: domainErr.Message}
+	case errors.As(err, &fiberErr):
+		code := strings.ReplaceAll(strings.ToLower(http.StatusText(fiberErr.Code)), " ", "_")
+		problem = Problem{Status: fiberErr.Code, Code: code, Detail: fiberErr.Message}
+	default:
+		problem = Problem{Status: fiber.StatusInternalServerError, Code: domainerrors.ErrInternal.Code, Detail: domainerrors.ErrInternal.Message}
+	}
+	if problem.Status >= fiber.StatusInternalServerError {
+		logrus.WithError(err).WithField("path", c.Path()).Error("Unhandled error")
+	}
+	locale := i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage))
+	localize(&problem, locale)
+	c.Set(fiber.HeaderContentLanguage, string(locale))
+	problem.Type = problemType(problem.Code)
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = c.OriginalURL()
+	return c.Status(problem.Status).JSON(problem, MIMEApplicationProblemJSON)
+}
+
+// localize replaces the detail and field messages with the catalog entries for locale
+func localize(problem *Problem, locale i18n.Locale) {
+	problem.Detail = i18n.Translate(locale, problem.Code, problem.Detail)
+	fields := make([]domainerrors.FieldError, len(problem.Errors))
+	for i, field := range problem.Errors {
+		field.Message = i18n.Translate(locale, field.Code, field.Message)
+		fields[i] = field
+	}
+	if len(fields) > 0 {
+		problem.Errors = fields
+	}
+}
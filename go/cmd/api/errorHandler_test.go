@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Malformed body", domainerrors.ErrInvalidRequestBody, fiber.StatusBadRequest, "invalid_request_body"},
+		{"Validation error", domainerrors.ErrInvalidName, fiber.StatusUnprocessableEntity, "invalid_name"},
+		{"Business rule", domainerrors.ErrInsufficientFunds, fiber.StatusUnprocessableEntity, "insufficient_funds"},
+		{"Not found", domainerrors.ErrAccountNotFound, fiber.StatusNotFound, "account_not_found"},
+		{"Unauthorized", domainerrors.ErrAuthenticationRequired, fiber.StatusUnauthorized, "authentication_required"},
+		{"Forbidden", domainerrors.ErrEmailNotVerified, fiber.StatusForbidden, "email_not_verified"},
+		{"Rate limited", domainerrors.ErrTooManyRequests, fiber.StatusTooManyRequests, "too_many_requests"},
+		{"Wrapped domain error", fmt.Errorf("signup: %w", domainerrors.ErrDuplicateEmail), fiber.StatusUnprocessableEntity, "duplicate_email"},
+		{"Fiber error", fiber.ErrMethodNotAllowed, fiber.StatusMethodNotAllowed, "method_not_allowed"},
+		{"Unknown error", errors.New("pq: connection refused"), fiber.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/", func(c *fiber.Ctx) error { return tc.err })
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+			assert.Equal(t, MIMEApplicationProblemJSON, resp.Header.Get("Content-Type"))
+			var problem Problem
+			if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedCode, problem.Code)
+			assert.Equal(t, tc.expectedStatus, problem.Status)
+			assert.Equal(t, "/", problem.Instance)
+			assert.NotEmpty(t, problem.Type)
+			assert.NotEmpty(t, problem.Title)
+			assert.NotContains(t, problem.Detail, "pq:")
+		})
+	}
+}
+
+func TestErrorHandlerValidationErrors(t *testing.T) {
+	validation := &domainerrors.ValidationError{}
+	validation.Add("name", domainerrors.ErrInvalidName)
+	validation.Add("password", domainerrors.ErrInvalidPassword)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/signup", func(c *fiber.Ctx) error { return validation })
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/signup", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	var problem Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "validation_failed", problem.Code)
+	assert.Equal(t, []domainerrors.FieldError{
+		{Field: "name", Code: "invalid_name", Message: "Invalid name"},
+		{Field: "password", Code: "invalid_password", Message: "Invalid password"},
+	}, problem.Errors)
+}
+
+func TestErrorHandlerLocalizesMessages(t *testing.T) {
+	validation := &domainerrors.ValidationError{}
+	validation.Add("name", domainerrors.ErrInvalidName)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/signup", func(c *fiber.Ctx) error { return validation })
+
+	req := httptest.NewRequest("POST", "/signup", nil)
+	req.Header.Set("Accept-Language", "pt-BR,pt;q=0.9,en;q=0.8")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, "pt-BR", resp.Header.Get("Content-Language"))
+	var problem Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "A validação da requisição falhou", problem.Detail)
+	assert.Equal(t, "Nome inválido", problem.Errors[0].Message)
+	assert.Equal(t, "Invalid name", validation.Fields[0].Message, "shared error must not be mutated")
+}
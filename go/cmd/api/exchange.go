@@ -0,0 +1,869 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// TradeListener is told about every trade once the operation that settled it is
+// committed, in trade sequence. It is called from a goroutine of the exchange's own,
+// the next notification waits for it but nothing else does.
+type TradeListener interface {
+	OnTrade(trade Trade)
+}
+
+// BookChange is what an operation on the exchange changed in a market: the orders
+// it placed or updated, in the state they were saved in, oldest change first
+type BookChange struct {
+	MarketID string
+	Orders   []Order
+}
+
+// BookListener is told about the changes of every operation once it is committed,
+// in commit order, from the goroutine the trade listeners are called from.
+type BookListener interface {
+	OnBookChange(change BookChange)
+}
+
+// Exchange places and cancels orders, matching them by best price and then by time
+type Exchange struct {
+	orders   IOrderDAO
+	trades   ITradeDAO
+	balances IBalanceDAO
+	work     IUnitOfWork
+
+	Markets map[string]Market
+	Fees    *FeeEngine
+	Now     func() time.Time
+
+	listeners     []TradeListener
+	bookListeners []BookListener
+	// tx is the unit of work of the running operation, every write goes through it
+	tx ExchangeTx
+	// changed and settled collect the orders saved and the trades settled by the running operation
+	changed []Order
+	settled []Trade
+	// notifications wait for the listeners in commit order
+	notifications []notification
+	// delivering is set while a goroutine hands notifications to the listeners, idle
+	// is signalled when it runs out of them
+	delivering bool
+	idle       *sync.Cond
+
+	// mu serializes matching on this server, the market locks of the transactions on all of them
+	mu sync.Mutex
+}
+
+// notification is what the listeners hear about a committed operation
+type notification struct {
+	trades  []Trade
+	changes []BookChange
+}
+
+func (e *Exchange) AddTradeListener(listener TradeListener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, listener)
+}
+
+func (e *Exchange) AddBookListener(listener BookListener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bookListeners = append(e.bookListeners, listener)
+}
+
+func (e *Exchange) saveOrder(order *Order) error {
+	if err := e.tx.Orders.Save(order); err != nil {
+		return err
+	}
+	e.changed = append(e.changed, *order)
+	return nil
+}
+
+func (e *Exchange) updateOrder(order *Order) error {
+	if err := e.tx.Orders.Update(order); err != nil {
+		return err
+	}
+	e.changed = append(e.changed, *order)
+	return nil
+}
+
+// run performs op in a single unit of work. Once it is committed the trade listeners
+// hear about the trades it settled and the book listeners about the orders it saved,
+// after run returns. An operation that fails leaves no trace and tells nobody.
+func (e *Exchange) run(op func() error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.work.Run(func(tx ExchangeTx) error {
+		e.tx = tx
+		return op()
+	})
+	if err == nil && (len(e.settled) > 0 || len(e.changed) > 0) {
+		e.notifications = append(e.notifications, notification{trades: e.settled, changes: bookChanges(e.changed)})
+		if !e.delivering {
+			e.delivering = true
+			go e.deliver()
+		}
+	}
+	e.tx, e.changed, e.settled = ExchangeTx{}, nil, nil
+	return err
+}
+
+// deliver hands the queued notifications to the listeners, in the order they were
+// queued, until there are none left
+func (e *Exchange) deliver() {
+	for {
+		e.mu.Lock()
+		notifications, listeners, bookListeners := e.notifications, e.listeners, e.bookListeners
+		e.notifications = nil
+		if len(notifications) == 0 {
+			e.delivering = false
+			e.idle.Broadcast()
+			e.mu.Unlock()
+			return
+		}
+		e.mu.Unlock()
+		for _, notification := range notifications {
+			for _, trade := range notification.trades {
+				for _, listener := range listeners {
+					listener.OnTrade(trade)
+				}
+			}
+			for _, change := range notification.changes {
+				for _, listener := range bookListeners {
+					listener.OnBookChange(change)
+				}
+			}
+		}
+	}
+}
+
+// Flush waits until the listeners heard about every operation committed so far
+func (e *Exchange) Flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for e.delivering {
+		e.idle.Wait()
+	}
+}
+
+// bookChanges groups the orders an operation saved by market
+func bookChanges(changed []Order) []BookChange {
+	changes := []BookChange{}
+	for _, order := range changed {
+		i := slices.IndexFunc(changes, func(change BookChange) bool { return change.MarketID == order.MarketID })
+		if i < 0 {
+			changes = append(changes, BookChange{MarketID: order.MarketID})
+			i = len(changes) - 1
+		}
+		changes[i].Orders = append(changes[i].Orders, order)
+	}
+	return changes
+}
+
+func NewExchange(orders IOrderDAO, trades ITradeDAO, balances IBalanceDAO, work IUnitOfWork) *Exchange {
+	e := &Exchange{
+		orders:   orders,
+		trades:   trades,
+		balances: balances,
+		work:     work,
+		Markets:  DefaultMarkets,
+		Fees:     NewFeeEngine(trades),
+		Now:      time.Now,
+	}
+	e.idle = sync.NewCond(&e.mu)
+	return e
+}
+
+func validatePlaceOrderRequest(req types.PlaceOrderRequest, markets map[string]Market, now time.Time) (Market, error) {
+	validation := &domainerrors.ValidationError{}
+	market, exists := markets[req.MarketID]
+	if !exists {
+		validation.Add("marketId", domainerrors.ErrInvalidMarket)
+	}
+	if req.Side != OrderSideBuy && req.Side != OrderSideSell {
+		validation.Add("side", domainerrors.ErrInvalidOrderSide)
+	}
+	switch req.Type {
+	case OrderTypeLimit, OrderTypeStopLimit:
+		if exists && (!req.Price.IsPositive() || !market.IsTickMultiple(req.Price)) {
+			validation.Add("price", domainerrors.ErrInvalidPrice)
+		}
+		if exists && (!req.Quantity.IsPositive() || !market.IsLotMultiple(req.Quantity)) {
+			validation.Add("quantity", domainerrors.ErrInvalidLotSize)
+		}
+		if !req.QuoteQuantity.IsZero() {
+			validation.Add("quoteQuantity", domainerrors.ErrInvalidQuoteQuantity)
+		}
+		switch req.TimeInForce {
+		case "", TimeInForceGTC, TimeInForceIOC, TimeInForceFOK, TimeInForceGTD:
+		default:
+			validation.Add("timeInForce", domainerrors.ErrInvalidTimeInForce)
+		}
+		if (req.TimeInForce == TimeInForceGTD) != (req.ExpiresAt != nil) || (req.ExpiresAt != nil && !req.ExpiresAt.After(now)) {
+			validation.Add("expiresAt", domainerrors.ErrInvalidExpiry)
+		}
+		// An order that never rests cannot add liquidity, nor can one that is triggered by trading
+		if req.PostOnly && (req.Type == OrderTypeStopLimit || req.TimeInForce == TimeInForceIOC || req.TimeInForce == TimeInForceFOK) {
+			validation.Add("postOnly", domainerrors.ErrInvalidPostOnly)
+		}
+	case OrderTypeMarket:
+		if !req.Price.IsZero() {
+			validation.Add("price", domainerrors.ErrInvalidPrice)
+		}
+		// Exactly one of quantity and quoteQuantity says how much to trade
+		if req.Quantity.IsZero() == req.QuoteQuantity.IsZero() || req.QuoteQuantity.IsNegative() {
+			validation.Add("quoteQuantity", domainerrors.ErrInvalidQuoteQuantity)
+		} else if exists && !req.Quantity.IsZero() && (!req.Quantity.IsPositive() || !market.IsLotMultiple(req.Quantity)) {
+			validation.Add("quantity", domainerrors.ErrInvalidLotSize)
+		}
+		if req.MaxSlippage.IsNegative() || req.MaxSlippage.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			validation.Add("maxSlippage", domainerrors.ErrInvalidSlippage)
+		}
+		if req.WorstPrice.IsNegative() {
+			validation.Add("worstPrice", domainerrors.ErrInvalidPrice)
+		}
+		validateFillOrKill(req, validation)
+	case OrderTypeStop:
+		if !req.Price.IsZero() {
+			validation.Add("price", domainerrors.ErrInvalidPrice)
+		}
+		if exists && (!req.Quantity.IsPositive() || !market.IsLotMultiple(req.Quantity)) {
+			validation.Add("quantity", domainerrors.ErrInvalidLotSize)
+		}
+		if !req.QuoteQuantity.IsZero() {
+			validation.Add("quoteQuantity", domainerrors.ErrInvalidQuoteQuantity)
+		}
+		// The book a stop meets is unknown until it triggers, only a fixed worst price can guard it
+		if !req.MaxSlippage.IsZero() {
+			validation.Add("maxSlippage", domainerrors.ErrInvalidSlippage)
+		}
+		// A stop buy reserves quantity at its worst price
+		if req.WorstPrice.IsNegative() || (req.Side == OrderSideBuy && !req.WorstPrice.IsPositive()) || (exists && !market.IsTickMultiple(req.WorstPrice)) {
+			validation.Add("worstPrice", domainerrors.ErrInvalidPrice)
+		}
+		validateFillOrKill(req, validation)
+	default:
+		validation.Add("type", domainerrors.ErrInvalidOrderType)
+	}
+	if req.Type == OrderTypeStop || req.Type == OrderTypeStopLimit {
+		if exists && (!req.StopPrice.IsPositive() || !market.IsTickMultiple(req.StopPrice)) {
+			validation.Add("stopPrice", domainerrors.ErrInvalidStopPrice)
+		}
+	} else if !req.StopPrice.IsZero() {
+		validation.Add("stopPrice", domainerrors.ErrInvalidStopPrice)
+	}
+	return market, validation.ErrorOrNil()
+}
+
+// validateFillOrKill rejects the lifetime options of orders that fill on arrival or not at all
+func validateFillOrKill(req types.PlaceOrderRequest, validation *domainerrors.ValidationError) {
+	if req.TimeInForce != "" && req.TimeInForce != TimeInForceFOK {
+		validation.Add("timeInForce", domainerrors.ErrInvalidTimeInForce)
+	}
+	if req.ExpiresAt != nil {
+		validation.Add("expiresAt", domainerrors.ErrInvalidExpiry)
+	}
+	if req.PostOnly {
+		validation.Add("postOnly", domainerrors.ErrInvalidPostOnly)
+	}
+}
+
+// activeAccount rejects accounts that may not trade or deposit
+func activeAccount(accounts IAccountDAO, accountID string) error {
+	account, err := accounts.GetByID(accountID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case account == nil:
+		return domainerrors.ErrAccountNotFound
+	case account.Status == AccountStatusPending:
+		return domainerrors.ErrEmailNotVerified
+	case account.Status == AccountStatusClosed:
+		return domainerrors.ErrAccountClosed
+	}
+	return nil
+}
+
+// timeInForce defaults limit orders to GTC, market and stop orders are always FOK
+func timeInForce(req types.PlaceOrderRequest) string {
+	switch {
+	case req.Type == OrderTypeMarket || req.Type == OrderTypeStop:
+		return TimeInForceFOK
+	case req.TimeInForce == "":
+		return TimeInForceGTC
+	}
+	return req.TimeInForce
+}
+
+// Place matches the order against the book. What is left of a GTC or GTD limit
+// order rests, an IOC order cancels it. FOK and market orders fill completely or
+// are rejected without touching the book, and so are post-only orders that would
+// trade at all. Stop orders reserve their funds and wait off the book, see placeStop.
+// Everything the order does, stops it triggers included, is committed at once.
+func (e *Exchange) Place(accountID string, req types.PlaceOrderRequest) (*Order, []Trade, error) {
+	market, err := validatePlaceOrderRequest(req, e.Markets, e.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	var order *Order
+	var trades []Trade
+	err = e.run(func() error {
+		if err := e.tx.LockMarket(market.MarketID); err != nil {
+			return err
+		}
+		// The account is not closed before the order is committed, and is not closed
+		// with it open afterwards
+		if err := e.tx.ShareAccount(accountID); err != nil {
+			return err
+		}
+		if err := activeAccount(e.tx.Accounts, accountID); err != nil {
+			return err
+		}
+		order, trades, err = e.place(market, accountID, req)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, trades, nil
+}
+
+func (e *Exchange) place(market Market, accountID string, req types.PlaceOrderRequest) (*Order, []Trade, error) {
+	now := e.Now()
+	order := &Order{
+		OrderID:       uuid.NewString(),
+		MarketID:      market.MarketID,
+		AccountID:     accountID,
+		Side:          req.Side,
+		Type:          req.Type,
+		Quantity:      req.Quantity,
+		Price:         req.Price,
+		QuoteQuantity: req.QuoteQuantity,
+		Status:        OrderStatusOpen,
+		Timestamp:     now,
+		TimeInForce:   timeInForce(req),
+		PostOnly:      req.PostOnly,
+		ExpiresAt:     req.ExpiresAt,
+		StopPrice:     req.StopPrice,
+	}
+	switch order.Type {
+	case OrderTypeStop:
+		order.Price = req.WorstPrice
+		return e.placeStop(market, order, now)
+	case OrderTypeStopLimit:
+		return e.placeStop(market, order, now)
+	}
+	resting, err := e.tx.Orders.ListOpen(market.MarketID)
+	if err != nil {
+		return nil, nil, err
+	}
+	makers := bookSide(resting, oppositeSide(order.Side), now)
+	limit := order.Price
+	if order.Type == OrderTypeMarket {
+		limit = worstPrice(req, order.IsBuy(), makers)
+	}
+	plan := planMatch(market, order, makers, limit)
+	if order.Type == OrderTypeMarket {
+		if err := checkMarketPlan(plan); err != nil {
+			logrus.WithFields(logrus.Fields{"accountId": accountID, "marketId": market.MarketID, "side": order.Side}).WithError(err).Warn("Market order rejected")
+			return nil, nil, err
+		}
+		order.Quantity = plan.base
+	}
+	if order.PostOnly && len(plan.fills) > 0 {
+		return nil, nil, domainerrors.ErrPostOnlyWouldTake
+	}
+	if order.Type == OrderTypeLimit && order.TimeInForce == TimeInForceFOK && !plan.complete {
+		return nil, nil, domainerrors.ErrOrderNotFillable
+	}
+
+	asset, reserved := reservation(market, order, plan)
+	if err := e.tx.Balances.Hold(accountID, asset, reserved); err != nil {
+		return nil, nil, err
+	}
+	trades, err := e.execute(market, order, plan, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.TimeInForce == TimeInForceIOC && order.Status == OrderStatusOpen {
+		if err := e.release(market, order); err != nil {
+			return nil, nil, err
+		}
+		order.Status = OrderStatusCancelled
+	}
+	if err := e.saveOrder(order); err != nil {
+		return nil, nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"orderId":      order.OrderID,
+		"accountId":    accountID,
+		"marketId":     market.MarketID,
+		"side":         order.Side,
+		"type":         order.Type,
+		"timeInForce":  order.TimeInForce,
+		"fillQuantity": order.FillQuantity,
+		"status":       order.Status,
+	}).Info("Order placed")
+	if err := e.triggerStops(market, trades, now); err != nil {
+		return nil, nil, err
+	}
+	return order, trades, nil
+}
+
+// placeStop reserves the funds of a stop order and parks it off the book. When the
+// last trade already reached the stop price it is triggered right away.
+func (e *Exchange) placeStop(market Market, order *Order, now time.Time) (*Order, []Trade, error) {
+	asset, reserved := reservation(market, order, matchPlan{})
+	if err := e.tx.Balances.Hold(order.AccountID, asset, reserved); err != nil {
+		return nil, nil, err
+	}
+	order.Status = OrderStatusPending
+	if err := e.saveOrder(order); err != nil {
+		return nil, nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"orderId":   order.OrderID,
+		"accountId": order.AccountID,
+		"marketId":  market.MarketID,
+		"side":      order.Side,
+		"type":      order.Type,
+		"stopPrice": order.StopPrice,
+	}).Info("Stop order placed")
+	last, err := e.tx.Trades.Last(market.MarketID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if last == nil || !order.isTriggeredBy(last.Price) {
+		return order, []Trade{}, nil
+	}
+	trades, err := e.activate(market, order, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := e.triggerStops(market, trades, now); err != nil {
+		return nil, nil, err
+	}
+	return order, trades, nil
+}
+
+// triggerStops activates the pending stop orders reached by trades, one trade at a
+// time in the order they happened. Trades of the activated orders are queued behind
+// them, so a cascade of stops is resolved in trade sequence too. Stops reached by
+// the same trade activate oldest first.
+func (e *Exchange) triggerStops(market Market, trades []Trade, now time.Time) error {
+	queue := slices.Clone(trades)
+	for len(queue) > 0 {
+		price := queue[0].Price
+		queue = queue[1:]
+		pending, err := e.tx.Orders.ListPending(market.MarketID)
+		if err != nil {
+			return err
+		}
+		for i := range pending {
+			stop := &pending[i]
+			if stop.IsExpired(now) || !stop.isTriggeredBy(price) {
+				continue
+			}
+			triggered, err := e.activate(market, stop, now)
+			if err != nil {
+				return err
+			}
+			queue = append(queue, triggered...)
+		}
+	}
+	return nil
+}
+
+// activate matches a triggered stop order as the market or limit order it becomes.
+// Its funds were reserved when it was placed and whatever it does not use is released.
+func (e *Exchange) activate(market Market, order *Order, now time.Time) ([]Trade, error) {
+	order.Status = OrderStatusOpen
+	order.TriggeredAt = &now
+	resting, err := e.tx.Orders.ListOpen(market.MarketID)
+	if err != nil {
+		return nil, err
+	}
+	plan := planMatch(market, order, bookSide(resting, oppositeSide(order.Side), now), order.Price)
+	trades := []Trade{}
+	if order.TimeInForce != TimeInForceFOK || plan.complete {
+		if trades, err = e.execute(market, order, plan, now); err != nil {
+			return nil, err
+		}
+	}
+	if order.Status == OrderStatusOpen && (order.TimeInForce == TimeInForceFOK || order.TimeInForce == TimeInForceIOC) {
+		if err := e.release(market, order); err != nil {
+			return nil, err
+		}
+		order.Status = OrderStatusCancelled
+	}
+	if err := e.updateOrder(order); err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"orderId":      order.OrderID,
+		"accountId":    order.AccountID,
+		"marketId":     market.MarketID,
+		"stopPrice":    order.StopPrice,
+		"fillQuantity": order.FillQuantity,
+		"status":       order.Status,
+	}).Info("Stop order triggered")
+	return trades, nil
+}
+
+func oppositeSide(side string) string {
+	if side == OrderSideBuy {
+		return OrderSideSell
+	}
+	return OrderSideBuy
+}
+
+// bookSide returns the resting orders of side, best price first. resting is oldest
+// first and the sort is stable, so orders at the same price keep time priority.
+// Orders past their expiry are left out even before the sweeper gets to them.
+func bookSide(resting []Order, side string, now time.Time) []*Order {
+	makers := []*Order{}
+	for i := range resting {
+		if resting[i].Side == side && !resting[i].IsExpired(now) {
+			makers = append(makers, &resting[i])
+		}
+	}
+	slices.SortStableFunc(makers, func(a, b *Order) int {
+		if side == OrderSideSell {
+			return a.Price.Cmp(b.Price)
+		}
+		return b.Price.Cmp(a.Price)
+	})
+	return makers
+}
+
+// worstPrice is the tighter of the explicit worst price and the maximum slippage
+// from the best price on the book. Zero means the order is not guarded.
+func worstPrice(req types.PlaceOrderRequest, buy bool, makers []*Order) decimal.Decimal {
+	worst := req.WorstPrice
+	if req.MaxSlippage.IsPositive() && len(makers) > 0 {
+		one := decimal.NewFromInt(1)
+		slipped := makers[0].Price.Mul(one.Sub(req.MaxSlippage))
+		if buy {
+			slipped = makers[0].Price.Mul(one.Add(req.MaxSlippage))
+		}
+		if worst.IsZero() || (buy && slipped.LessThan(worst)) || (!buy && slipped.GreaterThan(worst)) {
+			worst = slipped
+		}
+	}
+	return worst
+}
+
+type plannedFill struct {
+	maker    *Order
+	quantity decimal.Decimal
+	price    decimal.Decimal
+}
+
+// matchPlan is what an order would trade, computed before anything is changed
+type matchPlan struct {
+	fills []plannedFill
+	base  decimal.Decimal
+	quote decimal.Decimal
+	// complete is true when the order would be entirely filled
+	complete bool
+	// limited is true when matching stopped at the price limit with liquidity left beyond it
+	limited bool
+	// tooSmall is true when a quote quantity does not pay for a single lot at the best price
+	tooSmall bool
+}
+
+func planMatch(market Market, taker *Order, makers []*Order, limit decimal.Decimal) matchPlan {
+	plan := matchPlan{}
+	byQuote := taker.Quantity.IsZero()
+	for _, maker := range makers {
+		if !limit.IsZero() && ((taker.IsBuy() && maker.Price.GreaterThan(limit)) || (!taker.IsBuy() && maker.Price.LessThan(limit))) {
+			plan.limited = true
+			return plan
+		}
+		var quantity, affordable decimal.Decimal
+		if byQuote {
+			affordable = market.FloorToLot(taker.QuoteQuantity.Sub(plan.quote).Div(maker.Price))
+			if affordable.IsZero() {
+				// What is left does not buy a single lot, the order is as filled as it can be
+				plan.complete = len(plan.fills) > 0
+				plan.tooSmall = !plan.complete
+				return plan
+			}
+			quantity = decimal.Min(maker.Remaining(), affordable)
+		} else {
+			quantity = decimal.Min(maker.Remaining(), taker.Quantity.Sub(plan.base))
+		}
+		plan.fills = append(plan.fills, plannedFill{maker: maker, quantity: quantity, price: maker.Price})
+		plan.base = plan.base.Add(quantity)
+		plan.quote = plan.quote.Add(quantity.Mul(maker.Price))
+		// A quote quantity spent down to its last lot at this price cannot buy more at a worse one
+		if (!byQuote && plan.base.Equal(taker.Quantity)) || (byQuote && quantity.Equal(affordable)) {
+			plan.complete = true
+			return plan
+		}
+	}
+	return plan
+}
+
+func checkMarketPlan(plan matchPlan) error {
+	switch {
+	case plan.complete:
+		return nil
+	case plan.tooSmall:
+		return domainerrors.ErrOrderTooSmall
+	case plan.limited:
+		return domainerrors.ErrSlippageExceeded
+	}
+	return domainerrors.ErrInsufficientLiquidity
+}
+
+// reservation is what an order puts on hold when placed: the quote asset for buys, at the
+// limit or worst price or the exact cost of a market order, and the base asset for sells
+func reservation(market Market, order *Order, plan matchPlan) (types.AssetId, decimal.Decimal) {
+	if order.IsBuy() {
+		if order.Type == OrderTypeMarket {
+			return market.Quote, plan.quote
+		}
+		return market.Quote, order.Quantity.Mul(order.Price)
+	}
+	return market.Base, order.Quantity
+}
+
+func (e *Exchange) execute(market Market, taker *Order, plan matchPlan, now time.Time) ([]Trade, error) {
+	trades := []Trade{}
+	for _, planned := range plan.fills {
+		maker := planned.maker
+		maker.fill(planned.quantity, planned.price)
+		taker.fill(planned.quantity, planned.price)
+		trade := Trade{
+			TradeID:   uuid.NewString(),
+			MarketID:  market.MarketID,
+			Side:      taker.Side,
+			Quantity:  planned.quantity,
+			Price:     planned.price,
+			Timestamp: now,
+		}
+		buyer, seller := taker, maker
+		if !taker.IsBuy() {
+			buyer, seller = maker, taker
+		}
+		trade.BuyOrderID, trade.SellOrderID = buyer.OrderID, seller.OrderID
+		trade.BuyAccountID, trade.SellAccountID = buyer.AccountID, seller.AccountID
+		if err := e.priceFees(market, &trade, maker, taker, now); err != nil {
+			return nil, err
+		}
+		if err := e.tx.Trades.Save(&trade); err != nil {
+			return nil, err
+		}
+		if err := e.updateOrder(maker); err != nil {
+			return nil, err
+		}
+		if err := e.settle(market, trade, buyer, seller); err != nil {
+			return nil, err
+		}
+		e.settled = append(e.settled, trade)
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// received is what an order gets out of a trade: base for the buyer, quote for the seller
+func received(market Market, order *Order, trade *Trade) (types.AssetId, decimal.Decimal) {
+	if order.IsBuy() {
+		return market.Base, trade.Quantity
+	}
+	return market.Quote, trade.Quantity.Mul(trade.Price)
+}
+
+// priceFees sets the fee of each side on the trade, charged in the asset it receives
+func (e *Exchange) priceFees(market Market, trade *Trade, maker, taker *Order, now time.Time) error {
+	makerRate, err := e.Fees.rate(e.tx.Trades, maker.AccountID, market.MarketID, true, now)
+	if err != nil {
+		return err
+	}
+	takerRate, err := e.Fees.rate(e.tx.Trades, taker.AccountID, market.MarketID, false, now)
+	if err != nil {
+		return err
+	}
+	asset, quantity := received(market, maker, trade)
+	trade.MakerFee, trade.MakerFeeAsset = quantity.Mul(makerRate), asset
+	asset, quantity = received(market, taker, trade)
+	trade.TakerFee, trade.TakerFeeAsset = quantity.Mul(takerRate), asset
+	return nil
+}
+
+// settle pays out a trade from the funds both sides put on hold when their order
+// was placed, less their fees, which go to the house fee account. A buyer whose
+// limit or worst price was above the trade price gets the difference released.
+func (e *Exchange) settle(market Market, trade Trade, buyer, seller *Order) error {
+	cost := trade.Quantity.Mul(trade.Price)
+	buyerFee, _, _ := trade.feeOf(OrderSideBuy)
+	sellerFee, _, _ := trade.feeOf(OrderSideSell)
+	if err := e.tx.Balances.Spend(buyer.AccountID, market.Quote, cost); err != nil {
+		return err
+	}
+	if err := e.tx.Balances.Credit(buyer.AccountID, market.Base, trade.Quantity.Sub(buyerFee)); err != nil {
+		return err
+	}
+	if err := e.tx.Balances.Spend(seller.AccountID, market.Base, trade.Quantity); err != nil {
+		return err
+	}
+	if err := e.tx.Balances.Credit(seller.AccountID, market.Quote, cost.Sub(sellerFee)); err != nil {
+		return err
+	}
+	if buyerFee.IsPositive() {
+		if err := e.tx.Balances.Credit(e.Fees.AccountID, market.Base, buyerFee); err != nil {
+			return err
+		}
+	}
+	if sellerFee.IsPositive() {
+		if err := e.tx.Balances.Credit(e.Fees.AccountID, market.Quote, sellerFee); err != nil {
+			return err
+		}
+	}
+	if buyer.Type != OrderTypeMarket && buyer.Price.GreaterThan(trade.Price) {
+		return e.tx.Balances.Release(buyer.AccountID, market.Quote, buyer.Price.Sub(trade.Price).Mul(trade.Quantity))
+	}
+	return nil
+}
+
+// Cancel takes an open or pending order of the account off the book and releases what it reserved
+func (e *Exchange) Cancel(accountID, orderID string) (*Order, error) {
+	var order *Order
+	err := e.run(func() error {
+		var err error
+		order, err = e.lockedOrder(orderID)
+		if err != nil {
+			return err
+		}
+		if order == nil || order.AccountID != accountID {
+			return domainerrors.ErrOrderNotFound
+		}
+		if order.Status != OrderStatusOpen && order.Status != OrderStatusPending {
+			return domainerrors.ErrOrderNotOpen
+		}
+		if err := e.release(e.Markets[order.MarketID], order); err != nil {
+			return err
+		}
+		order.Status = OrderStatusCancelled
+		return e.updateOrder(order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{"orderId": orderID, "accountId": accountID}).Info("Order cancelled")
+	return order, nil
+}
+
+// lockedOrder locks the market of an order and reads it again, as it was when
+// whoever held the lock before committed
+func (e *Exchange) lockedOrder(orderID string) (*Order, error) {
+	order, err := e.tx.Orders.GetByID(orderID)
+	if err != nil || order == nil {
+		return order, err
+	}
+	if err := e.tx.LockMarket(order.MarketID); err != nil {
+		return nil, err
+	}
+	return e.tx.Orders.GetByID(orderID)
+}
+
+// release makes what the unfilled part of a limit or stop order held available again
+func (e *Exchange) release(market Market, order *Order) error {
+	if order.IsBuy() {
+		return e.tx.Balances.Release(order.AccountID, market.Quote, order.Remaining().Mul(order.Price))
+	}
+	return e.tx.Balances.Release(order.AccountID, market.Base, order.Remaining())
+}
+
+// ExpireOrders takes the GTD orders past their expiry, triggered or not, off the book and releases
+// what they reserved. It returns how many orders expired, none when it fails.
+func (e *Exchange) ExpireOrders() (int, error) {
+	var expired []Order
+	err := e.run(func() error {
+		// Every market is locked, in the same order on every server
+		for _, marketID := range slices.Sorted(maps.Keys(e.Markets)) {
+			if err := e.tx.LockMarket(marketID); err != nil {
+				return err
+			}
+		}
+		var err error
+		if expired, err = e.tx.Orders.ListExpired(e.Now()); err != nil {
+			return err
+		}
+		for i := range expired {
+			order := &expired[i]
+			if err := e.release(e.Markets[order.MarketID], order); err != nil {
+				return err
+			}
+			order.Status = OrderStatusExpired
+			if err := e.updateOrder(order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, order := range expired {
+		logrus.WithFields(logrus.Fields{"orderId": order.OrderID, "accountId": order.AccountID}).Info("Order expired")
+	}
+	return len(expired), nil
+}
+
+// orderExpirySweepIntervalFromEnv reads ORDER_EXPIRY_SWEEP_INTERVAL, every 10 seconds by default
+func orderExpirySweepIntervalFromEnv() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("ORDER_EXPIRY_SWEEP_INTERVAL")); err == nil && value > 0 {
+		return value
+	}
+	return 10 * time.Second
+}
+
+// RunExpirySweeper calls ExpireOrders every interval until ctx is done
+func (e *Exchange) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.ExpireOrders(); err != nil {
+				logrus.WithError(err).Error("Error expiring orders")
+			}
+		}
+	}
+}
+
+// Get returns an order of the account with its trades
+func (e *Exchange) Get(accountID, orderID string) (*Order, []Trade, error) {
+	order, err := e.orders.GetByID(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order == nil || order.AccountID != accountID {
+		return nil, nil, domainerrors.ErrOrderNotFound
+	}
+	trades, err := e.trades.ListByOrder(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, trades, nil
+}
+
+func (e *Exchange) List(accountID string) ([]Order, error) {
+	return e.orders.ListByAccount(accountID)
+}
@@ -0,0 +1,673 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type exchangeFixture struct {
+	exchange *Exchange
+	accounts *AccountDAOMemory
+	orders   *OrderDAOMemory
+	balances *BalanceDAOMemory
+	now      time.Time
+}
+
+func newExchangeFixture(t *testing.T) *exchangeFixture {
+	f := &exchangeFixture{
+		accounts: NewAccountDAOMemory(),
+		orders:   NewOrderDAOMemory(),
+		balances: NewBalanceDAOMemory(),
+		now:      time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	trades := NewTradeDAOMemory()
+	f.exchange = NewExchange(f.orders, trades, f.balances, NewUnitOfWorkMemory(f.accounts, NewAccountHoldingsDAOMemory(), f.orders, trades, f.balances))
+	// Matching is tested without fees, fee tests set their own schedule
+	f.exchange.Fees.Schedules = map[string]FeeSchedule{}
+	f.exchange.Now = func() time.Time {
+		// Every order gets its own instant so time priority is visible
+		f.now = f.now.Add(time.Second)
+		return f.now
+	}
+	return f
+}
+
+func dec(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+// account creates an active account holding the given BTC and USD
+func (f *exchangeFixture) account(t *testing.T, btc, usd string) string {
+	accountID := uuid.NewString()
+	assert.NoError(t, f.accounts.Save(&Account{AccountID: accountID, Email: accountID + "@example.com", Document: accountID, Status: AccountStatusActive}))
+	assert.NoError(t, f.balances.Credit(accountID, types.AssetIdBTC, dec(btc)))
+	assert.NoError(t, f.balances.Credit(accountID, types.AssetIdUSD, dec(usd)))
+	return accountID
+}
+
+// balance is the available balance of asset
+func (f *exchangeFixture) balance(accountID string, asset types.AssetId) string {
+	balance, _ := f.balances.Get(accountID, asset)
+	return balance.Available.String()
+}
+
+func (f *exchangeFixture) onHold(accountID string, asset types.AssetId) string {
+	balance, _ := f.balances.Get(accountID, asset)
+	return balance.OnHold.String()
+}
+
+func (f *exchangeFixture) limit(t *testing.T, accountID, side, quantity, price string) *Order {
+	order, _, err := f.exchange.Place(accountID, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: side, Type: OrderTypeLimit, Quantity: dec(quantity), Price: dec(price)})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	f.exchange.Flush()
+	return order
+}
+
+// asks rests sell orders of 1 BTC at 100, 1 BTC at 101 and 1 BTC at 110
+func (f *exchangeFixture) asks(t *testing.T) string {
+	maker := f.account(t, "3", "0")
+	f.limit(t, maker, OrderSideSell, "1", "100")
+	f.limit(t, maker, OrderSideSell, "1", "101")
+	f.limit(t, maker, OrderSideSell, "1", "110")
+	return maker
+}
+
+func TestPlaceOrderValidation(t *testing.T) {
+	f := newExchangeFixture(t)
+	accountID := f.account(t, "1", "1000")
+	testCases := []struct {
+		name           string
+		req            types.PlaceOrderRequest
+		expectedFields []string
+	}{
+		{"Unknown market", types.PlaceOrderRequest{MarketID: "ETH-USD", Side: "buy", Type: "limit", Quantity: dec("1"), Price: dec("100")}, []string{"marketId"}},
+		{"Invalid side", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "hold", Type: "limit", Quantity: dec("1"), Price: dec("100")}, []string{"side"}},
+		{"Invalid type", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "trailing_stop", Quantity: dec("1")}, []string{"type"}},
+		{"Limit without price", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "limit", Quantity: dec("1")}, []string{"price"}},
+		{"Price off tick", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "limit", Quantity: dec("1"), Price: dec("100.001")}, []string{"price"}},
+		{"Quantity off lot", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "limit", Quantity: dec("0.00015"), Price: dec("100")}, []string{"quantity"}},
+		{"Limit by quote quantity", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "limit", Quantity: dec("1"), Price: dec("100"), QuoteQuantity: dec("100")}, []string{"quoteQuantity"}},
+		{"Market with both quantities", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "market", Quantity: dec("1"), QuoteQuantity: dec("100")}, []string{"quoteQuantity"}},
+		{"Market without quantity", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "market"}, []string{"quoteQuantity"}},
+		{"Market with price", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "market", Quantity: dec("1"), Price: dec("100")}, []string{"price"}},
+		{"Slippage of 100%", types.PlaceOrderRequest{MarketID: "BTC-USD", Side: "buy", Type: "market", Quantity: dec("1"), MaxSlippage: dec("1")}, []string{"maxSlippage"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := f.exchange.Place(accountID, tc.req)
+			var validationErr *domainerrors.ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestLimitOrdersMatchByPriceThenTime(t *testing.T) {
+	f := newExchangeFixture(t)
+	first := f.account(t, "1", "0")
+	second := f.account(t, "1", "0")
+	cheaper := f.account(t, "1", "0")
+	firstOrder := f.limit(t, first, OrderSideSell, "1", "101")
+	secondOrder := f.limit(t, second, OrderSideSell, "1", "101")
+	f.limit(t, cheaper, OrderSideSell, "0.5", "100")
+	buyer := f.account(t, "0", "1000")
+
+	order, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("2"), Price: dec("105")})
+
+	assert.NoError(t, err)
+	if assert.Len(t, trades, 3) {
+		assert.Equal(t, "100", trades[0].Price.String())
+		assert.Equal(t, firstOrder.OrderID, trades[1].SellOrderID)
+		assert.Equal(t, secondOrder.OrderID, trades[2].SellOrderID)
+		assert.Equal(t, "0.5", trades[2].Quantity.String())
+	}
+	assert.Equal(t, OrderStatusFilled, order.Status)
+	assert.Equal(t, "100.75", order.FillPrice.String())
+	// Reserved 2 * 105, paid 0.5 * 100 + 1.5 * 101 and got the difference back
+	assert.Equal(t, "798.5", f.balance(buyer, types.AssetIdUSD))
+	assert.Equal(t, "2", f.balance(buyer, types.AssetIdBTC))
+	assert.Equal(t, "50.5", f.balance(second, types.AssetIdUSD))
+	resting, _ := f.orders.GetByID(secondOrder.OrderID)
+	assert.Equal(t, OrderStatusOpen, resting.Status)
+	assert.Equal(t, "0.5", resting.Remaining().String())
+}
+
+func TestLimitOrderRestsRemainderAndCancelReleasesIt(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+
+	order := f.limit(t, buyer, OrderSideBuy, "2", "100")
+	assert.Equal(t, OrderStatusOpen, order.Status)
+	assert.Equal(t, "1", order.FillQuantity.String())
+	assert.Equal(t, "800", f.balance(buyer, types.AssetIdUSD))
+
+	cancelled, err := f.exchange.Cancel(buyer, order.OrderID)
+	assert.NoError(t, err)
+	assert.Equal(t, OrderStatusCancelled, cancelled.Status)
+	assert.Equal(t, "900", f.balance(buyer, types.AssetIdUSD))
+	_, err = f.exchange.Cancel(buyer, order.OrderID)
+	assert.ErrorIs(t, err, domainerrors.ErrOrderNotOpen)
+	_, err = f.exchange.Cancel(f.account(t, "0", "0"), order.OrderID)
+	assert.ErrorIs(t, err, domainerrors.ErrOrderNotFound)
+}
+
+func TestMarketOrderSweepsTheBook(t *testing.T) {
+	f := newExchangeFixture(t)
+	maker := f.asks(t)
+	buyer := f.account(t, "0", "1000")
+
+	order, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("1.5")})
+
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	assert.Equal(t, OrderStatusFilled, order.Status)
+	assert.Equal(t, "1.5", order.FillQuantity.String())
+	assert.Equal(t, "849.5", f.balance(buyer, types.AssetIdUSD))
+	assert.Equal(t, "1.5", f.balance(buyer, types.AssetIdBTC))
+	assert.Equal(t, "150.5", f.balance(maker, types.AssetIdUSD))
+}
+
+func TestMarketOrderRejections(t *testing.T) {
+	testCases := []struct {
+		name        string
+		req         types.PlaceOrderRequest
+		expectedErr error
+	}{
+		{"Not enough liquidity", types.PlaceOrderRequest{Quantity: dec("3.5")}, domainerrors.ErrInsufficientLiquidity},
+		{"Max slippage", types.PlaceOrderRequest{Quantity: dec("2.5"), MaxSlippage: dec("0.05")}, domainerrors.ErrSlippageExceeded},
+		{"Worst price", types.PlaceOrderRequest{Quantity: dec("1.5"), WorstPrice: dec("100.5")}, domainerrors.ErrSlippageExceeded},
+		{"Tighter guard wins", types.PlaceOrderRequest{Quantity: dec("1.5"), MaxSlippage: dec("0.5"), WorstPrice: dec("100")}, domainerrors.ErrSlippageExceeded},
+		{"Quote below one lot", types.PlaceOrderRequest{QuoteQuantity: dec("0.005")}, domainerrors.ErrOrderTooSmall},
+		{"Insufficient funds", types.PlaceOrderRequest{Quantity: dec("3")}, domainerrors.ErrInsufficientFunds},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newExchangeFixture(t)
+			f.asks(t)
+			buyer := f.account(t, "0", "300")
+			tc.req.MarketID, tc.req.Side, tc.req.Type = "BTC-USD", OrderSideBuy, OrderTypeMarket
+
+			_, _, err := f.exchange.Place(buyer, tc.req)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, "300", f.balance(buyer, types.AssetIdUSD))
+			book, _ := f.orders.ListOpen("BTC-USD")
+			for _, resting := range book {
+				assert.True(t, resting.FillQuantity.IsZero())
+			}
+		})
+	}
+}
+
+func TestMarketOrderWithinSlippage(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+
+	order, _, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("2"), MaxSlippage: dec("0.01")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "100.5", order.FillPrice.String())
+}
+
+func TestMarketBuyByQuoteQuantity(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+
+	order, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, QuoteQuantity: dec("150")})
+
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	// 1 BTC for 100 USD, then the 50 USD left buy 0.4950 BTC at 101 in whole lots of 0.0001
+	assert.Equal(t, "1.495", order.Quantity.String())
+	assert.Equal(t, OrderStatusFilled, order.Status)
+	assert.Equal(t, "1.495", f.balance(buyer, types.AssetIdBTC))
+	assert.Equal(t, "850.005", f.balance(buyer, types.AssetIdUSD))
+}
+
+func TestMarketBuyByQuoteQuantityLeavesLessThanALot(t *testing.T) {
+	f := newExchangeFixture(t)
+	seller := f.account(t, "10", "0")
+	f.limit(t, seller, OrderSideSell, "10", "100")
+	buyer := f.account(t, "0", "1000")
+
+	order, _, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, QuoteQuantity: dec("150.005")})
+
+	// The 0.005 USD left do not buy a lot of 0.0001 BTC at 100
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5", order.Quantity.String())
+	assert.Equal(t, OrderStatusFilled, order.Status)
+	assert.Equal(t, "850", f.balance(buyer, types.AssetIdUSD))
+}
+
+func TestMarketSellByQuoteQuantity(t *testing.T) {
+	f := newExchangeFixture(t)
+	bidder := f.account(t, "0", "1000")
+	f.limit(t, bidder, OrderSideBuy, "1", "100")
+	f.limit(t, bidder, OrderSideBuy, "1", "90")
+	seller := f.account(t, "2", "0")
+
+	order, _, err := f.exchange.Place(seller, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeMarket, QuoteQuantity: dec("145")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5", order.Quantity.String())
+	assert.Equal(t, "145", f.balance(seller, types.AssetIdUSD))
+	assert.Equal(t, "0.5", f.balance(seller, types.AssetIdBTC))
+}
+
+func TestPlaceOrderRequiresActiveAccount(t *testing.T) {
+	f := newExchangeFixture(t)
+	accountID := f.account(t, "1", "1000")
+	assert.NoError(t, f.accounts.UpdateStatus(accountID, AccountStatusClosed))
+
+	_, _, err := f.exchange.Place(accountID, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("1"), Price: dec("100")})
+
+	assert.ErrorIs(t, err, domainerrors.ErrAccountClosed)
+}
+
+func TestTimeInForceValidation(t *testing.T) {
+	f := newExchangeFixture(t)
+	accountID := f.account(t, "1", "1000")
+	past := f.now.Add(-time.Hour)
+	future := f.now.Add(time.Hour)
+	testCases := []struct {
+		name           string
+		req            types.PlaceOrderRequest
+		expectedFields []string
+	}{
+		{"Unknown time in force", types.PlaceOrderRequest{TimeInForce: "DAY"}, []string{"timeInForce"}},
+		{"GTD without expiry", types.PlaceOrderRequest{TimeInForce: TimeInForceGTD}, []string{"expiresAt"}},
+		{"GTD in the past", types.PlaceOrderRequest{TimeInForce: TimeInForceGTD, ExpiresAt: &past}, []string{"expiresAt"}},
+		{"Expiry without GTD", types.PlaceOrderRequest{ExpiresAt: &future}, []string{"expiresAt"}},
+		{"Post-only IOC", types.PlaceOrderRequest{TimeInForce: TimeInForceIOC, PostOnly: true}, []string{"postOnly"}},
+		{"Post-only FOK", types.PlaceOrderRequest{TimeInForce: TimeInForceFOK, PostOnly: true}, []string{"postOnly"}},
+		{"Market IOC", types.PlaceOrderRequest{Type: OrderTypeMarket, TimeInForce: TimeInForceIOC}, []string{"timeInForce"}},
+		{"Market post-only", types.PlaceOrderRequest{Type: OrderTypeMarket, PostOnly: true}, []string{"postOnly"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.MarketID, tc.req.Side, tc.req.Quantity = "BTC-USD", OrderSideBuy, dec("1")
+			if tc.req.Type == "" {
+				tc.req.Type, tc.req.Price = OrderTypeLimit, dec("100")
+			}
+			_, _, err := f.exchange.Place(accountID, tc.req)
+			var validationErr *domainerrors.ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestImmediateOrCancelCancelsRemainder(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+
+	order, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("2"), Price: dec("100"), TimeInForce: TimeInForceIOC})
+
+	assert.NoError(t, err)
+	assert.Len(t, trades, 1)
+	assert.Equal(t, OrderStatusCancelled, order.Status)
+	assert.Equal(t, "1", order.FillQuantity.String())
+	assert.Equal(t, "900", f.balance(buyer, types.AssetIdUSD))
+	book, _ := f.orders.ListOpen("BTC-USD")
+	assert.Len(t, book, 2)
+}
+
+func TestFillOrKill(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	req := types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("2.5"), Price: dec("101"), TimeInForce: TimeInForceFOK}
+
+	_, _, err := f.exchange.Place(buyer, req)
+	assert.ErrorIs(t, err, domainerrors.ErrOrderNotFillable)
+	assert.Equal(t, "1000", f.balance(buyer, types.AssetIdUSD))
+	book, _ := f.orders.ListOpen("BTC-USD")
+	assert.Len(t, book, 3)
+
+	req.Quantity = dec("2")
+	order, trades, err := f.exchange.Place(buyer, req)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	assert.Equal(t, OrderStatusFilled, order.Status)
+	assert.Equal(t, "799", f.balance(buyer, types.AssetIdUSD))
+}
+
+func TestPostOnly(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	req := types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("1"), Price: dec("100"), PostOnly: true}
+
+	_, _, err := f.exchange.Place(buyer, req)
+	assert.ErrorIs(t, err, domainerrors.ErrPostOnlyWouldTake)
+	assert.Equal(t, "1000", f.balance(buyer, types.AssetIdUSD))
+
+	req.Price = dec("99.99")
+	order, trades, err := f.exchange.Place(buyer, req)
+	assert.NoError(t, err)
+	assert.Empty(t, trades)
+	assert.Equal(t, OrderStatusOpen, order.Status)
+	assert.Equal(t, "900.01", f.balance(buyer, types.AssetIdUSD))
+}
+
+func TestGoodTilDateExpires(t *testing.T) {
+	f := newExchangeFixture(t)
+	seller := f.account(t, "1", "0")
+	expiresAt := f.now.Add(time.Minute)
+	order, _, err := f.exchange.Place(seller, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeLimit, Quantity: dec("1"), Price: dec("100"), TimeInForce: TimeInForceGTD, ExpiresAt: &expiresAt})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", f.balance(seller, types.AssetIdBTC))
+
+	count, err := f.exchange.ExpireOrders()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	f.now = expiresAt
+	// Past its expiry the order no longer matches, even before it is swept
+	buyer := f.account(t, "0", "1000")
+	_, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("1"), Price: dec("100"), TimeInForce: TimeInForceIOC})
+	assert.NoError(t, err)
+	assert.Empty(t, trades)
+
+	count, err = f.exchange.ExpireOrders()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	expired, _ := f.orders.GetByID(order.OrderID)
+	assert.Equal(t, OrderStatusExpired, expired.Status)
+	assert.Equal(t, "1", f.balance(seller, types.AssetIdBTC))
+}
+
+func TestStopOrderValidation(t *testing.T) {
+	f := newExchangeFixture(t)
+	accountID := f.account(t, "1", "1000")
+	testCases := []struct {
+		name           string
+		req            types.PlaceOrderRequest
+		expectedFields []string
+	}{
+		{"Stop without stop price", types.PlaceOrderRequest{Type: OrderTypeStop, Side: OrderSideSell}, []string{"stopPrice"}},
+		{"Stop buy without worst price", types.PlaceOrderRequest{Type: OrderTypeStop, Side: OrderSideBuy, StopPrice: dec("110")}, []string{"worstPrice"}},
+		{"Stop with slippage", types.PlaceOrderRequest{Type: OrderTypeStop, Side: OrderSideSell, StopPrice: dec("90"), MaxSlippage: dec("0.1")}, []string{"maxSlippage"}},
+		{"Stop IOC", types.PlaceOrderRequest{Type: OrderTypeStop, Side: OrderSideSell, StopPrice: dec("90"), TimeInForce: TimeInForceIOC}, []string{"timeInForce"}},
+		{"Stop limit post-only", types.PlaceOrderRequest{Type: OrderTypeStopLimit, Side: OrderSideSell, StopPrice: dec("90"), Price: dec("89"), PostOnly: true}, []string{"postOnly"}},
+		{"Stop price off tick", types.PlaceOrderRequest{Type: OrderTypeStopLimit, Side: OrderSideSell, StopPrice: dec("90.005"), Price: dec("89")}, []string{"stopPrice"}},
+		{"Limit with stop price", types.PlaceOrderRequest{Type: OrderTypeLimit, Side: OrderSideSell, StopPrice: dec("90"), Price: dec("89")}, []string{"stopPrice"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.MarketID, tc.req.Quantity = "BTC-USD", dec("1")
+			_, _, err := f.exchange.Place(accountID, tc.req)
+			var validationErr *domainerrors.ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestStopOrderWaitsOffTheBookUntilTriggered(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	stopper := f.account(t, "0", "1000")
+	stop, trades, err := f.exchange.Place(stopper, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeStop, Quantity: dec("1"), StopPrice: dec("101"), WorstPrice: dec("105")})
+	assert.NoError(t, err)
+	assert.Empty(t, trades)
+	assert.Equal(t, OrderStatusPending, stop.Status)
+	assert.Equal(t, "895", f.balance(stopper, types.AssetIdUSD))
+
+	// A trade at 100 is below the stop price
+	buyer := f.account(t, "0", "1000")
+	f.limit(t, buyer, OrderSideBuy, "1", "100")
+	pending, _ := f.orders.GetByID(stop.OrderID)
+	assert.Equal(t, OrderStatusPending, pending.Status)
+
+	// A trade at 101 triggers it, it then buys the last ask at 110, past its worst price
+	f.limit(t, buyer, OrderSideBuy, "0.5", "101")
+	triggered, _ := f.orders.GetByID(stop.OrderID)
+	assert.NotNil(t, triggered.TriggeredAt)
+	assert.Equal(t, OrderStatusCancelled, triggered.Status)
+	assert.Equal(t, "1000", f.balance(stopper, types.AssetIdUSD))
+}
+
+func TestStopOrdersTriggerInTradeSequence(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	bidder := f.account(t, "0", "1000")
+	f.limit(t, bidder, OrderSideBuy, "1", "99")
+	f.limit(t, bidder, OrderSideBuy, "1", "95")
+	f.limit(t, bidder, OrderSideBuy, "1", "90")
+	first := f.account(t, "1", "0")
+	second := f.account(t, "1", "0")
+	firstStop, _, err := f.exchange.Place(first, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeStop, Quantity: dec("1"), StopPrice: dec("99")})
+	assert.NoError(t, err)
+	// Triggered by the trade of the first stop
+	secondStop, _, err := f.exchange.Place(second, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeStopLimit, Quantity: dec("1"), StopPrice: dec("95"), Price: dec("94")})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", f.balance(second, types.AssetIdBTC))
+
+	seller := f.account(t, "1", "0")
+	_, trades, err := f.exchange.Place(seller, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeMarket, Quantity: dec("1")})
+
+	assert.NoError(t, err)
+	if assert.Len(t, trades, 1) {
+		assert.Equal(t, "99", trades[0].Price.String())
+	}
+	filled, _ := f.orders.GetByID(firstStop.OrderID)
+	assert.Equal(t, OrderStatusFilled, filled.Status)
+	assert.Equal(t, "95", filled.FillPrice.String())
+	filled, _ = f.orders.GetByID(secondStop.OrderID)
+	assert.Equal(t, OrderStatusOpen, filled.Status)
+	assert.Equal(t, "94", filled.Price.String())
+	assert.Equal(t, "0", f.balance(second, types.AssetIdUSD))
+	// The 90 bid is below the stop limit, so the second stop rests as an ask
+	book, _ := f.orders.ListOpen("BTC-USD")
+	assert.Len(t, book, 5)
+}
+
+func TestStopOrderAlreadyReachedTriggersOnPlacement(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	f.limit(t, buyer, OrderSideBuy, "0.5", "100")
+
+	order, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeStopLimit, Quantity: dec("1"), StopPrice: dec("100"), Price: dec("101")})
+
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	assert.Equal(t, OrderStatusFilled, order.Status)
+	assert.Equal(t, "849.5", f.balance(buyer, types.AssetIdUSD))
+}
+
+func TestCancelPendingStopOrder(t *testing.T) {
+	f := newExchangeFixture(t)
+	seller := f.account(t, "2", "0")
+	stop, _, err := f.exchange.Place(seller, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeStopLimit, Quantity: dec("2"), StopPrice: dec("90"), Price: dec("89")})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", f.balance(seller, types.AssetIdBTC))
+
+	cancelled, err := f.exchange.Cancel(seller, stop.OrderID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, OrderStatusCancelled, cancelled.Status)
+	assert.Equal(t, "2", f.balance(seller, types.AssetIdBTC))
+}
+
+func TestOrdersHoldFundsUntilFilledOrCancelled(t *testing.T) {
+	f := newExchangeFixture(t)
+	seller := f.account(t, "2", "0")
+	buyer := f.account(t, "0", "1000")
+	sell := f.limit(t, seller, OrderSideSell, "2", "100")
+	assert.Equal(t, "0", f.balance(seller, types.AssetIdBTC))
+	assert.Equal(t, "2", f.onHold(seller, types.AssetIdBTC))
+
+	buy := f.limit(t, buyer, OrderSideBuy, "3", "105")
+
+	// The buy filled 2 at 100, paid from what it held, and still holds 1 at 105
+	assert.Equal(t, "0", f.onHold(seller, types.AssetIdBTC))
+	assert.Equal(t, "200", f.balance(seller, types.AssetIdUSD))
+	assert.Equal(t, "2", f.balance(buyer, types.AssetIdBTC))
+	assert.Equal(t, "695", f.balance(buyer, types.AssetIdUSD))
+	assert.Equal(t, "105", f.onHold(buyer, types.AssetIdUSD))
+	filled, _ := f.orders.GetByID(sell.OrderID)
+	assert.Equal(t, OrderStatusFilled, filled.Status)
+
+	_, err := f.exchange.Cancel(buyer, buy.OrderID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "800", f.balance(buyer, types.AssetIdUSD))
+	assert.Equal(t, "0", f.onHold(buyer, types.AssetIdUSD))
+}
+
+func TestOnHoldBalanceCannotGoNegative(t *testing.T) {
+	f := newExchangeFixture(t)
+	accountID := f.account(t, "1", "0")
+	assert.NoError(t, f.balances.Hold(accountID, types.AssetIdBTC, dec("0.5")))
+
+	assert.ErrorIs(t, f.balances.Release(accountID, types.AssetIdBTC, dec("0.6")), errOnHoldExceeded)
+	assert.ErrorIs(t, f.balances.Spend(accountID, types.AssetIdBTC, dec("0.6")), errOnHoldExceeded)
+	assert.ErrorIs(t, f.balances.Spend("00000000-0000-0000-0000-000000000000", types.AssetIdBTC, dec("0.1")), errOnHoldExceeded)
+	assert.Equal(t, "0.5", f.onHold(accountID, types.AssetIdBTC))
+	assert.Equal(t, "0.5", f.balance(accountID, types.AssetIdBTC))
+}
+
+// failingCredits fails every credit of one account
+type failingCredits struct {
+	IBalanceDAO
+	accountID string
+}
+
+func (b failingCredits) Credit(accountID string, asset types.AssetId, quantity decimal.Decimal) error {
+	if accountID == b.accountID {
+		return errors.New("credit failed")
+	}
+	return b.IBalanceDAO.Credit(accountID, asset, quantity)
+}
+
+type failingUnitOfWork struct {
+	IUnitOfWork
+	accountID string
+}
+
+func (w failingUnitOfWork) Run(fn func(tx ExchangeTx) error) error {
+	return w.IUnitOfWork.Run(func(tx ExchangeTx) error {
+		tx.Balances = failingCredits{tx.Balances, w.accountID}
+		return fn(tx)
+	})
+}
+
+type tradeRecorder struct {
+	trades []Trade
+}
+
+func (r *tradeRecorder) OnTrade(trade Trade) {
+	r.trades = append(r.trades, trade)
+}
+
+func TestFailedSettlementLeavesNoTrace(t *testing.T) {
+	f := newExchangeFixture(t)
+	seller := f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	recorder := &tradeRecorder{}
+	f.exchange.AddTradeListener(recorder)
+	f.exchange.work = failingUnitOfWork{f.exchange.work, seller}
+
+	// The seller is paid after the buyer got its bitcoin, and that fails
+	_, _, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("2"), Price: dec("101")})
+
+	assert.EqualError(t, err, "credit failed")
+	assert.Equal(t, "1000", f.balance(buyer, types.AssetIdUSD))
+	assert.Equal(t, "0", f.onHold(buyer, types.AssetIdUSD))
+	assert.Equal(t, "0", f.balance(buyer, types.AssetIdBTC))
+	assert.Equal(t, "3", f.onHold(seller, types.AssetIdBTC))
+	assert.Equal(t, "0", f.balance(seller, types.AssetIdUSD))
+	orders, _ := f.orders.ListByAccount(buyer)
+	assert.Empty(t, orders)
+	resting, _ := f.orders.ListOpen("BTC-USD")
+	assert.Len(t, resting, 3)
+	for _, order := range resting {
+		assert.True(t, order.FillQuantity.IsZero())
+	}
+	last, _ := f.exchange.trades.Last("BTC-USD")
+	assert.Nil(t, last)
+	assert.Empty(t, recorder.trades)
+}
+
+// lockProbe records whether the book was unlocked when it was told about a change
+type lockProbe struct {
+	exchange *Exchange
+	unlocked []bool
+}
+
+func (p *lockProbe) OnBookChange(change BookChange) {
+	unlocked := p.exchange.mu.TryLock()
+	if unlocked {
+		p.exchange.mu.Unlock()
+	}
+	p.unlocked = append(p.unlocked, unlocked)
+}
+
+func TestListenersAreNotifiedOutsideTheBookLock(t *testing.T) {
+	f := newExchangeFixture(t)
+	probe := &lockProbe{exchange: f.exchange}
+	f.exchange.AddBookListener(probe)
+
+	f.asks(t)
+
+	assert.Equal(t, []bool{true, true, true}, probe.unlocked)
+}
+
+// blockingListener holds every notification until release is closed
+type blockingListener struct {
+	release chan struct{}
+	changes atomic.Int32
+}
+
+func (l *blockingListener) OnBookChange(change BookChange) {
+	<-l.release
+	l.changes.Add(1)
+}
+
+func TestSlowListenersDoNotHoldUpOrders(t *testing.T) {
+	f := newExchangeFixture(t)
+	listener := &blockingListener{release: make(chan struct{})}
+	f.exchange.AddBookListener(listener)
+	seller := f.account(t, "2", "0")
+
+	for _, price := range []string{"100", "101"} {
+		_, _, err := f.exchange.Place(seller, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideSell, Type: OrderTypeLimit, Quantity: dec("1"), Price: dec(price)})
+		assert.NoError(t, err)
+	}
+	assert.Zero(t, listener.changes.Load())
+
+	close(listener.release)
+	f.exchange.Flush()
+	assert.Equal(t, int32(2), listener.changes.Load())
+}
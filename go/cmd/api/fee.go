@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// FeeTier applies to accounts that traded at least MinVolume of the quote asset
+// in the volume window
+type FeeTier struct {
+	MinVolume decimal.Decimal
+	MakerRate decimal.Decimal
+	TakerRate decimal.Decimal
+}
+
+// FeeSchedule is the tiers of a market, by ascending MinVolume
+type FeeSchedule []FeeTier
+
+var DefaultFeeSchedules = map[string]FeeSchedule{
+	"BTC-USD": {
+		{MinVolume: decimal.Zero, MakerRate: decimal.RequireFromString("0.001"), TakerRate: decimal.RequireFromString("0.002")},
+		{MinVolume: decimal.NewFromInt(100000), MakerRate: decimal.RequireFromString("0.0008"), TakerRate: decimal.RequireFromString("0.0016")},
+		{MinVolume: decimal.NewFromInt(1000000), MakerRate: decimal.RequireFromString("0.0005"), TakerRate: decimal.RequireFromString("0.001")},
+	},
+}
+
+// DefaultFeeAccountID is the house account fees are credited to unless FEE_ACCOUNT_ID says otherwise
+const DefaultFeeAccountID = "00000000-0000-0000-0000-000000000000"
+
+// NewFeeSchedulesFromEnv reads FEE_TIERS as comma separated MARKET:MIN_VOLUME:MAKER:TAKER
+// entries, e.g. "BTC-USD:0:0.001:0.002,BTC-USD:50000:0.0005:0.001". A market listed
+// there gets exactly the listed tiers, the others keep the defaults.
+func NewFeeSchedulesFromEnv() map[string]FeeSchedule {
+	configured := make(map[string]FeeSchedule)
+	for _, entry := range strings.Split(os.Getenv("FEE_TIERS"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		tier, marketID, ok := parseFeeTier(entry)
+		if !ok {
+			logrus.WithField("entry", entry).Warn("Ignoring invalid fee tier")
+			continue
+		}
+		configured[marketID] = append(configured[marketID], tier)
+	}
+	schedules := make(map[string]FeeSchedule)
+	for marketID, schedule := range DefaultFeeSchedules {
+		schedules[marketID] = schedule
+	}
+	for marketID, schedule := range configured {
+		slices.SortFunc(schedule, func(a, b FeeTier) int { return a.MinVolume.Cmp(b.MinVolume) })
+		schedules[marketID] = schedule
+	}
+	return schedules
+}
+
+func parseFeeTier(entry string) (FeeTier, string, bool) {
+	fields := strings.Split(strings.TrimSpace(entry), ":")
+	if len(fields) != 4 {
+		return FeeTier{}, "", false
+	}
+	values := make([]decimal.Decimal, 3)
+	for i, field := range fields[1:] {
+		value, err := decimal.NewFromString(strings.TrimSpace(field))
+		if err != nil || value.IsNegative() || (i > 0 && value.GreaterThanOrEqual(decimal.NewFromInt(1))) {
+			return FeeTier{}, "", false
+		}
+		values[i] = value
+	}
+	return FeeTier{MinVolume: values[0], MakerRate: values[1], TakerRate: values[2]}, strings.ToUpper(strings.TrimSpace(fields[0])), true
+}
+
+// FeeEngine prices the two sides of a trade, picking each account's tier by its
+// volume in the market over the last VolumeWindow
+type FeeEngine struct {
+	trades ITradeDAO
+
+	Schedules map[string]FeeSchedule
+	// AccountID is the house account that receives the fees
+	AccountID    string
+	VolumeWindow time.Duration
+}
+
+func NewFeeEngine(trades ITradeDAO) *FeeEngine {
+	return &FeeEngine{
+		trades:       trades,
+		Schedules:    DefaultFeeSchedules,
+		AccountID:    DefaultFeeAccountID,
+		VolumeWindow: 30 * 24 * time.Hour,
+	}
+}
+
+// NewFeeAccountIDFromEnv reads FEE_ACCOUNT_ID, DefaultFeeAccountID when unset
+func NewFeeAccountIDFromEnv() string {
+	if accountID := strings.TrimSpace(os.Getenv("FEE_ACCOUNT_ID")); isValidUUID(accountID) {
+		return accountID
+	}
+	return DefaultFeeAccountID
+}
+
+// Rate is what accountID pays on a trade in marketID, as a fraction of what it receives.
+// Markets without a schedule trade for free.
+func (f *FeeEngine) Rate(accountID, marketID string, maker bool, now time.Time) (decimal.Decimal, error) {
+	return f.rate(f.trades, accountID, marketID, maker, now)
+}
+
+// rate is Rate with the volume read from trades, the DAO of a transaction counts what it settled so far
+func (f *FeeEngine) rate(trades ITradeDAO, accountID, marketID string, maker bool, now time.Time) (decimal.Decimal, error) {
+	schedule := f.Schedules[marketID]
+	if len(schedule) == 0 {
+		return decimal.Zero, nil
+	}
+	volume, err := trades.VolumeSince(accountID, marketID, now.Add(-f.VolumeWindow))
+	if err != nil {
+		return decimal.Zero, err
+	}
+	tier := schedule[0]
+	for _, candidate := range schedule[1:] {
+		if volume.GreaterThanOrEqual(candidate.MinVolume) {
+			tier = candidate
+		}
+	}
+	if maker {
+		return tier.MakerRate, nil
+	}
+	return tier.TakerRate, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTradesPayMakerAndTakerFees(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.exchange.Fees.Schedules = map[string]FeeSchedule{"BTC-USD": {{MinVolume: dec("0"), MakerRate: dec("0.001"), TakerRate: dec("0.002")}}}
+	seller := f.account(t, "1", "0")
+	buyer := f.account(t, "0", "1000")
+	sell := f.limit(t, seller, OrderSideSell, "1", "100")
+
+	buy, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeLimit, Quantity: dec("1"), Price: dec("100")})
+
+	assert.NoError(t, err)
+	if assert.Len(t, trades, 1) {
+		assert.Equal(t, "0.1", trades[0].MakerFee.String())
+		assert.Equal(t, types.AssetIdUSD, trades[0].MakerFeeAsset)
+		assert.Equal(t, "0.002", trades[0].TakerFee.String())
+		assert.Equal(t, types.AssetIdBTC, trades[0].TakerFeeAsset)
+		fee, asset, maker := trades[0].feeOf(sell.Side)
+		assert.Equal(t, "0.1", fee.String())
+		assert.Equal(t, types.AssetIdUSD, asset)
+		assert.True(t, maker)
+		_, _, maker = trades[0].feeOf(buy.Side)
+		assert.False(t, maker)
+	}
+	assert.Equal(t, "0.998", f.balance(buyer, types.AssetIdBTC))
+	assert.Equal(t, "900", f.balance(buyer, types.AssetIdUSD))
+	assert.Equal(t, "99.9", f.balance(seller, types.AssetIdUSD))
+	assert.Equal(t, "0.002", f.balance(DefaultFeeAccountID, types.AssetIdBTC))
+	assert.Equal(t, "0.1", f.balance(DefaultFeeAccountID, types.AssetIdUSD))
+}
+
+func TestFeeTierFollowsRollingVolume(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.exchange.Fees.Schedules = map[string]FeeSchedule{"BTC-USD": {
+		{MinVolume: dec("0"), MakerRate: dec("0.001"), TakerRate: dec("0.002")},
+		{MinVolume: dec("200"), MakerRate: dec("0"), TakerRate: dec("0.001")},
+	}}
+	seller := f.account(t, "10", "0")
+	buyer := f.account(t, "0", "10000")
+	trade := func() Trade {
+		f.limit(t, seller, OrderSideSell, "1", "100")
+		_, trades, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("1")})
+		if !assert.NoError(t, err) || !assert.Len(t, trades, 1) {
+			t.FailNow()
+		}
+		return trades[0]
+	}
+
+	assert.Equal(t, "0.002", trade().TakerFee.String())
+	assert.Equal(t, "0.002", trade().TakerFee.String())
+	// 200 USD traded in the window reaches the second tier for both sides
+	third := trade()
+	assert.Equal(t, "0.001", third.TakerFee.String())
+	assert.Equal(t, "0", third.MakerFee.String())
+
+	// Past the window the volume starts over
+	f.now = f.now.Add(31 * 24 * time.Hour)
+	assert.Equal(t, "0.002", trade().TakerFee.String())
+}
+
+func TestNewFeeSchedulesFromEnv(t *testing.T) {
+	t.Setenv("FEE_TIERS", "btc-usd:50000:0.0005:0.001, BTC-USD:0:0.001:0.002,ETH-USD:0:2:0.1,broken")
+
+	schedules := NewFeeSchedulesFromEnv()
+
+	if assert.Len(t, schedules["BTC-USD"], 2) {
+		assert.Equal(t, "0", schedules["BTC-USD"][0].MinVolume.String())
+		assert.Equal(t, "0.002", schedules["BTC-USD"][0].TakerRate.String())
+		assert.Equal(t, "50000", schedules["BTC-USD"][1].MinVolume.String())
+		assert.Equal(t, "0.0005", schedules["BTC-USD"][1].MakerRate.String())
+	}
+	assert.NotContains(t, schedules, "ETH-USD")
+}
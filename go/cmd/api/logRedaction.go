@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactionMode controls how sensitive log fields are masked
+type RedactionMode string
+
+const (
+	RedactionModePartial RedactionMode = "partial"
+	RedactionModeFull    RedactionMode = "full"
+	RedactionModeOff     RedactionMode = "off"
+)
+
+const redactedValue = "[REDACTED]"
+
+// MaskFunc turns a raw field value into its masked representation
+type MaskFunc func(value string) string
+
+// RedactionHook is a logrus hook that masks sensitive fields before the entry is formatted
+type RedactionHook struct {
+	Mode   RedactionMode
+	Fields map[string]MaskFunc
+}
+
+// NewRedactionHook returns a hook with the default sensitive fields and masking rules
+func NewRedactionHook(mode RedactionMode) *RedactionHook {
+	return &RedactionHook{
+		Mode: mode,
+		Fields: map[string]MaskFunc{
+			"email":         MaskEmail,
+			"name":          MaskName,
+			"document":      MaskDocument,
+			"cpf":           MaskDocument,
+			"accountid":     MaskIdentifier,
+			"password":      MaskSecret,
+			"authorization": MaskSecret,
+			"token":         MaskSecret,
+			"accesstoken":   MaskSecret,
+			"refreshtoken":  MaskSecret,
+			"apikey":        MaskSecret,
+			"secret":        MaskSecret,
+		},
+	}
+}
+
+// NewRedactionHookFromEnv builds a hook configured through LOG_REDACTION (partial, full or off)
+// and LOG_REDACT_FIELDS (comma separated list of extra fields to mask completely)
+func NewRedactionHookFromEnv() *RedactionHook {
+	mode := RedactionMode(strings.ToLower(os.Getenv("LOG_REDACTION")))
+	switch mode {
+	case RedactionModeFull, RedactionModeOff:
+	default:
+		mode = RedactionModePartial
+	}
+	hook := NewRedactionHook(mode)
+	for _, field := range strings.Split(os.Getenv("LOG_REDACT_FIELDS"), ",") {
+		if key := normalizeFieldKey(field); key != "" {
+			hook.Fields[key] = MaskSecret
+		}
+	}
+	return hook
+}
+
+func (h *RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *RedactionHook) Fire(entry *logrus.Entry) error {
+	if h.Mode == RedactionModeOff {
+		return nil
+	}
+	for key, value := range entry.Data {
+		mask, sensitive := h.maskFor(key)
+		if !sensitive {
+			continue
+		}
+		if h.Mode == RedactionModeFull {
+			entry.Data[key] = redactedValue
+			continue
+		}
+		entry.Data[key] = mask(stringValue(value))
+	}
+	return nil
+}
+
+func (h *RedactionHook) maskFor(key string) (MaskFunc, bool) {
+	normalized := normalizeFieldKey(key)
+	if mask, ok := h.Fields[normalized]; ok {
+		return mask, true
+	}
+	// Catch variations such as reset_token or newPassword
+	for _, suffix := range []string{"token", "password", "secret"} {
+		if strings.HasSuffix(normalized, suffix) {
+			return MaskSecret, true
+		}
+	}
+	return nil, false
+}
+
+func normalizeFieldKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	return strings.NewReplacer("_", "", "-", "").Replace(key)
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case interface{ String() string }:
+		return v.String()
+	default:
+		return redactedValue
+	}
+}
+
+// MaskEmail keeps the first character of the local part and the domain: g***@example.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return MaskSecret(email)
+	}
+	first, _ := utf8.DecodeRuneInString(email)
+	return string(first) + "***" + email[at:]
+}
+
+// MaskDocument keeps only the last two digits of the document
+func MaskDocument(document string) string {
+	return maskKeepLast(document, 2)
+}
+
+// MaskIdentifier keeps the last four characters so log lines can still be correlated
+func MaskIdentifier(id string) string {
+	return maskKeepLast(id, 4)
+}
+
+// MaskName keeps the first letter of each part of the name: G*** B***
+func MaskName(name string) string {
+	parts := strings.Fields(name)
+	for i, part := range parts {
+		parts[i] = string([]rune(part)[:1]) + "***"
+	}
+	return strings.Join(parts, " ")
+}
+
+// MaskSecret never reveals any part of the value
+func MaskSecret(string) string {
+	return redactedValue
+}
+
+func maskKeepLast(value string, keep int) string {
+	runes := []rune(value)
+	if len(runes) <= keep {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedactedLogger(mode RedactionMode) (*logrus.Logger, *bytes.Buffer) {
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&output)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(NewRedactionHook(mode))
+	return logger, &output
+}
+
+func TestRedactionHookRemovesRawPII(t *testing.T) {
+	accountID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	rawValues := map[string]interface{}{
+		"email":         "gustavo@example.com",
+		"name":          "Gustavo Brunetto",
+		"document":      "11144477735",
+		"password":      "SecurePassword1234",
+		"authorization": "Bearer abc.def.ghi",
+		"reset_token":   "0f9a8b7c6d5e",
+		"accountId":     accountID,
+	}
+	for _, mode := range []RedactionMode{RedactionModePartial, RedactionModeFull} {
+		t.Run(string(mode), func(t *testing.T) {
+			logger, output := newRedactedLogger(mode)
+			logger.WithFields(rawValues).Info("Processing signup")
+			for field, value := range rawValues {
+				assert.NotContains(t, output.String(), stringValue(value), "raw %s leaked to log output", field)
+			}
+		})
+	}
+}
+
+func TestRedactionHookPartialMasks(t *testing.T) {
+	logger, output := newRedactedLogger(RedactionModePartial)
+	logger.WithFields(logrus.Fields{
+		"email":    "gustavo@example.com",
+		"document": "111.444.777-35",
+		"password": "SecurePassword1234",
+		"assetId":  "BTC",
+	}).Info("Processing")
+	assert.Contains(t, output.String(), `"email":"g***@example.com"`)
+	assert.Contains(t, output.String(), `"document":"************35"`)
+	assert.Contains(t, output.String(), `"password":"[REDACTED]"`)
+	assert.Contains(t, output.String(), `"assetId":"BTC"`)
+}
+
+func TestRedactionHookOff(t *testing.T) {
+	logger, output := newRedactedLogger(RedactionModeOff)
+	logger.WithField("email", "gustavo@example.com").Info("Processing")
+	assert.Contains(t, output.String(), "gustavo@example.com")
+}
+
+func TestRedactionHookFromEnv(t *testing.T) {
+	t.Setenv("LOG_REDACTION", "FULL")
+	t.Setenv("LOG_REDACT_FIELDS", "phone, birth_date")
+	hook := NewRedactionHookFromEnv()
+	assert.Equal(t, RedactionModeFull, hook.Mode)
+	assert.Contains(t, hook.Fields, "phone")
+	assert.Contains(t, hook.Fields, "birthdate")
+
+	t.Setenv("LOG_REDACTION", "unknown")
+	assert.Equal(t, RedactionModePartial, NewRedactionHookFromEnv().Mode)
+}
+
+func TestMaskFunctions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mask     MaskFunc
+		input    string
+		expected string
+	}{
+		{"Email", MaskEmail, "gustavo@example.com", "g***@example.com"},
+		{"Email starting with an accent", MaskEmail, "élise@exemple.fr", "é***@exemple.fr"},
+		{"Email without at", MaskEmail, "gustavo", redactedValue},
+		{"Document", MaskDocument, "11144477735", "*********35"},
+		{"Short document", MaskDocument, "35", "**"},
+		{"Identifier", MaskIdentifier, "550e8400-e29b-41d4-a716-446655440000", "********************************0000"},
+		{"Name", MaskName, "  Gustavo   Brunetto ", "G*** B***"},
+		{"Accented name", MaskName, "Élise Doe", "É*** D***"},
+		{"Secret", MaskSecret, "SecurePassword1234", redactedValue},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.mask(tc.input))
+		})
+	}
+}
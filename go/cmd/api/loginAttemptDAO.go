@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// LoginAttempts counts the recent failed logins of a key such as "email:<address>" or "ip:<address>"
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// ILoginAttemptDAO defines the interface for failed login tracking, shared by every replica
+type ILoginAttemptDAO interface {
+	Get(key string) (*LoginAttempts, error)
+	// RecordFailure atomically adds a failure and returns the new count, starting
+	// over when the previous failure is older than window
+	RecordFailure(key string, at time.Time, window time.Duration) (int, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+// LoginAttemptDAODatabase implements ILoginAttemptDAO using PostgreSQL database
+type LoginAttemptDAODatabase struct {
+	db *Database
+}
+
+func NewLoginAttemptDAODatabase(db *Database) *LoginAttemptDAODatabase {
+	return &LoginAttemptDAODatabase{db: db}
+}
+
+func (dao *LoginAttemptDAODatabase) Get(key string) (*LoginAttempts, error) {
+	query := "SELECT key, failures, last_failure_at, locked_until FROM ccca.login_attempt WHERE key = $1"
+	attempts := &LoginAttempts{}
+	var lockedUntil sql.NullTime
+	err := dao.db.DB.QueryRow(query, key).Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempts.LockedUntil = &lockedUntil.Time
+	}
+	return attempts, nil
+}
+
+func (dao *LoginAttemptDAODatabase) RecordFailure(key string, at time.Time, window time.Duration) (int, error) {
+	query := `INSERT INTO ccca.login_attempt (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN ccca.login_attempt.last_failure_at < $3 THEN 1 ELSE ccca.login_attempt.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`
+	var failures int
+	err := dao.db.DB.QueryRow(query, key, at, at.Add(-window)).Scan(&failures)
+	return failures, err
+}
+
+func (dao *LoginAttemptDAODatabase) Lock(key string, until time.Time) error {
+	_, err := dao.db.DB.Exec("UPDATE ccca.login_attempt SET locked_until = $1 WHERE key = $2", until, key)
+	return err
+}
+
+func (dao *LoginAttemptDAODatabase) Reset(key string) error {
+	_, err := dao.db.DB.Exec("DELETE FROM ccca.login_attempt WHERE key = $1", key)
+	return err
+}
+
+// LoginAttemptDAOMemory implements ILoginAttemptDAO using in-memory storage
+type LoginAttemptDAOMemory struct {
+	mu       sync.Mutex
+	attempts map[string]*LoginAttempts
+}
+
+func NewLoginAttemptDAOMemory() *LoginAttemptDAOMemory {
+	return &LoginAttemptDAOMemory{
+		attempts: make(map[string]*LoginAttempts),
+	}
+}
+
+func (dao *LoginAttemptDAOMemory) Get(key string) (*LoginAttempts, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	attempts, exists := dao.attempts[key]
+	if !exists {
+		return nil, nil
+	}
+	copied := *attempts
+	return &copied, nil
+}
+
+func (dao *LoginAttemptDAOMemory) RecordFailure(key string, at time.Time, window time.Duration) (int, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	attempts, exists := dao.attempts[key]
+	if !exists {
+		attempts = &LoginAttempts{Key: key}
+		dao.attempts[key] = attempts
+	}
+	if attempts.LastFailureAt.Before(at.Add(-window)) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = at
+	return attempts.Failures, nil
+}
+
+func (dao *LoginAttemptDAOMemory) Lock(key string, until time.Time) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	if attempts, exists := dao.attempts[key]; exists {
+		attempts.LockedUntil = &until
+	}
+	return nil
+}
+
+func (dao *LoginAttemptDAOMemory) Reset(key string) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	delete(dao.attempts, key)
+	return nil
+}
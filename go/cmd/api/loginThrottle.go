@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/sirupsen/logrus"
+)
+
+// LoginThrottlePolicy holds the limits applied to failed logins, per email and per client IP
+type LoginThrottlePolicy struct {
+	// FreeAttempts failures are allowed before delays start doubling from BaseDelay up to MaxDelay
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// LockoutThreshold failures lock the email for LockoutDuration and mail an unlock link
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// IPLockoutThreshold failures from one IP, across any emails, lock that IP
+	IPLockoutThreshold int
+	// Failures older than FailureWindow are forgotten
+	FailureWindow time.Duration
+}
+
+var DefaultLoginThrottlePolicy = LoginThrottlePolicy{
+	FreeAttempts:       3,
+	BaseDelay:          time.Second,
+	MaxDelay:           5 * time.Minute,
+	LockoutThreshold:   10,
+	LockoutDuration:    time.Hour,
+	IPLockoutThreshold: 100,
+	FailureWindow:      24 * time.Hour,
+}
+
+// NewLoginThrottlePolicyFromEnv reads LOGIN_FREE_ATTEMPTS, LOGIN_LOCKOUT_THRESHOLD,
+// LOGIN_LOCKOUT_DURATION (e.g. "30m") and LOGIN_IP_LOCKOUT_THRESHOLD, keeping the
+// defaults for unset or invalid values
+func NewLoginThrottlePolicyFromEnv() LoginThrottlePolicy {
+	policy := DefaultLoginThrottlePolicy
+	if value, err := strconv.Atoi(os.Getenv("LOGIN_FREE_ATTEMPTS")); err == nil && value >= 0 {
+		policy.FreeAttempts = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD")); err == nil && value > policy.FreeAttempts {
+		policy.LockoutThreshold = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && value > 0 {
+		policy.LockoutDuration = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("LOGIN_IP_LOCKOUT_THRESHOLD")); err == nil && value > 0 {
+		policy.IPLockoutThreshold = value
+	}
+	return policy
+}
+
+// backoff returns how long logins stay blocked after the given number of failures
+func (p LoginThrottlePolicy) backoff(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// LoginThrottle slows down and locks out repeated failed logins
+type LoginThrottle struct {
+	accounts IAccountDAO
+	attempts ILoginAttemptDAO
+	audit    IAuditLog
+	tokens   IAccountTokenDAO
+	mailer   mailer.Mailer
+	signer   *TokenSigner
+
+	Policy    LoginThrottlePolicy
+	Now       func() time.Time
+	UnlockURL string
+}
+
+func NewLoginThrottle(accounts IAccountDAO, attempts ILoginAttemptDAO, audit IAuditLog, tokens IAccountTokenDAO, m mailer.Mailer, signer *TokenSigner) *LoginThrottle {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+	return &LoginThrottle{
+		accounts:  accounts,
+		attempts:  attempts,
+		audit:     audit,
+		tokens:    tokens,
+		mailer:    m,
+		signer:    signer,
+		Policy:    DefaultLoginThrottlePolicy,
+		Now:       time.Now,
+		UnlockURL: baseURL + "/login/unlock",
+	}
+}
+
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check rejects the attempt while the email or the IP is locked
+func (t *LoginThrottle) Check(email, ip string) error {
+	now := t.Now()
+	for _, key := range []string{emailThrottleKey(email), ipThrottleKey(ip)} {
+		attempts, err := t.attempts.Get(key)
+		if err != nil {
+			return err
+		}
+		if attempts != nil && attempts.LockedUntil != nil && now.Before(*attempts.LockedUntil) {
+			return domainerrors.ErrLoginLocked
+		}
+	}
+	return nil
+}
+
+// Failure records a failed attempt. account is nil for unknown emails, which are
+// throttled the same way so responses do not reveal which emails exist.
+func (t *LoginThrottle) Failure(email, ip string, account *Account) error {
+	now := t.Now()
+	key := emailThrottleKey(email)
+	failures, err := t.attempts.RecordFailure(key, now, t.Policy.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if failures >= t.Policy.LockoutThreshold {
+		if err := t.attempts.Lock(key, now.Add(t.Policy.LockoutDuration)); err != nil {
+			return err
+		}
+		t.lockedOut(email, ip, account, failures)
+	} else if delay := t.Policy.backoff(failures); delay > 0 {
+		if err := t.attempts.Lock(key, now.Add(delay)); err != nil {
+			return err
+		}
+	}
+
+	ipFailures, err := t.attempts.RecordFailure(ipThrottleKey(ip), now, t.Policy.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if ipFailures >= t.Policy.IPLockoutThreshold {
+		if err := t.attempts.Lock(ipThrottleKey(ip), now.Add(t.Policy.LockoutDuration)); err != nil {
+			return err
+		}
+		t.record(&AuditEvent{Type: AuditLoginIPLocked, IP: ip, Detail: fmt.Sprintf("%d failed logins", ipFailures)})
+	}
+	return nil
+}
+
+// Success forgets the failures of the email. The IP keeps its count, otherwise one
+// valid account would let an attacker reset the limit for every other email.
+func (t *LoginThrottle) Success(email string) error {
+	return t.attempts.Reset(emailThrottleKey(email))
+}
+
+func (t *LoginThrottle) lockedOut(email, ip string, account *Account, failures int) {
+	event := &AuditEvent{Type: AuditLoginLocked, IP: ip, Detail: fmt.Sprintf("%d failed logins for %s", failures, MaskEmail(email))}
+	if account == nil {
+		t.record(event)
+		return
+	}
+	event.AccountID = account.AccountID
+	t.record(event)
+	if err := t.sendUnlockEmail(account); err != nil {
+		logrus.WithError(err).WithField("accountId", account.AccountID).Error("Failed to send unlock email")
+	}
+}
+
+// record never fails the login, a lost audit event is logged instead
+func (t *LoginThrottle) record(event *AuditEvent) {
+	event.OccurredAt = t.Now()
+	logrus.WithFields(logrus.Fields{
+		"type":      event.Type,
+		"accountId": event.AccountID,
+		"ip":        event.IP,
+	}).Warn("Recording audit event")
+	if err := t.audit.Record(event); err != nil {
+		logrus.WithError(err).WithField("type", event.Type).Error("Failed to record audit event")
+	}
+}
+
+func (t *LoginThrottle) sendUnlockEmail(account *Account) error {
+	now := t.Now()
+	token, claims := t.signer.Sign(TokenPurposeAccountUnlock, account.AccountID, now.Add(t.Policy.LockoutDuration))
+	err := t.tokens.Save(&AccountToken{
+		TokenID:   claims.ID,
+		AccountID: account.AccountID,
+		Purpose:   TokenPurposeAccountUnlock,
+		CreatedAt: now,
+		ExpiresAt: claims.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	link := t.UnlockURL + "?token=" + url.QueryEscape(token)
+	return t.mailer.Send(context.Background(), mailer.Message{
+		To:      account.Email,
+		Subject: "Your account login was locked",
+		Body:    fmt.Sprintf("Hello %s,\n\nWe locked logins to your account after several failed attempts. If it was you, unlock it now:\n\n%s\n\nOtherwise consider changing your password. The lock ends by itself in %s.\n", account.Name, link, t.Policy.LockoutDuration),
+	})
+}
+
+// Unlock consumes a token from the lockout email and clears the failures of the account
+func (t *LoginThrottle) Unlock(token string) (*Account, error) {
+	claims, err := t.signer.Verify(TokenPurposeAccountUnlock, token, t.Now())
+	if err != nil {
+		return nil, err
+	}
+	stored, err := t.tokens.GetByID(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.AccountID != claims.Subject || stored.Purpose != TokenPurposeAccountUnlock {
+		return nil, domainerrors.ErrInvalidToken
+	}
+	account, err := t.accounts.GetByID(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, domainerrors.ErrInvalidToken
+	}
+	consumed, err := t.tokens.MarkUsed(claims.ID, t.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, domainerrors.ErrTokenAlreadyUsed
+	}
+	if err := t.attempts.Reset(emailThrottleKey(account.Email)); err != nil {
+		return nil, err
+	}
+	t.record(&AuditEvent{Type: AuditLoginUnlocked, AccountID: account.AccountID, Detail: "unlocked by email"})
+	return account, nil
+}
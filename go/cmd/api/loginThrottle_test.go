@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+type loginThrottleFixture struct {
+	sessions *SessionService
+	throttle *LoginThrottle
+	audit    *AuditLogMemory
+	mailer   *mailer.MemoryMailer
+	now      *time.Time
+}
+
+func newLoginThrottleFixture(t *testing.T) *loginThrottleFixture {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	sessions, accounts, now := newSessionFixture(t, hash)
+	f := &loginThrottleFixture{
+		sessions: sessions,
+		audit:    NewAuditLogMemory(),
+		mailer:   &mailer.MemoryMailer{},
+		now:      now,
+	}
+	f.throttle = NewLoginThrottle(accounts, NewLoginAttemptDAOMemory(), f.audit, NewAccountTokenDAOMemory(), f.mailer, NewTokenSigner([]byte("secret")))
+	f.throttle.UnlockURL = "http://localhost:3000/login/unlock"
+	f.throttle.Now = func() time.Time { return *now }
+	f.throttle.Policy = LoginThrottlePolicy{
+		FreeAttempts:       2,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Minute,
+		LockoutThreshold:   5,
+		LockoutDuration:    time.Hour,
+		IPLockoutThreshold: 8,
+		FailureWindow:      24 * time.Hour,
+	}
+	sessions.Throttle = f.throttle
+	return f
+}
+
+// fail makes a wrong login from ip and waits until any backoff delay has passed
+func (f *loginThrottleFixture) fail(t *testing.T, email, ip string) {
+	_, _, err := f.sessions.Login(Credentials{Email: email, Password: "wrong", IP: ip})
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidCredentials)
+	*f.now = f.now.Add(f.throttle.Policy.MaxDelay)
+}
+
+func (f *loginThrottleFixture) unlockToken(t *testing.T) string {
+	messages := f.mailer.Messages("gustavo@example.com")
+	if !assert.NotEmpty(t, messages) {
+		t.FailNow()
+	}
+	body := messages[len(messages)-1].Body
+	link := strings.Fields(body[strings.Index(body, f.throttle.UnlockURL):])[0]
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	return parsed.Query().Get("token")
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	policy := LoginThrottlePolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 5 * time.Second},
+		{50, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, policy.backoff(tt.failures), "failures=%d", tt.failures)
+	}
+}
+
+func TestLoginThrottleDelaysAfterFreeAttempts(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	credentials := Credentials{Email: "gustavo@example.com", Password: "wrong", IP: "10.0.0.1"}
+	for i := 0; i < 3; i++ {
+		_, _, err := f.sessions.Login(credentials)
+		assert.ErrorIs(t, err, domainerrors.ErrInvalidCredentials)
+	}
+
+	credentials.Password = "Vq7!mZt2Lp9x"
+	_, _, err := f.sessions.Login(credentials)
+	assert.ErrorIs(t, err, domainerrors.ErrLoginLocked)
+
+	*f.now = f.now.Add(time.Second)
+	_, _, err = f.sessions.Login(credentials)
+	assert.NoError(t, err)
+}
+
+func TestLoginThrottleLocksOutAndMailsUnlockLink(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	for i := 0; i < 5; i++ {
+		f.fail(t, "gustavo@example.com", "10.0.0.1")
+	}
+
+	_, _, err := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.2"})
+	assert.ErrorIs(t, err, domainerrors.ErrLoginLocked)
+	events, _ := f.audit.ListByAccount("550e8400-e29b-41d4-a716-446655440000")
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditLoginLocked, events[0].Type)
+		assert.Equal(t, "10.0.0.1", events[0].IP)
+	}
+
+	account, err := f.throttle.Unlock(f.unlockToken(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000", account.AccountID)
+	_, _, err = f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.2"})
+	assert.NoError(t, err)
+	events, _ = f.audit.ListByAccount("550e8400-e29b-41d4-a716-446655440000")
+	assert.Equal(t, AuditLoginUnlocked, events[len(events)-1].Type)
+}
+
+func TestLoginThrottleLockoutExpires(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	for i := 0; i < 5; i++ {
+		f.fail(t, "gustavo@example.com", "10.0.0.1")
+	}
+
+	*f.now = f.now.Add(f.throttle.Policy.LockoutDuration)
+	_, _, err := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.1"})
+	assert.NoError(t, err)
+}
+
+func TestLoginThrottleUnlockTokenIsSingleUse(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	for i := 0; i < 5; i++ {
+		f.fail(t, "gustavo@example.com", "10.0.0.1")
+	}
+	token := f.unlockToken(t)
+
+	_, err := f.throttle.Unlock(token)
+	assert.NoError(t, err)
+	_, err = f.throttle.Unlock(token)
+	assert.ErrorIs(t, err, domainerrors.ErrTokenAlreadyUsed)
+}
+
+func TestLoginThrottleTreatsUnknownEmailsAlike(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	for i := 0; i < 5; i++ {
+		f.fail(t, "nobody@example.com", "10.0.0.1")
+	}
+
+	_, _, err := f.sessions.Login(Credentials{Email: "nobody@example.com", Password: "wrong", IP: "10.0.0.1"})
+	assert.ErrorIs(t, err, domainerrors.ErrLoginLocked)
+	assert.Empty(t, f.mailer.Messages("nobody@example.com"))
+	events := f.audit.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditLoginLocked, events[0].Type)
+		assert.Empty(t, events[0].AccountID)
+		assert.Equal(t, "5 failed logins for n***@example.com", events[0].Detail)
+	}
+}
+
+func TestLoginThrottleLocksOutIP(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	for i := 0; i < 8; i++ {
+		f.fail(t, "user"+string(rune('a'+i))+"@example.com", "10.0.0.1")
+	}
+
+	_, _, err := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.1"})
+	assert.ErrorIs(t, err, domainerrors.ErrLoginLocked)
+	_, _, err = f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.2"})
+	assert.NoError(t, err)
+	events := f.audit.Events()
+	assert.Equal(t, AuditLoginIPLocked, events[len(events)-1].Type)
+}
+
+func TestLoginThrottleSuccessResetsEmailFailures(t *testing.T) {
+	f := newLoginThrottleFixture(t)
+	for i := 0; i < 4; i++ {
+		f.fail(t, "gustavo@example.com", "10.0.0.1")
+	}
+	_, _, err := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.1"})
+	assert.NoError(t, err)
+
+	// Four more failures stay below the threshold because the count started over
+	for i := 0; i < 4; i++ {
+		f.fail(t, "gustavo@example.com", "10.0.0.1")
+	}
+	_, _, err = f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", IP: "10.0.0.3"})
+	assert.NoError(t, err)
+}
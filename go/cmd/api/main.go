@@ -1,20 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"regexp"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/i18n"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
 	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
 	_ "github.com/lib/pq"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
+// shutdownTimeout is how long requests in flight get to finish once the server is told to stop
+const shutdownTimeout = 10 * time.Second
+
 type Database struct {
 	DB *sql.DB
 }
@@ -50,6 +62,10 @@ func LoggerMiddleware() fiber.Handler {
 			"ip":     c.IP(),
 		}).Info("Incoming request")
 		err := c.Next()
+		if err != nil {
+			// Render the error now so the logged status matches the response
+			err = c.App().Config().ErrorHandler(c, err)
+		}
 		status := c.Response().StatusCode()
 		fields := logrus.Fields{
 			"method":     c.Method(),
@@ -72,18 +88,18 @@ func LoggerMiddleware() fiber.Handler {
 }
 
 func ValidateName(name string) bool {
-	return len(strings.Split(name, " ")) == 2
+	_, err := NewName(name)
+	return err == nil
 }
 
 func ValidateEmail(email string) bool {
-	// Regex for basic email validation
-	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return re.MatchString(email)
+	_, err := DefaultEmailPolicy.ParseSyntax(email)
+	return err == nil
 }
 
 func CheckDuplicateEmail(db *Database, email string) (bool, error) {
 	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM ccca.account WHERE email = $1)`
+	query := `SELECT EXISTS(SELECT 1 FROM ccca.account WHERE lower(email) = lower($1))`
 	err := db.DB.QueryRow(query, email).Scan(&exists)
 	if err != nil {
 		return false, err
@@ -91,14 +107,20 @@ func CheckDuplicateEmail(db *Database, email string) (bool, error) {
 	return exists, nil
 }
 
+// ValidatePassword checks only the length and character classes of the default policy,
+// signup uses DefaultPasswordPolicy.Check to also reject weak and breached passwords
 func ValidatePassword(password string) bool {
-	return len(password) >= 8 &&
-		strings.ContainsAny(password, "0123456789") &&
-		strings.ContainsAny(password, "abcdefghijklmnopqrstuvwxyz") &&
-		strings.ContainsAny(password, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	return utf8.RuneCountInString(password) >= DefaultPasswordPolicy.MinLength &&
+		len(DefaultPasswordPolicy.checkClasses(password)) == 0
 }
 
 func ValidateAccountExists(db *Database, accountID string) (bool, error) {
+	if accountID == "" {
+		return false, domainerrors.ErrAccountIDRequired
+	}
+	if !isValidUUID(accountID) {
+		return false, domainerrors.ErrInvalidAccountID
+	}
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM ccca.account WHERE account_id = $1)`
 	err := db.DB.QueryRow(query, accountID).Scan(&exists)
@@ -108,85 +130,70 @@ func ValidateAccountExists(db *Database, accountID string) (bool, error) {
 	}).Info("Checking account existence")
 	if err != nil {
 		logrus.WithError(err).Error("Error checking account existence")
-		return false, err
+		return false, domainerrors.ErrInternal
 	}
 	if !exists {
-		logrus.Warn("Account does not exist", logrus.Fields{"accountId": accountID})
-		return false, fmt.Errorf("account does not exist")
+		logrus.WithField("accountId", accountID).Warn("Account does not exist")
+		return false, domainerrors.ErrAccountNotFound
 	}
 	return true, nil
 }
 
-type Document struct {
-	Digits string
-}
-
-func (d *Document) Validate() bool {
-	if d.Digits == "" {
-		return false
+// ValidateAccountVerified rejects accounts that have not confirmed their email yet or were closed
+func ValidateAccountVerified(db *Database, accountID string) (bool, error) {
+	var status string
+	query := `SELECT COALESCE(status, 'active') FROM ccca.account WHERE account_id = $1`
+	if err := db.DB.QueryRow(query, accountID).Scan(&status); err != nil {
+		logrus.WithError(err).Error("Error checking account status")
+		return false, domainerrors.ErrInternal
 	}
-	d.clean()
-	if len(d.Digits) != 11 {
-		return false
+	if status == AccountStatusPending {
+		logrus.WithField("accountId", accountID).Warn("Account email is not verified")
+		return false, domainerrors.ErrEmailNotVerified
 	}
-	if d.allDigitsSame() {
-		return false
+	if status == AccountStatusClosed {
+		logrus.WithField("accountId", accountID).Warn("Account is closed")
+		return false, domainerrors.ErrAccountClosed
 	}
-	return d.extractDigits() == fmt.Sprintf("%d%d", d.calculateDigit(10), d.calculateDigit(11))
+	return true, nil
 }
 
-func (d *Document) clean() {
-	// Remove non-numeric characters
-	re := regexp.MustCompile(`\D`)
-	d.Digits = re.ReplaceAllString(d.Digits, "")
+func isQuantityValid(quantity decimal.Decimal) bool {
+	return quantity.GreaterThanOrEqual(decimal.Zero)
 }
 
-func (d *Document) allDigitsSame() bool {
-	if len(d.Digits) == 0 {
-		return false
+func validateAccountID(accountID string, validation *domainerrors.ValidationError) {
+	if accountID == "" {
+		validation.Add("accountId", domainerrors.ErrAccountIDRequired)
+		return
 	}
-	firstDigit := d.Digits[0]
-	for i := 1; i < len(d.Digits); i++ {
-		if d.Digits[i] != firstDigit {
-			return false
-		}
+	if !isValidUUID(accountID) {
+		validation.Add("accountId", domainerrors.ErrInvalidAccountID)
 	}
-	return true
 }
 
-func (d *Document) calculateDigit(factor int) int {
-	sum := 0
-	digitsToProcess := factor - 1
-	for i := 0; i < digitsToProcess && i < len(d.Digits); i++ {
-		digit := int(d.Digits[i] - '0')
-		sum += digit * (factor - i)
+func isDepositValid(depositRequest types.DepositRequest) (bool, error) {
+	validation := &domainerrors.ValidationError{}
+	validateAccountID(depositRequest.AccountID, validation)
+	if depositRequest.AssetID == "" || !depositRequest.AssetID.IsValid() {
+		validation.Add("assetId", domainerrors.ErrInvalidAsset)
 	}
-	remainder := sum % 11
-	if remainder < 2 {
-		return 0
+	if depositRequest.Quantity.IsZero() || !isQuantityValid(depositRequest.Quantity) {
+		validation.Add("quantity", domainerrors.ErrInvalidQuantity)
 	}
-	return 11 - remainder
-}
-
-func (d *Document) extractDigits() string {
-	return d.Digits[9:]
-}
-
-func isQuantityValid(quantity decimal.Decimal) bool {
-	return quantity.GreaterThanOrEqual(decimal.Zero)
+	return !validation.HasErrors(), validation.ErrorOrNil()
 }
 
-func isDepositValid(depositRequest types.DepositRequest) (bool, error) {
-	if depositRequest.AccountID == "" {
-		return false, fmt.Errorf("accountId is required")
-	}
-	if depositRequest.AssetID == "" || !depositRequest.AssetID.IsValid() {
-		return false, fmt.Errorf("assetId is required and must be valid")
+func isWithdrawValid(withdrawRequest types.WithdrawRequest) (bool, error) {
+	validation := &domainerrors.ValidationError{}
+	validateAccountID(withdrawRequest.AccountID, validation)
+	if !withdrawRequest.AssetID.IsValid() {
+		validation.Add("assetId", domainerrors.ErrInvalidAsset)
 	}
-	if depositRequest.Quantity.IsZero() || !isQuantityValid(depositRequest.Quantity) {
-		return false, fmt.Errorf("quantity is required and must be a valid positive integer")
+	if !isQuantityValid(withdrawRequest.Quantity) {
+		validation.Add("quantity", domainerrors.ErrInvalidQuantity)
 	}
-	return true, nil
+	return !validation.HasErrors(), validation.ErrorOrNil()
 }
 
 func isValidUUID(u string) bool {
@@ -194,67 +201,101 @@ func isValidUUID(u string) bool {
 	return err == nil
 }
 
-func validateSignupRequest(req types.SignupRequest, db *Database) (bool, error) {
-	if !ValidateName(req.Name) {
-		return false, fmt.Errorf("Invalid name")
-	}
-	if !ValidateEmail(req.Email) {
-		return false, fmt.Errorf("Invalid email")
+func validateSignupRequest(req types.SignupRequest, db *Database, accounts IAccountDAO) (bool, error) {
+	validation := &domainerrors.ValidationError{}
+	if _, err := NewName(req.Name); err != nil {
+		validation.Add("name", err)
 	}
-	emailExists, err := CheckDuplicateEmail(db, req.Email)
-	if err != nil {
-		logrus.WithError(err).Error("Error checking duplicate email")
-		return false, fmt.Errorf("Failed to check email")
-	}
-	if emailExists {
-		return false, fmt.Errorf("Email already exists")
+	if email, err := NewEmail(req.Email); err != nil {
+		validation.Add("email", err)
+	} else {
+		// Only hit the database for emails that could actually be stored
+		emailExists, err := CheckDuplicateEmail(db, email.String())
+		if err != nil {
+			logrus.WithError(err).Error("Error checking duplicate email")
+			return false, domainerrors.ErrInternal
+		}
+		if emailExists {
+			validation.Add("email", domainerrors.ErrDuplicateEmail)
+		}
 	}
-	if !ValidatePassword(req.Password) {
-		return false, fmt.Errorf("Invalid password")
+	for _, err := range DefaultPasswordPolicy.Check(req.Password, PasswordUserInputs{Name: req.Name, Email: req.Email}) {
+		validation.Add("password", err)
 	}
 	document := Document{Digits: req.Document}
 	if !document.Validate() {
-		return false, fmt.Errorf("Invalid document")
+		validation.Add("document", domainerrors.ErrInvalidDocument)
+	} else {
+		existing, err := accounts.GetByDocument(document.Digits)
+		if err != nil {
+			logrus.WithError(err).Error("Error checking duplicate document")
+			return false, domainerrors.ErrInternal
+		}
+		if existing != nil {
+			validation.Add("document", domainerrors.ErrDuplicateDocument)
+		}
 	}
-	return true, nil
+	return !validation.HasErrors(), validation.ErrorOrNil()
 }
 
-func handleSignup(c *fiber.Ctx, db *Database) error {
+func handleSignup(c *fiber.Ctx, db *Database, accounts IAccountDAO, verification *EmailVerificationService) error {
 	var req types.SignupRequest
 	if err := c.BodyParser(&req); err != nil {
 		logrus.WithError(err).Error("Failed to parse request body")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Invalid request body"})
+		return domainerrors.ErrInvalidRequestBody
 	}
 	logrus.WithFields(logrus.Fields{
 		"email": req.Email,
 		"name":  req.Name,
 	}).Info("Processing signup")
-	if valid, err := validateSignupRequest(req, db); !valid {
+	if valid, err := validateSignupRequest(req, db, accounts); !valid {
 		logrus.WithError(err).Error("Invalid signup request")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
+	name, _ := NewName(req.Name)
+	email, _ := NewEmail(req.Email)
 	document := Document{Digits: req.Document}
+	document.Validate()
+	passwordHash, err := HashPassword(req.Password)
+	if err != nil {
+		logrus.WithError(err).Error("Error hashing password")
+		return domainerrors.ErrInternal
+	}
 	user := types.User{
-		AccountID: uuid.New(),
-		Name:      req.Name,
-		Email:     req.Email,
-		Document:  document.Digits,
-		Password:  req.Password,
+		AccountID:    uuid.New(),
+		Name:         name.String(),
+		Email:        email.String(),
+		Document:     document.Digits,
+		DocumentType: string(document.Type),
+		Password:     passwordHash,
 	}
 	logrus.WithFields(logrus.Fields{
 		"accountId": user.AccountID,
 		"email":     user.Email,
 	}).Info("Creating new account")
-	query := `INSERT INTO ccca.account (account_id, name, email, document, password) VALUES ($1, $2, $3, $4, $5)`
-	_, err := db.DB.Exec(query, user.AccountID, user.Name, user.Email, user.Document, user.Password)
+	query := `INSERT INTO ccca.account (account_id, name, email, document, document_type, password, status) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = db.DB.Exec(query, user.AccountID, user.Name, user.Email, user.Document, user.DocumentType, user.Password, AccountStatusPending)
+	if isUniqueViolation(err, accountDocumentConstraint) {
+		// Another signup with the same document won the race after validation
+		validation := &domainerrors.ValidationError{}
+		validation.Add("document", domainerrors.ErrDuplicateDocument)
+		return validation
+	}
+	if isUniqueViolation(err, accountEmailConstraint) {
+		validation := &domainerrors.ValidationError{}
+		validation.Add("email", domainerrors.ErrDuplicateEmail)
+		return validation
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Error inserting account")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to create account"})
+		return domainerrors.ErrInternal
 	}
 	logrus.WithField("accountId", user.AccountID).Info("Account created successfully")
+	account := &Account{AccountID: user.AccountID.String(), Name: user.Name, Email: user.Email, Status: AccountStatusPending}
+	if err := verification.Send(c.UserContext(), account); err != nil {
+		// The account exists already, the user can ask for a new link
+		logrus.WithError(err).WithField("accountId", user.AccountID).Error("Failed to send verification email")
+	}
 	c.Status(fiber.StatusOK)
 	return c.JSON(fiber.Map{"accountId": user.AccountID})
 }
@@ -262,61 +303,115 @@ func handleSignup(c *fiber.Ctx, db *Database) error {
 func handleGetAccount(c *fiber.Ctx, db *Database) error {
 	accountID := c.Params("accountId")
 	if !isValidUUID(accountID) {
-		logrus.Warn("Invalid account ID format", logrus.Fields{"accountId": accountID})
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Invalid account ID format"})
+		logrus.WithField("accountId", accountID).Warn("Invalid account ID format")
+		return domainerrors.ErrInvalidAccountID
+	}
+	if err := requireOwnAccount(c, accountID); err != nil {
+		return err
 	}
-	query := `SELECT account_id, name, email, document FROM ccca.account WHERE account_id = $1`
+	query := `SELECT account_id, name, email, document, COALESCE(document_type, ''), COALESCE(status, 'active') FROM ccca.account WHERE account_id = $1`
 	var account types.Account
-	err := db.DB.QueryRow(query, accountID).Scan(&account.AccountID, &account.Name, &account.Email, &account.Document)
+	err := db.DB.QueryRow(query, accountID).Scan(&account.AccountID, &account.Name, &account.Email, &account.Document, &account.DocumentType, &account.Status)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.Status(fiber.StatusNotFound)
-			return c.JSON(fiber.Map{"error": "Account not found"})
+			return domainerrors.ErrAccountNotFound
 		}
 		logrus.WithError(err).Error("Error querying account")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to retrieve account"})
+		return domainerrors.ErrInternal
 	}
 	account.Assets = []types.Asset{}
-	assetQuery := `SELECT asset_id, quantity FROM ccca.account_asset WHERE account_id = $1`
+	assetQuery := `SELECT asset_id, available, on_hold FROM ccca.account_asset WHERE account_id = $1`
 	rows, err := db.DB.Query(assetQuery, account.AccountID)
 	if err != nil {
 		logrus.WithError(err).Error("Error querying account assets")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to retrieve account assets"})
+		return domainerrors.ErrInternal
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var asset types.Asset
-		if err := rows.Scan(&asset.AssetID, &asset.Quantity); err != nil {
+		if err := rows.Scan(&asset.AssetID, &asset.Available, &asset.OnHold); err != nil {
 			logrus.WithError(err).Error("Error scanning asset")
-			c.Status(fiber.StatusInternalServerError)
-			return c.JSON(fiber.Map{"error": "Failed to retrieve account assets"})
+			return domainerrors.ErrInternal
 		}
+		asset.Quantity = asset.Available.Add(asset.OnHold)
 		account.Assets = append(account.Assets, asset)
 	}
 	if err := rows.Err(); err != nil {
 		logrus.WithError(err).Error("Error iterating over account assets")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to retrieve account assets"})
+		return domainerrors.ErrInternal
 	}
 	c.Status(fiber.StatusOK)
 	return c.JSON(fiber.Map{
-		"accountId": account.AccountID,
-		"name":      account.Name,
-		"email":     account.Email,
-		"document":  account.Document,
-		"assets":    account.Assets,
+		"accountId":    account.AccountID,
+		"name":         account.Name,
+		"email":        account.Email,
+		"document":     FormatDocument(account.Document, account.DocumentType),
+		"documentType": account.DocumentType,
+		"status":       account.Status,
+		"assets":       account.Assets,
+	})
+}
+
+func handleUpdateAccount(c *fiber.Ctx, accounts *AccountService) error {
+	accountID := c.Params("accountId")
+	if err := requireOwnAccount(c, accountID); err != nil {
+		return err
+	}
+	var req types.UpdateAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse account update request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	account, err := accounts.UpdateProfile(c.UserContext(), accountID, req)
+	if err != nil {
+		return accountError(err, "Error updating account")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"accountId":    account.AccountID,
+		"name":         account.Name,
+		"email":        account.Email,
+		"document":     FormatDocument(account.Document, account.DocumentType),
+		"documentType": account.DocumentType,
+		"status":       account.Status,
+	})
+}
+
+func handleCloseAccount(c *fiber.Ctx, accounts *AccountService) error {
+	accountID := c.Params("accountId")
+	if err := requireOwnAccount(c, accountID); err != nil {
+		return err
+	}
+	var req types.CloseAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse account closure request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	if err := accounts.Close(accountID, req.Password); err != nil {
+		return accountError(err, "Error closing account")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"message": "Account closed",
 	})
 }
 
-func handleDeposit(c *fiber.Ctx, db *Database) error {
+// accountError hides storage failures behind an internal error and passes domain and validation errors through
+func accountError(err error, message string) error {
+	var domainErr *domainerrors.Error
+	var validationErr *domainerrors.ValidationError
+	if !errors.As(err, &domainErr) && !errors.As(err, &validationErr) {
+		logrus.WithError(err).Error(message)
+		return domainerrors.ErrInternal
+	}
+	return err
+}
+
+func handleDeposit(c *fiber.Ctx, db *Database, work IUnitOfWork, listener BalanceListener) error {
 	var depositRequest types.DepositRequest
 	if err := c.BodyParser(&depositRequest); err != nil {
 		logrus.WithError(err).Error("Failed to parse deposit request body")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Invalid request body"})
+		return domainerrors.ErrInvalidRequestBody
 	}
 	logrus.WithFields(logrus.Fields{
 		"accountId": depositRequest.AccountID,
@@ -325,134 +420,825 @@ func handleDeposit(c *fiber.Ctx, db *Database) error {
 	}).Info("Processing deposit")
 	if valid, err := isDepositValid(depositRequest); !valid {
 		logrus.WithError(err).Error("Invalid deposit request")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	if exists, err := ValidateAccountExists(db, depositRequest.AccountID); !exists || err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Account does not exist"})
+	if err := requireOwnAccount(c, depositRequest.AccountID); err != nil {
+		return err
+	}
+	if exists, err := ValidateAccountExists(db, depositRequest.AccountID); !exists {
+		return err
 	}
-	query := `INSERT INTO ccca.account_asset (account_id, asset_id, quantity) VALUES ($1, $2, $3) ON CONFLICT (account_id, asset_id) DO UPDATE SET quantity = ccca.account_asset.quantity + EXCLUDED.quantity`
-	_, err := db.DB.Exec(query, depositRequest.AccountID, depositRequest.AssetID, depositRequest.Quantity)
+	// The account is checked and credited under its lock, it cannot be closed in between
+	err := work.Run(func(tx ExchangeTx) error {
+		if err := tx.ShareAccount(depositRequest.AccountID); err != nil {
+			return err
+		}
+		if err := activeAccount(tx.Accounts, depositRequest.AccountID); err != nil {
+			return err
+		}
+		return tx.Balances.Credit(depositRequest.AccountID, depositRequest.AssetID, depositRequest.Quantity)
+	})
 	if err != nil {
+		var domainErr *domainerrors.Error
+		if errors.As(err, &domainErr) {
+			logrus.WithError(err).WithField("accountId", depositRequest.AccountID).Warn("Deposit refused")
+			return err
+		}
 		logrus.WithError(err).Error("Error inserting deposit")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to process deposit"})
+		return domainerrors.ErrInternal
 	}
 	logrus.WithFields(logrus.Fields{
 		"accountId": depositRequest.AccountID,
 		"assetId":   depositRequest.AssetID,
 		"quantity":  depositRequest.Quantity,
 	}).Info("Deposit processed successfully")
+	listener.OnBalanceChange(depositRequest.AccountID, depositRequest.AssetID)
 	c.Status(fiber.StatusOK)
 	return c.JSON(fiber.Map{
 		"message": "Deposit completed",
 	})
 }
 
-func handleWithdraw(c *fiber.Ctx, db *Database) error {
+func handleWithdraw(c *fiber.Ctx, db *Database, balances IBalanceDAO, twoFactor *TwoFactorService, listener BalanceListener) error {
 	var withdrawRequest types.WithdrawRequest
 	if err := c.BodyParser(&withdrawRequest); err != nil {
 		logrus.WithError(err).Error("Failed to parse withdraw request body")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Invalid request body"})
+		return domainerrors.ErrInvalidRequestBody
 	}
-	if !withdrawRequest.AssetID.IsValid() {
-		logrus.WithFields(logrus.Fields{
+	if valid, err := isWithdrawValid(withdrawRequest); !valid {
+		logrus.WithError(err).WithFields(logrus.Fields{
 			"accountId": withdrawRequest.AccountID,
 			"quantity":  withdrawRequest.Quantity,
 			"assetId":   withdrawRequest.AssetID,
-		}).Warn("Invalid asset ID for withdrawal")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Invalid asset ID"})
+		}).Warn("Invalid withdraw request")
+		return err
 	}
-	if !isQuantityValid(withdrawRequest.Quantity) {
-		logrus.WithFields(logrus.Fields{
-			"accountId": withdrawRequest.AccountID,
-			"quantity":  withdrawRequest.Quantity,
-			"assetId":   withdrawRequest.AssetID,
-		}).Warn("Invalid quantity for withdrawal")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Invalid quantity"})
-	}
-	if exists, err := ValidateAccountExists(db, withdrawRequest.AccountID); !exists || err != nil {
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Account does not exist"})
-	}
-	// Get asset details
-	query := `SELECT asset_id, quantity FROM ccca.account_asset WHERE account_id = $1 AND asset_id = $2`
-	var asset types.Asset
-	err := db.DB.QueryRow(query, withdrawRequest.AccountID, withdrawRequest.AssetID).Scan(&asset.AssetID, &asset.Quantity)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			logrus.WithFields(logrus.Fields{
-				"accountId": withdrawRequest.AccountID,
-				"assetId":   withdrawRequest.AssetID,
-			}).Warn("Asset not found for withdrawal")
-			c.Status(fiber.StatusNotFound)
-			return c.JSON(fiber.Map{"error": "Asset not found"})
+	if err := requireOwnAccount(c, withdrawRequest.AccountID); err != nil {
+		return err
+	}
+	if exists, err := ValidateAccountExists(db, withdrawRequest.AccountID); !exists {
+		return err
+	}
+	if verified, err := ValidateAccountVerified(db, withdrawRequest.AccountID); !verified {
+		return err
+	}
+	if err := twoFactor.RequireStepUp(withdrawRequest.AccountID, withdrawRequest.AssetID, withdrawRequest.Quantity, withdrawRequest.TotpCode); err != nil {
+		var domainErr *domainerrors.Error
+		if !errors.As(err, &domainErr) {
+			logrus.WithError(err).Error("Error checking withdrawal second factor")
+			return domainerrors.ErrInternal
 		}
-		logrus.WithError(err).Error("Error querying asset for withdrawal")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to retrieve asset"})
+		logrus.WithError(err).WithField("accountId", withdrawRequest.AccountID).Warn("Withdrawal step-up authentication failed")
+		return err
 	}
-
-	if asset.Quantity.LessThan(withdrawRequest.Quantity) {
+	// Funds on hold for open orders cannot be withdrawn
+	if err := balances.Debit(withdrawRequest.AccountID, withdrawRequest.AssetID, withdrawRequest.Quantity); err != nil {
+		if !errors.Is(err, domainerrors.ErrInsufficientFunds) {
+			logrus.WithError(err).Error("Error updating asset quantity for withdrawal")
+			return domainerrors.ErrInternal
+		}
 		logrus.WithFields(logrus.Fields{
 			"accountId": withdrawRequest.AccountID,
 			"assetId":   withdrawRequest.AssetID,
 			"quantity":  withdrawRequest.Quantity,
-			"available": asset.Quantity,
 		}).Warn("Insufficient asset quantity for withdrawal")
-		c.Status(fiber.StatusBadRequest)
-		return c.JSON(fiber.Map{"error": "Insufficient asset quantity"})
-	}
-	// Update asset quantity
-	updateQuery := `UPDATE ccca.account_asset SET quantity = quantity - $1 WHERE account_id = $2 AND asset_id = $3`
-	_, err = db.DB.Exec(updateQuery, withdrawRequest.Quantity, withdrawRequest.AccountID, withdrawRequest.AssetID)
-	if err != nil {
-		logrus.WithError(err).Error("Error updating asset quantity for withdrawal")
-		c.Status(fiber.StatusInternalServerError)
-		return c.JSON(fiber.Map{"error": "Failed to process withdrawal"})
+		return err
 	}
 	logrus.WithFields(logrus.Fields{
 		"accountId": withdrawRequest.AccountID,
 		"assetId":   withdrawRequest.AssetID,
 		"quantity":  withdrawRequest.Quantity,
 	}).Info("Withdrawal processed successfully")
+	listener.OnBalanceChange(withdrawRequest.AccountID, withdrawRequest.AssetID)
 	c.Status(fiber.StatusOK)
 	return c.JSON(fiber.Map{})
 }
 
+func handleVerifyEmail(c *fiber.Ctx, verification *EmailVerificationService) error {
+	token := c.Query("token")
+	if token == "" {
+		return domainerrors.ErrInvalidToken
+	}
+	account, err := verification.Verify(token)
+	if err != nil {
+		logrus.WithError(err).Warn("Email verification failed")
+		return err
+	}
+	logrus.WithField("accountId", account.AccountID).Info("Email verified successfully")
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"accountId": account.AccountID,
+		"status":    account.Status,
+	})
+}
+
+func handleResendVerification(c *fiber.Ctx, verification *EmailVerificationService) error {
+	var req types.ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse resend verification request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	email, err := NewEmail(req.Email)
+	if err != nil {
+		validation := &domainerrors.ValidationError{}
+		validation.Add("email", err)
+		return validation
+	}
+	if err := verification.Resend(c.UserContext(), email.String()); err != nil {
+		if !errors.Is(err, domainerrors.ErrTooManyRequests) {
+			logrus.WithError(err).Error("Failed to resend verification email")
+			return domainerrors.ErrInternal
+		}
+		return err
+	}
+	// Same answer whether or not the address belongs to a pending account
+	c.Status(fiber.StatusAccepted)
+	return c.JSON(fiber.Map{
+		"message": "If the account is pending verification, a new email was sent",
+	})
+}
+
+func handleLogin(c *fiber.Ctx, sessions *SessionService) error {
+	var req types.LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse login request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	token, account, err := sessions.Login(Credentials{
+		Email:    strings.TrimSpace(req.Email),
+		Password: req.Password,
+		TotpCode: req.TotpCode,
+		IP:       c.IP(),
+	})
+	if err != nil {
+		var domainErr *domainerrors.Error
+		if !errors.As(err, &domainErr) {
+			logrus.WithError(err).Error("Error logging in")
+			return domainerrors.ErrInternal
+		}
+		logrus.WithError(err).WithField("email", req.Email).Warn("Invalid login attempt")
+		return err
+	}
+	logrus.WithField("accountId", account.AccountID).Info("Login successful")
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"accountId": account.AccountID,
+		"token":     token,
+		"expiresIn": int(sessions.SessionTTL.Seconds()),
+	})
+}
+
+func handleUnlockLogin(c *fiber.Ctx, throttle *LoginThrottle) error {
+	token := c.Query("token")
+	if token == "" {
+		return domainerrors.ErrInvalidToken
+	}
+	account, err := throttle.Unlock(token)
+	if err != nil {
+		var domainErr *domainerrors.Error
+		if !errors.As(err, &domainErr) {
+			logrus.WithError(err).Error("Error unlocking login")
+			return domainerrors.ErrInternal
+		}
+		return err
+	}
+	logrus.WithField("accountId", account.AccountID).Info("Login unlocked")
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"message": "Login unlocked",
+	})
+}
+
+func handleForgotPassword(c *fiber.Ctx, passwords *PasswordService) error {
+	var req types.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse forgot password request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	if email, err := NewEmail(req.Email); err == nil {
+		if err := passwords.Forgot(c.UserContext(), email.String()); err != nil {
+			// Still answer 202 so failures do not reveal which emails exist
+			logrus.WithError(err).Error("Failed to send password reset email")
+		}
+	}
+	c.Status(fiber.StatusAccepted)
+	return c.JSON(fiber.Map{
+		"message": "If the email belongs to an account, a reset link was sent",
+	})
+}
+
+func handleResetPassword(c *fiber.Ctx, passwords *PasswordService) error {
+	var req types.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse reset password request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	if req.Token == "" {
+		return domainerrors.ErrInvalidToken
+	}
+	if err := passwords.Reset(req.Token, req.Password); err != nil {
+		var domainErr *domainerrors.Error
+		var validationErr *domainerrors.ValidationError
+		if !errors.As(err, &domainErr) && !errors.As(err, &validationErr) {
+			logrus.WithError(err).Error("Error resetting password")
+			return domainerrors.ErrInternal
+		}
+		return err
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"message": "Password reset, please log in again",
+	})
+}
+
+func handleChangePassword(c *fiber.Ctx, passwords *PasswordService) error {
+	var req types.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse change password request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	accountID, _ := c.Locals(localAccountID).(string)
+	if err := passwords.Change(accountID, req.CurrentPassword, req.NewPassword); err != nil {
+		var domainErr *domainerrors.Error
+		var validationErr *domainerrors.ValidationError
+		if !errors.As(err, &domainErr) && !errors.As(err, &validationErr) {
+			logrus.WithError(err).Error("Error changing password")
+			return domainerrors.ErrInternal
+		}
+		return err
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"message": "Password changed, please log in again",
+	})
+}
+
+func handleEnrollTwoFactor(c *fiber.Ctx, twoFactor *TwoFactorService) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	secret, uri, err := twoFactor.Enroll(accountID)
+	if err != nil {
+		return twoFactorError(err, "Error enrolling two-factor authentication")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"secret":     secret,
+		"otpauthUri": uri,
+	})
+}
+
+func handleConfirmTwoFactor(c *fiber.Ctx, twoFactor *TwoFactorService) error {
+	var req types.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse two-factor request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	accountID, _ := c.Locals(localAccountID).(string)
+	recoveryCodes, err := twoFactor.Confirm(accountID, req.Code)
+	if err != nil {
+		return twoFactorError(err, "Error confirming two-factor authentication")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+func handleDisableTwoFactor(c *fiber.Ctx, twoFactor *TwoFactorService) error {
+	var req types.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse two-factor request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	accountID, _ := c.Locals(localAccountID).(string)
+	if err := twoFactor.Disable(accountID, req.Code); err != nil {
+		return twoFactorError(err, "Error disabling two-factor authentication")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func apiKeyResponse(key APIKey) fiber.Map {
+	return fiber.Map{
+		"keyId":      key.KeyID,
+		"name":       key.Name,
+		"scopes":     key.Scopes,
+		"allowedIps": key.AllowedIPs,
+		"createdAt":  key.CreatedAt,
+		"expiresAt":  key.ExpiresAt,
+		"revokedAt":  key.RevokedAt,
+		"lastUsedAt": key.LastUsedAt,
+	}
+}
+
+func handleCreateAPIKey(c *fiber.Ctx, apiKeys *APIKeyService) error {
+	var req types.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse API key request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	accountID, _ := c.Locals(localAccountID).(string)
+	key, secret, err := apiKeys.Create(accountID, req)
+	if err != nil {
+		var validationErr *domainerrors.ValidationError
+		if !errors.As(err, &validationErr) {
+			logrus.WithError(err).Error("Error creating API key")
+			return domainerrors.ErrInternal
+		}
+		return err
+	}
+	response := apiKeyResponse(*key)
+	response["secret"] = secret
+	c.Status(fiber.StatusCreated)
+	return c.JSON(response)
+}
+
+func handleListAPIKeys(c *fiber.Ctx, apiKeys *APIKeyService) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	keys, err := apiKeys.List(accountID)
+	if err != nil {
+		logrus.WithError(err).Error("Error listing API keys")
+		return domainerrors.ErrInternal
+	}
+	response := make([]fiber.Map, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponse(key))
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(response)
+}
+
+func handleRevokeAPIKey(c *fiber.Ctx, apiKeys *APIKeyService) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	if err := apiKeys.Revoke(accountID, c.Params("keyId")); err != nil {
+		var domainErr *domainerrors.Error
+		if !errors.As(err, &domainErr) {
+			logrus.WithError(err).Error("Error revoking API key")
+			return domainerrors.ErrInternal
+		}
+		return err
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
+
+func orderResponse(order *Order) fiber.Map {
+	return fiber.Map{
+		"orderId":       order.OrderID,
+		"marketId":      order.MarketID,
+		"side":          order.Side,
+		"type":          order.Type,
+		"quantity":      order.Quantity,
+		"price":         order.Price,
+		"quoteQuantity": order.QuoteQuantity,
+		"fillQuantity":  order.FillQuantity,
+		"fillPrice":     order.FillPrice,
+		"status":        order.Status,
+		"timestamp":     order.Timestamp,
+		"timeInForce":   order.TimeInForce,
+		"postOnly":      order.PostOnly,
+		"expiresAt":     order.ExpiresAt,
+		"stopPrice":     order.StopPrice,
+		"triggeredAt":   order.TriggeredAt,
+	}
+}
+
+func liquidity(maker bool) string {
+	if maker {
+		return "maker"
+	}
+	return "taker"
+}
+
+// tradesResponse lists the trades of order with the fee it paid on each
+func tradesResponse(order *Order, trades []Trade) []fiber.Map {
+	response := make([]fiber.Map, 0, len(trades))
+	for _, trade := range trades {
+		fee, feeAsset, maker := trade.feeOf(order.Side)
+		response = append(response, fiber.Map{
+			"tradeId":   trade.TradeID,
+			"side":      trade.Side,
+			"quantity":  trade.Quantity,
+			"price":     trade.Price,
+			"timestamp": trade.Timestamp,
+			"liquidity": liquidity(maker),
+			"fee":       fee,
+			"feeAsset":  feeAsset,
+		})
+	}
+	return response
+}
+
+// nextCursor is null in responses on the last page
+func nextCursor(cursor string) any {
+	if cursor == "" {
+		return nil
+	}
+	return cursor
+}
+
+// marketTradeResponse is a trade as the public sees it, without the accounts and fees
+func marketTradeResponse(trade Trade) fiber.Map {
+	return fiber.Map{
+		"tradeId":   trade.TradeID,
+		"side":      trade.Side,
+		"quantity":  trade.Quantity,
+		"price":     trade.Price,
+		"timestamp": trade.Timestamp,
+	}
+}
+
+func handleListMarketTrades(c *fiber.Ctx, exchange *Exchange) error {
+	marketID := c.Params("marketId")
+	trades, next, err := exchange.MarketTrades(marketID, c.Query("cursor"), c.Query("limit"))
+	if err != nil {
+		return accountError(err, "Error listing market trades")
+	}
+	response := make([]fiber.Map, 0, len(trades))
+	for _, trade := range trades {
+		response = append(response, marketTradeResponse(trade))
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{"marketId": marketID, "trades": response, "nextCursor": nextCursor(next)})
+}
+
+func handleListCandles(c *fiber.Ctx, candles *CandleService) error {
+	marketID := c.Params("marketId")
+	interval := c.Query("interval")
+	series, err := candles.Series(marketID, interval, c.Query("from"), c.Query("to"))
+	if err != nil {
+		return accountError(err, "Error listing candles")
+	}
+	response := make([]fiber.Map, 0, len(series))
+	for _, candle := range series {
+		response = append(response, fiber.Map{
+			"openTime": candle.OpenTime,
+			"open":     candle.Open,
+			"high":     candle.High,
+			"low":      candle.Low,
+			"close":    candle.Close,
+			"volume":   candle.Volume,
+			"trades":   candle.TradeCount,
+		})
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{"marketId": marketID, "interval": interval, "candles": response})
+}
+
+func tickerResponse(ticker Ticker) fiber.Map {
+	return fiber.Map{
+		"marketId":      ticker.MarketID,
+		"lastPrice":     ticker.LastPrice,
+		"bestBid":       ticker.BestBid,
+		"bestAsk":       ticker.BestAsk,
+		"open":          ticker.Open,
+		"high":          ticker.High,
+		"low":           ticker.Low,
+		"volume":        ticker.Volume,
+		"quoteVolume":   ticker.QuoteVolume,
+		"changePercent": ticker.ChangePercent,
+		"timestamp":     ticker.Timestamp,
+	}
+}
+
+func handleListTickers(c *fiber.Ctx, tickers *TickerService) error {
+	list, err := tickers.List()
+	if err != nil {
+		return accountError(err, "Error listing tickers")
+	}
+	response := make([]fiber.Map, 0, len(list))
+	for _, ticker := range list {
+		response = append(response, tickerResponse(ticker))
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{"tickers": response})
+}
+
+func handleGetTicker(c *fiber.Ctx, tickers *TickerService) error {
+	ticker, err := tickers.Get(c.Params("marketId"))
+	if err != nil {
+		return accountError(err, "Error getting ticker")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(tickerResponse(ticker))
+}
+
+// handleStream upgrades to the WebSocket stream. Authenticated connections can
+// also subscribe to the channel of their account.
+func handleStream(c *fiber.Ctx, stream *StreamHub) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	client := stream.Connect(accountID, i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage)))
+	return upgradeWebSocket(c, func(ws *wsConn) {
+		stream.Serve(ws, client)
+	})
+}
+
+// handleAccountStream streams the balance changes of an account as Server-Sent
+// Events, for clients that cannot use the WebSocket stream
+func handleAccountStream(c *fiber.Ctx, feed *BalanceFeed) error {
+	accountID := c.Params("accountId")
+	if err := requireOwnAccount(c, accountID); err != nil {
+		return err
+	}
+	// EventSource sends the header when it reconnects, the query parameter lets a new connection resume
+	lastEventID, err := parseLastEventID(c.Get("Last-Event-ID", c.Query("lastEventId")))
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	// Proxies must pass events on as they come instead of buffering the response
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		feed.Serve(w, accountID, lastEventID)
+	})
+	return nil
+}
+
+func handleListAccountTrades(c *fiber.Ctx, exchange *Exchange) error {
+	accountID := c.Params("accountId")
+	if err := requireOwnAccount(c, accountID); err != nil {
+		return err
+	}
+	fills, next, err := exchange.AccountTrades(accountID, c.Query("cursor"), c.Query("limit"))
+	if err != nil {
+		return accountError(err, "Error listing account trades")
+	}
+	response := make([]fiber.Map, 0, len(fills))
+	for _, fill := range fills {
+		response = append(response, fiber.Map{
+			"tradeId":   fill.Trade.TradeID,
+			"marketId":  fill.Trade.MarketID,
+			"orderId":   fill.OrderID,
+			"side":      fill.Side,
+			"quantity":  fill.Trade.Quantity,
+			"price":     fill.Trade.Price,
+			"timestamp": fill.Trade.Timestamp,
+			"liquidity": liquidity(fill.Maker),
+			"fee":       fill.Fee,
+			"feeAsset":  fill.FeeAsset,
+		})
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(fiber.Map{"trades": response, "nextCursor": nextCursor(next)})
+}
+
+func handlePlaceOrder(c *fiber.Ctx, exchange *Exchange) error {
+	var req types.PlaceOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		logrus.WithError(err).Error("Failed to parse order request body")
+		return domainerrors.ErrInvalidRequestBody
+	}
+	accountID, _ := c.Locals(localAccountID).(string)
+	order, trades, err := exchange.Place(accountID, req)
+	if err != nil {
+		return accountError(err, "Error placing order")
+	}
+	response := orderResponse(order)
+	response["trades"] = tradesResponse(order, trades)
+	c.Status(fiber.StatusCreated)
+	return c.JSON(response)
+}
+
+func handleGetOrder(c *fiber.Ctx, exchange *Exchange) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	order, trades, err := exchange.Get(accountID, c.Params("orderId"))
+	if err != nil {
+		return accountError(err, "Error querying order")
+	}
+	response := orderResponse(order)
+	response["trades"] = tradesResponse(order, trades)
+	c.Status(fiber.StatusOK)
+	return c.JSON(response)
+}
+
+func handleListOrders(c *fiber.Ctx, exchange *Exchange) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	orders, err := exchange.List(accountID)
+	if err != nil {
+		logrus.WithError(err).Error("Error listing orders")
+		return domainerrors.ErrInternal
+	}
+	response := make([]fiber.Map, 0, len(orders))
+	for i := range orders {
+		response = append(response, orderResponse(&orders[i]))
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(response)
+}
+
+func handleCancelOrder(c *fiber.Ctx, exchange *Exchange) error {
+	accountID, _ := c.Locals(localAccountID).(string)
+	order, err := exchange.Cancel(accountID, c.Params("orderId"))
+	if err != nil {
+		return accountError(err, "Error cancelling order")
+	}
+	c.Status(fiber.StatusOK)
+	return c.JSON(orderResponse(order))
+}
+
+// twoFactorError hides storage failures behind an internal error and passes domain errors through
+func twoFactorError(err error, message string) error {
+	var domainErr *domainerrors.Error
+	if !errors.As(err, &domainErr) {
+		logrus.WithError(err).Error(message)
+		return domainerrors.ErrInternal
+	}
+	return err
+}
+
 func main() {
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetLevel(logrus.InfoLevel)
+	logrus.AddHook(NewRedactionHookFromEnv())
+	DefaultNamePolicy = NewNamePolicyFromEnv()
+	DefaultEmailPolicy = NewEmailPolicyFromEnv()
+	DefaultPasswordPolicy = NewPasswordPolicyFromEnv()
 	logrus.Info("Starting application initialization")
 	app := fiber.New(fiber.Config{
 		EnablePrintRoutes: true,
+		ErrorHandler:      ErrorHandler,
 	})
 	app.Use(LoggerMiddleware())
 	db := NewDatabase()
 	defer db.DB.Close()
+	accounts := NewAccountDAODatabase(db)
+	tokens := NewAccountTokenDAODatabase(db)
+	mail := mailer.NewFromEnv()
+	signer := NewTokenSignerFromEnv()
+	verification := NewEmailVerificationService(accounts, tokens, mail, signer)
+	twoFactor := NewTwoFactorService(accounts, NewTwoFactorDAODatabase(db), NewLoginAttemptDAODatabase(db))
+	twoFactor.StepUp = NewStepUpPolicyFromEnv()
+	sessions := NewSessionService(accounts, NewSessionDAODatabase(db))
+	sessions.SecondFactor = twoFactor
+	sessions.Throttle = NewLoginThrottle(accounts, NewLoginAttemptDAODatabase(db), NewAuditLogDatabase(db), tokens, mail, signer)
+	sessions.Throttle.Policy = NewLoginThrottlePolicyFromEnv()
+	passwords := NewPasswordService(accounts, tokens, sessions, mail, signer)
+	apiKeys := NewAPIKeyService(NewAPIKeyDAODatabase(db), signer)
+	orders := NewOrderDAODatabase(db)
+	trades := NewTradeDAODatabase(db)
+	balances := NewBalanceDAODatabase(db)
+	work := NewUnitOfWorkDatabase(db)
+	exchange := NewExchange(orders, trades, balances, work)
+	exchange.Fees.Schedules = NewFeeSchedulesFromEnv()
+	exchange.Fees.AccountID = NewFeeAccountIDFromEnv()
+	work.HouseAccountID = exchange.Fees.AccountID
+	candles := NewCandleService(NewCandleDAODatabase(db), trades)
+	if err := candles.BackfillMarkets(); err != nil {
+		logrus.WithError(err).Error("Error backfilling candles")
+	}
+	exchange.AddTradeListener(candles)
+	tickers := NewTickerService(orders, trades)
+	tickers.MaxAge = tickerMaxAgeFromEnv()
+	exchange.AddBookListener(tickers)
+	stream := NewStreamHub(orders, trades, balances, tickers)
+	exchange.AddTradeListener(stream)
+	exchange.AddBookListener(stream)
+	feed := NewBalanceFeed(balances)
+	exchange.AddBookListener(feed)
+	balanceListeners := BalanceListeners{stream, feed}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go exchange.RunExpirySweeper(ctx, orderExpirySweepIntervalFromEnv())
+	accountService := NewAccountService(accounts, work, tokens, verification, sessions, mail)
 	logrus.Info("Application started")
 
 	app.Post("/signup", func(c *fiber.Ctx) error {
-		return handleSignup(c, db)
+		return handleSignup(c, db, accounts, verification)
+	})
+
+	app.Get("/verify-email", func(c *fiber.Ctx) error {
+		return handleVerifyEmail(c, verification)
+	})
+
+	app.Post("/verify-email/resend", func(c *fiber.Ctx) error {
+		return handleResendVerification(c, verification)
+	})
+
+	app.Post("/login", func(c *fiber.Ctx) error {
+		return handleLogin(c, sessions)
+	})
+
+	app.Get("/login/unlock", func(c *fiber.Ctx) error {
+		return handleUnlockLogin(c, sessions.Throttle)
 	})
 
-	app.Get("/accounts/:accountId", func(c *fiber.Ctx) error {
+	app.Post("/password/forgot", func(c *fiber.Ctx) error {
+		return handleForgotPassword(c, passwords)
+	})
+
+	app.Post("/password/reset", func(c *fiber.Ctx) error {
+		return handleResetPassword(c, passwords)
+	})
+
+	app.Post("/password/change", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleChangePassword(c, passwords)
+	})
+
+	app.Post("/2fa/enroll", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleEnrollTwoFactor(c, twoFactor)
+	})
+
+	app.Post("/2fa/confirm", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleConfirmTwoFactor(c, twoFactor)
+	})
+
+	app.Post("/2fa/disable", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleDisableTwoFactor(c, twoFactor)
+	})
+
+	// API keys are managed from an interactive session only, a leaked key cannot mint more keys
+	app.Post("/api-keys", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleCreateAPIKey(c, apiKeys)
+	})
+
+	app.Get("/api-keys", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleListAPIKeys(c, apiKeys)
+	})
+
+	app.Delete("/api-keys/:keyId", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleRevokeAPIKey(c, apiKeys)
+	})
+
+	app.Get("/accounts/:accountId", RequireAuthentication(sessions, apiKeys, APIKeyScopeRead), func(c *fiber.Ctx) error {
 		return handleGetAccount(c, db)
 	})
 
-	app.Post("/deposit", func(c *fiber.Ctx) error {
-		return handleDeposit(c, db)
+	app.Patch("/accounts/:accountId", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleUpdateAccount(c, accountService)
 	})
 
-	app.Post("/withdraw", func(c *fiber.Ctx) error {
-		return handleWithdraw(c, db)
+	app.Post("/accounts/:accountId/close", RequireSession(sessions), func(c *fiber.Ctx) error {
+		return handleCloseAccount(c, accountService)
 	})
 
+	app.Get("/accounts/:accountId/trades", RequireAuthentication(sessions, apiKeys, APIKeyScopeRead), func(c *fiber.Ctx) error {
+		return handleListAccountTrades(c, exchange)
+	})
+
+	app.Get("/accounts/:accountId/stream", RequireAuthentication(sessions, apiKeys, APIKeyScopeRead), func(c *fiber.Ctx) error {
+		return handleAccountStream(c, feed)
+	})
+
+	app.Get("/trades/:marketId", func(c *fiber.Ctx) error {
+		return handleListMarketTrades(c, exchange)
+	})
+
+	app.Get("/candles/:marketId", func(c *fiber.Ctx) error {
+		return handleListCandles(c, candles)
+	})
+
+	app.Get("/ticker", func(c *fiber.Ctx) error {
+		return handleListTickers(c, tickers)
+	})
+
+	app.Get("/ticker/:marketId", func(c *fiber.Ctx) error {
+		return handleGetTicker(c, tickers)
+	})
+
+	app.Post("/orders", RequireAuthentication(sessions, apiKeys, APIKeyScopeTrade), func(c *fiber.Ctx) error {
+		return handlePlaceOrder(c, exchange)
+	})
+
+	app.Get("/orders", RequireAuthentication(sessions, apiKeys, APIKeyScopeRead), func(c *fiber.Ctx) error {
+		return handleListOrders(c, exchange)
+	})
+
+	app.Get("/orders/:orderId", RequireAuthentication(sessions, apiKeys, APIKeyScopeRead), func(c *fiber.Ctx) error {
+		return handleGetOrder(c, exchange)
+	})
+
+	app.Delete("/orders/:orderId", RequireAuthentication(sessions, apiKeys, APIKeyScopeTrade), func(c *fiber.Ctx) error {
+		return handleCancelOrder(c, exchange)
+	})
+
+	app.Post("/deposit", RequireAuthentication(sessions, apiKeys, APIKeyScopeTrade), func(c *fiber.Ctx) error {
+		return handleDeposit(c, db, work, balanceListeners)
+	})
+
+	app.Post("/withdraw", RequireAuthentication(sessions, apiKeys, APIKeyScopeWithdraw), func(c *fiber.Ctx) error {
+		return handleWithdraw(c, db, balances, twoFactor, balanceListeners)
+	})
+
+	app.Get("/ws", AllowAuthentication(sessions, apiKeys, APIKeyScopeRead), func(c *fiber.Ctx) error {
+		return handleStream(c, stream)
+	})
+
+	go func() {
+		<-ctx.Done()
+		logrus.Info("Shutting down")
+		// Open event streams would keep the server from shutting down
+		feed.Close()
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			logrus.WithError(err).Error("Error shutting down server")
+		}
+	}()
 	if err := app.Listen(":3000"); err != nil {
 		logrus.WithError(err).Error("Error starting server")
 	}
+	// The streams and candles hear about the last orders before the process exits
+	exchange.Flush()
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,7 +19,7 @@ func TestValidateName(t *testing.T) {
 		{"Valid name", "John Doe", true},
 		{"Single word", "John", false},
 		{"Empty string", "", false},
-		{"Three words", "John Doe Smith", false},
+		{"Three words", "John Doe Smith", true},
 		{"Only spaces", "   ", false},
 		{"Name with spaces at ends", " John Doe ", true},
 	}
@@ -214,4 +217,71 @@ func TestIsValidUUID(t *testing.T) {
 			assert.Equal(t, tc.expected, result)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func fieldCodes(t *testing.T, err error) map[string]string {
+	var validation *domainerrors.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	codes := map[string]string{}
+	for _, field := range validation.Fields {
+		codes[field.Field] = field.Code
+	}
+	return codes
+}
+
+func TestValidateSignupRequestCollectsAllErrors(t *testing.T) {
+	// An invalid email must not reach the duplicate check, so no database is needed
+	req := types.SignupRequest{
+		Name:     "Gustavo",
+		Email:    "invalid-email",
+		Document: "12345678901",
+		Password: "Sh0rt",
+	}
+	valid, err := validateSignupRequest(req, nil, nil)
+	assert.False(t, valid)
+	assert.True(t, errors.Is(err, domainerrors.ErrValidationFailed))
+	assert.Equal(t, map[string]string{
+		"name":     "invalid_name",
+		"email":    "invalid_email",
+		"password": "password_too_short",
+		"document": "invalid_document",
+	}, fieldCodes(t, err))
+}
+
+func TestIsDepositValid(t *testing.T) {
+	valid, err := isDepositValid(types.DepositRequest{
+		AccountID: "550e8400-e29b-41d4-a716-446655440000",
+		AssetID:   types.AssetIdBTC,
+		Quantity:  decimal.NewFromInt(10),
+	})
+	assert.True(t, valid)
+	assert.NoError(t, err)
+
+	valid, err = isDepositValid(types.DepositRequest{AssetID: "INVALID", Quantity: decimal.NewFromInt(-1)})
+	assert.False(t, valid)
+	assert.Equal(t, map[string]string{
+		"accountId": "account_id_required",
+		"assetId":   "invalid_asset",
+		"quantity":  "invalid_quantity",
+	}, fieldCodes(t, err))
+}
+
+func TestIsWithdrawValid(t *testing.T) {
+	valid, err := isWithdrawValid(types.WithdrawRequest{
+		AccountID: "550e8400-e29b-41d4-a716-446655440000",
+		AssetID:   types.AssetIdUSD,
+		Quantity:  decimal.Zero,
+	})
+	assert.True(t, valid)
+	assert.NoError(t, err)
+
+	valid, err = isWithdrawValid(types.WithdrawRequest{AccountID: "INVALID", AssetID: "", Quantity: decimal.NewFromInt(-5)})
+	assert.False(t, valid)
+	assert.Equal(t, map[string]string{
+		"accountId": "invalid_account_id",
+		"assetId":   "invalid_asset",
+		"quantity":  "invalid_quantity",
+	}, fieldCodes(t, err))
+}
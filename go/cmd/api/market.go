@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Market is a pair traded on the exchange. Quantities are in the base asset and
+// prices in the quote asset per unit of base.
+type Market struct {
+	MarketID string
+	Base     types.AssetId
+	Quote    types.AssetId
+	// LotSize is the smallest base quantity step an order can trade
+	LotSize decimal.Decimal
+	// TickSize is the smallest price step of a limit order
+	TickSize decimal.Decimal
+}
+
+var DefaultMarkets = map[string]Market{
+	"BTC-USD": {
+		MarketID: "BTC-USD",
+		Base:     types.AssetIdBTC,
+		Quote:    types.AssetIdUSD,
+		LotSize:  decimal.RequireFromString("0.0001"),
+		TickSize: decimal.RequireFromString("0.01"),
+	},
+}
+
+func (m Market) IsLotMultiple(quantity decimal.Decimal) bool {
+	return quantity.Mod(m.LotSize).IsZero()
+}
+
+func (m Market) IsTickMultiple(price decimal.Decimal) bool {
+	return price.Mod(m.TickSize).IsZero()
+}
+
+// FloorToLot rounds quantity down to a whole number of lots
+func (m Market) FloorToLot(quantity decimal.Decimal) decimal.Decimal {
+	return quantity.Div(m.LotSize).Floor().Mul(m.LotSize)
+}
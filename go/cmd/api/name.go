@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+)
+
+// Lowercase connectors that may appear between name parts but never start or end a name
+var nameParticles = map[string]bool{
+	"da": true, "de": true, "di": true, "do": true, "du": true,
+	"das": true, "des": true, "dos": true, "e": true,
+	"del": true, "della": true, "van": true, "von": true,
+}
+
+// NamePolicy holds the configurable limits for account names, measured in characters
+type NamePolicy struct {
+	MinLength int
+	MaxLength int
+}
+
+var DefaultNamePolicy = NamePolicy{MinLength: 3, MaxLength: 100}
+
+// NewNamePolicyFromEnv reads NAME_MIN_LENGTH and NAME_MAX_LENGTH, keeping the defaults for unset or invalid values
+func NewNamePolicyFromEnv() NamePolicy {
+	policy := DefaultNamePolicy
+	if value, err := strconv.Atoi(os.Getenv("NAME_MIN_LENGTH")); err == nil && value > 0 {
+		policy.MinLength = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("NAME_MAX_LENGTH")); err == nil && value >= policy.MinLength {
+		policy.MaxLength = value
+	}
+	return policy
+}
+
+// Name is a person's full name with whitespace trimmed and collapsed
+type Name struct {
+	value string
+}
+
+func NewName(raw string) (Name, error) {
+	return DefaultNamePolicy.Parse(raw)
+}
+
+// Parse normalizes raw and checks it has a first and last name made of letters,
+// apostrophes and hyphens, optionally joined by particles such as "da" or "dos"
+func (p NamePolicy) Parse(raw string) (Name, error) {
+	parts := strings.Fields(raw)
+	normalized := strings.Join(parts, " ")
+	length := utf8.RuneCountInString(normalized)
+	if length < p.MinLength {
+		return Name{}, domainerrors.ErrNameTooShort
+	}
+	if length > p.MaxLength {
+		return Name{}, domainerrors.ErrNameTooLong
+	}
+	if len(parts) < 2 || nameParticles[parts[0]] || nameParticles[parts[len(parts)-1]] {
+		return Name{}, domainerrors.ErrInvalidName
+	}
+	for _, part := range parts {
+		if !isValidNamePart(part) {
+			return Name{}, domainerrors.ErrInvalidName
+		}
+	}
+	return Name{value: normalized}, nil
+}
+
+func (n Name) String() string {
+	return n.value
+}
+
+// isValidNamePart accepts letters (with combining accents) where apostrophes and
+// hyphens only join letters, as in O'Neil, D'Ávila or Ana-Maria
+func isValidNamePart(part string) bool {
+	runes := []rune(part)
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r):
+		case unicode.Is(unicode.Mn, r):
+			if i == 0 {
+				return false
+			}
+		case r == '\'' || r == '’' || r == '-':
+			if i == 0 || i == len(runes)-1 || !unicode.IsLetter(runes[i+1]) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
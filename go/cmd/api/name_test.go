@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewName(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedName  string
+		expectedError error
+	}{
+		{"First and last name", "John Doe", "John Doe", nil},
+		{"Trims and collapses whitespace", "  Maria   da  Silva\tSantos ", "Maria da Silva Santos", nil},
+		{"Particles", "Pedro dos Santos e Silva", "Pedro dos Santos e Silva", nil},
+		{"Accents", "José Conceição", "José Conceição", nil},
+		{"Combining accent", "José Souza", "José Souza", nil},
+		{"Apostrophes", "Shaquille O'Neal", "Shaquille O'Neal", nil},
+		{"Typographic apostrophe", "Joana D’Ávila", "Joana D’Ávila", nil},
+		{"Hyphen", "Ana-Maria Braga", "Ana-Maria Braga", nil},
+		{"Non Latin script", "Владимир Набоков", "Владимир Набоков", nil},
+		{"Single word", "José", "", domainerrors.ErrInvalidName},
+		{"Starts with particle", "da Silva", "", domainerrors.ErrInvalidName},
+		{"Ends with particle", "Maria da", "", domainerrors.ErrInvalidName},
+		{"Digits", "John Doe2", "", domainerrors.ErrInvalidName},
+		{"Leading hyphen", "-Ana Braga", "", domainerrors.ErrInvalidName},
+		{"Double hyphen", "Ana--Maria Braga", "", domainerrors.ErrInvalidName},
+		{"Trailing apostrophe", "John Doe'", "", domainerrors.ErrInvalidName},
+		{"Symbols", "John D@e", "", domainerrors.ErrInvalidName},
+		{"Empty", "", "", domainerrors.ErrNameTooShort},
+		{"Only spaces", "   ", "", domainerrors.ErrNameTooShort},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, err := NewName(tc.input)
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, name.String())
+		})
+	}
+}
+
+func TestNamePolicyLengths(t *testing.T) {
+	policy := NamePolicy{MinLength: 8, MaxLength: 12}
+	_, err := policy.Parse("Al Bo")
+	assert.ErrorIs(t, err, domainerrors.ErrNameTooShort)
+	_, err = policy.Parse("Maria da Silva")
+	assert.ErrorIs(t, err, domainerrors.ErrNameTooLong)
+	name, err := policy.Parse("  Ana   Braga ")
+	assert.NoError(t, err)
+	assert.Equal(t, "Ana Braga", name.String())
+}
+
+func TestNewNamePolicyFromEnv(t *testing.T) {
+	t.Setenv("NAME_MIN_LENGTH", "5")
+	t.Setenv("NAME_MAX_LENGTH", "60")
+	assert.Equal(t, NamePolicy{MinLength: 5, MaxLength: 60}, NewNamePolicyFromEnv())
+
+	t.Setenv("NAME_MIN_LENGTH", "invalid")
+	t.Setenv("NAME_MAX_LENGTH", "1")
+	assert.Equal(t, DefaultNamePolicy, NewNamePolicyFromEnv())
+}
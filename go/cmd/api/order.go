@@ -0,0 +1,141 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	OrderSideBuy  = "buy"
+	OrderSideSell = "sell"
+)
+
+const (
+	OrderTypeLimit  = "limit"
+	OrderTypeMarket = "market"
+	// OrderTypeStop becomes a market order once triggered
+	OrderTypeStop = "stop"
+	// OrderTypeStopLimit becomes a limit order once triggered
+	OrderTypeStopLimit = "stop_limit"
+)
+
+// Time in force says how long an order may rest on the book
+const (
+	// TimeInForceGTC rests until filled or cancelled
+	TimeInForceGTC = "GTC"
+	// TimeInForceIOC fills what it can right away and cancels the remainder
+	TimeInForceIOC = "IOC"
+	// TimeInForceFOK fills entirely right away or not at all
+	TimeInForceFOK = "FOK"
+	// TimeInForceGTD rests until filled, cancelled or ExpiresAt
+	TimeInForceGTD = "GTD"
+)
+
+const (
+	OrderStatusOpen      = "open"
+	OrderStatusFilled    = "filled"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusExpired   = "expired"
+	// OrderStatusPending is a stop order waiting for its trigger, off the book
+	OrderStatusPending = "pending"
+)
+
+// Order is an instruction to trade on a market. Market orders never rest on the book.
+type Order struct {
+	OrderID   string
+	MarketID  string
+	AccountID string
+	Side      string
+	Type      string
+	// Quantity is in the base asset. Market orders placed by quote quantity get
+	// the base quantity they filled once matched.
+	Quantity decimal.Decimal
+	// Price is the limit price, zero for market orders. Stop orders keep their
+	// worst price here, zero when unguarded.
+	Price decimal.Decimal
+	// QuoteQuantity is how much quote asset a market order spends (buy) or receives (sell)
+	QuoteQuantity decimal.Decimal
+	FillQuantity  decimal.Decimal
+	// FillPrice is the average price of the fills
+	FillPrice decimal.Decimal
+	Status    string
+	Timestamp time.Time
+	// TimeInForce is one of the TimeInForce constants, market orders are always FOK
+	TimeInForce string
+	// PostOnly orders are rejected rather than take liquidity from the book
+	PostOnly bool
+	// ExpiresAt is when a GTD order leaves the book
+	ExpiresAt *time.Time
+	// StopPrice is the last trade price that triggers a stop order
+	StopPrice   decimal.Decimal
+	TriggeredAt *time.Time
+}
+
+func (o *Order) Remaining() decimal.Decimal {
+	return o.Quantity.Sub(o.FillQuantity)
+}
+
+func (o *Order) IsBuy() bool {
+	return o.Side == OrderSideBuy
+}
+
+// isMarket tells whether the order fills completely on arrival or not at all
+func (o *Order) isMarket() bool {
+	return o.Type == OrderTypeMarket || o.Type == OrderTypeStop
+}
+
+// isTriggeredBy tells whether a trade at price sets off a stop order: buy stops
+// trigger at or above their stop price, sell stops at or below it
+func (o *Order) isTriggeredBy(price decimal.Decimal) bool {
+	if o.IsBuy() {
+		return price.GreaterThanOrEqual(o.StopPrice)
+	}
+	return price.LessThanOrEqual(o.StopPrice)
+}
+
+// IsExpired tells whether a GTD order outlived its expiry, even if not swept yet
+func (o *Order) IsExpired(at time.Time) bool {
+	return o.ExpiresAt != nil && !at.Before(*o.ExpiresAt)
+}
+
+// fill records a trade of quantity at price and keeps FillPrice the weighted average
+func (o *Order) fill(quantity, price decimal.Decimal) {
+	total := o.FillQuantity.Add(quantity)
+	o.FillPrice = o.FillPrice.Mul(o.FillQuantity).Add(price.Mul(quantity)).Div(total)
+	o.FillQuantity = total
+	if o.Remaining().IsZero() {
+		o.Status = OrderStatusFilled
+	}
+}
+
+// Trade is a match between a buy and a sell order at the resting order's price
+type Trade struct {
+	TradeID     string
+	MarketID    string
+	BuyOrderID  string
+	SellOrderID string
+	// Side is the side of the taker, the order that arrived last
+	Side          string
+	Quantity      decimal.Decimal
+	Price         decimal.Decimal
+	Timestamp     time.Time
+	BuyAccountID  string
+	SellAccountID string
+	// Fees are charged in the asset each side receives
+	MakerFee      decimal.Decimal
+	MakerFeeAsset types.AssetId
+	TakerFee      decimal.Decimal
+	TakerFeeAsset types.AssetId
+	// Sequence is assigned when the trade is saved and orders trades of the same instant
+	Sequence int64
+}
+
+// feeOf returns the fee the order on side paid on the trade, and whether it was the maker
+func (t Trade) feeOf(side string) (decimal.Decimal, types.AssetId, bool) {
+	if side == t.Side {
+		return t.TakerFee, t.TakerFeeAsset, false
+	}
+	return t.MakerFee, t.MakerFeeAsset, true
+}
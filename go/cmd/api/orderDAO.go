@@ -0,0 +1,465 @@
+package main
+
+import (
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// IOrderDAO defines the interface for order data access operations
+type IOrderDAO interface {
+	Save(order *Order) error
+	Update(order *Order) error
+	GetByID(orderID string) (*Order, error)
+	// ListOpen returns the resting orders of a market, oldest first
+	ListOpen(marketID string) ([]Order, error)
+	// ListByAccount returns the orders of an account, newest first
+	ListByAccount(accountID string) ([]Order, error)
+	// ListPending returns the stop orders of a market waiting for their trigger, oldest first
+	ListPending(marketID string) ([]Order, error)
+	// ListExpired returns the open and pending orders whose expiry is at or before at
+	ListExpired(at time.Time) ([]Order, error)
+}
+
+// OrderDAODatabase implements IOrderDAO using PostgreSQL database
+type OrderDAODatabase struct {
+	db querier
+}
+
+func NewOrderDAODatabase(db *Database) *OrderDAODatabase {
+	return &OrderDAODatabase{db: db.DB}
+}
+
+const orderColumns = "order_id, market_id, account_id, side, type, quantity, price, quote_quantity, fill_quantity, fill_price, status, timestamp, time_in_force, post_only, expires_at, stop_price, triggered_at"
+
+func (dao *OrderDAODatabase) Save(order *Order) error {
+	query := "INSERT INTO ccca.order (" + orderColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)"
+	_, err := dao.db.Exec(query, order.OrderID, order.MarketID, order.AccountID, order.Side, order.Type, order.Quantity, order.Price, order.QuoteQuantity, order.FillQuantity, order.FillPrice, order.Status, order.Timestamp, order.TimeInForce, order.PostOnly, order.ExpiresAt, order.StopPrice, order.TriggeredAt)
+	return err
+}
+
+func (dao *OrderDAODatabase) Update(order *Order) error {
+	query := "UPDATE ccca.order SET quantity = $1, fill_quantity = $2, fill_price = $3, status = $4, triggered_at = $5 WHERE order_id = $6"
+	_, err := dao.db.Exec(query, order.Quantity, order.FillQuantity, order.FillPrice, order.Status, order.TriggeredAt, order.OrderID)
+	return err
+}
+
+func scanOrder(row interface{ Scan(...any) error }) (*Order, error) {
+	order := &Order{}
+	err := row.Scan(&order.OrderID, &order.MarketID, &order.AccountID, &order.Side, &order.Type, &order.Quantity, &order.Price, &order.QuoteQuantity, &order.FillQuantity, &order.FillPrice, &order.Status, &order.Timestamp, &order.TimeInForce, &order.PostOnly, &order.ExpiresAt, &order.StopPrice, &order.TriggeredAt)
+	return order, err
+}
+
+func (dao *OrderDAODatabase) GetByID(orderID string) (*Order, error) {
+	order, err := scanOrder(dao.db.QueryRow("SELECT "+orderColumns+" FROM ccca.order WHERE order_id = $1", orderID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return order, err
+}
+
+func (dao *OrderDAODatabase) list(query string, args ...any) ([]Order, error) {
+	rows, err := dao.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+	return orders, rows.Err()
+}
+
+func (dao *OrderDAODatabase) ListOpen(marketID string) ([]Order, error) {
+	return dao.list("SELECT "+orderColumns+" FROM ccca.order WHERE market_id = $1 AND status = $2 ORDER BY timestamp, order_id", marketID, OrderStatusOpen)
+}
+
+func (dao *OrderDAODatabase) ListPending(marketID string) ([]Order, error) {
+	return dao.list("SELECT "+orderColumns+" FROM ccca.order WHERE market_id = $1 AND status = $2 ORDER BY timestamp, order_id", marketID, OrderStatusPending)
+}
+
+func (dao *OrderDAODatabase) ListByAccount(accountID string) ([]Order, error) {
+	return dao.list("SELECT "+orderColumns+" FROM ccca.order WHERE account_id = $1 ORDER BY timestamp DESC, order_id", accountID)
+}
+
+func (dao *OrderDAODatabase) ListExpired(at time.Time) ([]Order, error) {
+	return dao.list("SELECT "+orderColumns+" FROM ccca.order WHERE status IN ($1, $2) AND expires_at <= $3 ORDER BY expires_at, order_id", OrderStatusOpen, OrderStatusPending, at)
+}
+
+// OrderDAOMemory implements IOrderDAO using in-memory storage
+type OrderDAOMemory struct {
+	mu     sync.Mutex
+	orders map[string]*Order
+	// sequence keeps insertion order for orders placed at the same instant
+	sequence []string
+}
+
+func NewOrderDAOMemory() *OrderDAOMemory {
+	return &OrderDAOMemory{
+		orders: make(map[string]*Order),
+	}
+}
+
+func (dao *OrderDAOMemory) Save(order *Order) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	stored := *order
+	dao.orders[order.OrderID] = &stored
+	dao.sequence = append(dao.sequence, order.OrderID)
+	return nil
+}
+
+func (dao *OrderDAOMemory) Update(order *Order) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	if _, exists := dao.orders[order.OrderID]; exists {
+		stored := *order
+		dao.orders[order.OrderID] = &stored
+	}
+	return nil
+}
+
+func (dao *OrderDAOMemory) GetByID(orderID string) (*Order, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	order, exists := dao.orders[orderID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (dao *OrderDAOMemory) ListOpen(marketID string) ([]Order, error) {
+	return dao.listByStatus(marketID, OrderStatusOpen), nil
+}
+
+func (dao *OrderDAOMemory) ListPending(marketID string) ([]Order, error) {
+	return dao.listByStatus(marketID, OrderStatusPending), nil
+}
+
+func (dao *OrderDAOMemory) listByStatus(marketID, status string) []Order {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	orders := []Order{}
+	for _, orderID := range dao.sequence {
+		order := dao.orders[orderID]
+		if order.MarketID == marketID && order.Status == status {
+			orders = append(orders, *order)
+		}
+	}
+	slices.SortStableFunc(orders, func(a, b Order) int { return a.Timestamp.Compare(b.Timestamp) })
+	return orders
+}
+
+func (dao *OrderDAOMemory) ListByAccount(accountID string) ([]Order, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	orders := []Order{}
+	for i := len(dao.sequence) - 1; i >= 0; i-- {
+		order := dao.orders[dao.sequence[i]]
+		if order.AccountID == accountID {
+			orders = append(orders, *order)
+		}
+	}
+	slices.SortStableFunc(orders, func(a, b Order) int { return b.Timestamp.Compare(a.Timestamp) })
+	return orders, nil
+}
+
+func (dao *OrderDAOMemory) ListExpired(at time.Time) ([]Order, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	orders := []Order{}
+	for _, orderID := range dao.sequence {
+		order := dao.orders[orderID]
+		if (order.Status == OrderStatusOpen || order.Status == OrderStatusPending) && order.IsExpired(at) {
+			orders = append(orders, *order)
+		}
+	}
+	slices.SortStableFunc(orders, func(a, b Order) int { return a.ExpiresAt.Compare(*b.ExpiresAt) })
+	return orders, nil
+}
+
+// ITradeDAO defines the interface for trade data access operations
+type ITradeDAO interface {
+	Save(trade *Trade) error
+	// ListByOrder returns the trades an order took part in, oldest first
+	ListByOrder(orderID string) ([]Trade, error)
+	// Last returns the latest trade of a market, nil when it never traded
+	Last(marketID string) (*Trade, error)
+	// VolumeSince sums the quote value of the trades of an account in a market from since on
+	VolumeSince(accountID, marketID string, since time.Time) (decimal.Decimal, error)
+	// ListByMarket returns up to limit trades of a market older than before, newest first.
+	// A nil before starts from the latest trade.
+	ListByMarket(marketID string, before *TradeCursor, limit int) ([]Trade, error)
+	// ListByAccount returns up to limit trades an account took part in older than before, newest first
+	ListByAccount(accountID string, before *TradeCursor, limit int) ([]Trade, error)
+	// ListRange returns the trades of a market from from up to but excluding to, in trade sequence
+	ListRange(marketID string, from, to time.Time) ([]Trade, error)
+	// First returns the earliest trade of a market, nil when it never traded
+	First(marketID string) (*Trade, error)
+	// SummarySince aggregates the trades of a market from since on
+	SummarySince(marketID string, since time.Time) (TradeSummary, error)
+}
+
+// TradeSummary aggregates the trades of a market over a window. Open, High and Low
+// are only meaningful when Count is not zero.
+type TradeSummary struct {
+	Count int
+	// Open is the price of the first trade of the window
+	Open        decimal.Decimal
+	High        decimal.Decimal
+	Low         decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
+}
+
+// TradeCursor is the position of a trade in the newest first order of trade listings
+type TradeCursor struct {
+	Timestamp time.Time
+	Sequence  int64
+}
+
+// isAfter tells whether trade comes after the cursor in newest first order
+func (c *TradeCursor) isAfter(trade Trade) bool {
+	if c == nil {
+		return true
+	}
+	if !trade.Timestamp.Equal(c.Timestamp) {
+		return trade.Timestamp.Before(c.Timestamp)
+	}
+	return trade.Sequence < c.Sequence
+}
+
+// TradeDAODatabase implements ITradeDAO using PostgreSQL database
+type TradeDAODatabase struct {
+	db querier
+}
+
+func NewTradeDAODatabase(db *Database) *TradeDAODatabase {
+	return &TradeDAODatabase{db: db.DB}
+}
+
+const tradeColumns = "trade_id, market_id, buy_order_id, sell_order_id, side, quantity, price, timestamp, buy_account_id, sell_account_id, maker_fee, maker_fee_asset, taker_fee, taker_fee_asset"
+
+func (dao *TradeDAODatabase) Save(trade *Trade) error {
+	query := "INSERT INTO ccca.trade (" + tradeColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING sequence"
+	return dao.db.QueryRow(query, trade.TradeID, trade.MarketID, trade.BuyOrderID, trade.SellOrderID, trade.Side, trade.Quantity, trade.Price, trade.Timestamp, trade.BuyAccountID, trade.SellAccountID, trade.MakerFee, trade.MakerFeeAsset, trade.TakerFee, trade.TakerFeeAsset).Scan(&trade.Sequence)
+}
+
+func scanTrade(row interface{ Scan(...any) error }) (*Trade, error) {
+	trade := &Trade{}
+	err := row.Scan(&trade.TradeID, &trade.MarketID, &trade.BuyOrderID, &trade.SellOrderID, &trade.Side, &trade.Quantity, &trade.Price, &trade.Timestamp, &trade.BuyAccountID, &trade.SellAccountID, &trade.MakerFee, &trade.MakerFeeAsset, &trade.TakerFee, &trade.TakerFeeAsset, &trade.Sequence)
+	return trade, err
+}
+
+func (dao *TradeDAODatabase) ListByOrder(orderID string) ([]Trade, error) {
+	return dao.list("SELECT "+tradeColumns+", sequence FROM ccca.trade WHERE buy_order_id = $1 OR sell_order_id = $1 ORDER BY sequence", orderID)
+}
+
+func (dao *TradeDAODatabase) list(query string, args ...any) ([]Trade, error) {
+	rows, err := dao.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	trades := []Trade{}
+	for rows.Next() {
+		trade, err := scanTrade(rows)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, *trade)
+	}
+	return trades, rows.Err()
+}
+
+func (dao *TradeDAODatabase) Last(marketID string) (*Trade, error) {
+	trade, err := scanTrade(dao.db.QueryRow("SELECT "+tradeColumns+", sequence FROM ccca.trade WHERE market_id = $1 ORDER BY sequence DESC LIMIT 1", marketID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return trade, err
+}
+
+func (dao *TradeDAODatabase) First(marketID string) (*Trade, error) {
+	trade, err := scanTrade(dao.db.QueryRow("SELECT "+tradeColumns+", sequence FROM ccca.trade WHERE market_id = $1 ORDER BY sequence LIMIT 1", marketID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return trade, err
+}
+
+func (dao *TradeDAODatabase) ListRange(marketID string, from, to time.Time) ([]Trade, error) {
+	return dao.list("SELECT "+tradeColumns+", sequence FROM ccca.trade WHERE market_id = $1 AND timestamp >= $2 AND timestamp < $3 ORDER BY sequence", marketID, from, to)
+}
+
+func (dao *TradeDAODatabase) VolumeSince(accountID, marketID string, since time.Time) (decimal.Decimal, error) {
+	query := "SELECT COALESCE(sum(quantity * price), 0) FROM ccca.trade WHERE market_id = $1 AND (buy_account_id = $2 OR sell_account_id = $2) AND timestamp >= $3"
+	var volume decimal.Decimal
+	err := dao.db.QueryRow(query, marketID, accountID, since).Scan(&volume)
+	return volume, err
+}
+
+func (dao *TradeDAODatabase) SummarySince(marketID string, since time.Time) (TradeSummary, error) {
+	query := "SELECT count(*), (array_agg(price ORDER BY sequence))[1], max(price), min(price), COALESCE(sum(quantity), 0), COALESCE(sum(quantity * price), 0) FROM ccca.trade WHERE market_id = $1 AND timestamp >= $2"
+	var summary TradeSummary
+	var open, high, low decimal.NullDecimal
+	err := dao.db.QueryRow(query, marketID, since).Scan(&summary.Count, &open, &high, &low, &summary.Volume, &summary.QuoteVolume)
+	summary.Open, summary.High, summary.Low = open.Decimal, high.Decimal, low.Decimal
+	return summary, err
+}
+
+// cursorArgs turns a cursor into the bounds of a keyset query, the far future when it is nil
+func cursorArgs(before *TradeCursor) (time.Time, int64) {
+	if before == nil {
+		return time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), 0
+	}
+	return before.Timestamp, before.Sequence
+}
+
+func (dao *TradeDAODatabase) ListByMarket(marketID string, before *TradeCursor, limit int) ([]Trade, error) {
+	timestamp, sequence := cursorArgs(before)
+	query := "SELECT " + tradeColumns + ", sequence FROM ccca.trade WHERE market_id = $1 AND (timestamp < $2 OR (timestamp = $2 AND ($3 = 0 OR sequence < $3))) ORDER BY timestamp DESC, sequence DESC LIMIT $4"
+	return dao.list(query, marketID, timestamp, sequence, limit)
+}
+
+func (dao *TradeDAODatabase) ListByAccount(accountID string, before *TradeCursor, limit int) ([]Trade, error) {
+	timestamp, sequence := cursorArgs(before)
+	query := "SELECT " + tradeColumns + ", sequence FROM ccca.trade WHERE (buy_account_id = $1 OR sell_account_id = $1) AND (timestamp < $2 OR (timestamp = $2 AND ($3 = 0 OR sequence < $3))) ORDER BY timestamp DESC, sequence DESC LIMIT $4"
+	return dao.list(query, accountID, timestamp, sequence, limit)
+}
+
+// TradeDAOMemory implements ITradeDAO using in-memory storage
+type TradeDAOMemory struct {
+	mu     sync.Mutex
+	trades []Trade
+}
+
+func NewTradeDAOMemory() *TradeDAOMemory {
+	return &TradeDAOMemory{}
+}
+
+func (dao *TradeDAOMemory) Save(trade *Trade) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	trade.Sequence = int64(len(dao.trades) + 1)
+	dao.trades = append(dao.trades, *trade)
+	return nil
+}
+
+func (dao *TradeDAOMemory) ListByOrder(orderID string) ([]Trade, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	trades := []Trade{}
+	for _, trade := range dao.trades {
+		if trade.BuyOrderID == orderID || trade.SellOrderID == orderID {
+			trades = append(trades, trade)
+		}
+	}
+	return trades, nil
+}
+
+func (dao *TradeDAOMemory) Last(marketID string) (*Trade, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for i := len(dao.trades) - 1; i >= 0; i-- {
+		if dao.trades[i].MarketID == marketID {
+			trade := dao.trades[i]
+			return &trade, nil
+		}
+	}
+	return nil, nil
+}
+
+func (dao *TradeDAOMemory) VolumeSince(accountID, marketID string, since time.Time) (decimal.Decimal, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	volume := decimal.Zero
+	for _, trade := range dao.trades {
+		if trade.MarketID == marketID && (trade.BuyAccountID == accountID || trade.SellAccountID == accountID) && !trade.Timestamp.Before(since) {
+			volume = volume.Add(trade.Quantity.Mul(trade.Price))
+		}
+	}
+	return volume, nil
+}
+
+func (dao *TradeDAOMemory) SummarySince(marketID string, since time.Time) (TradeSummary, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	summary := TradeSummary{Volume: decimal.Zero, QuoteVolume: decimal.Zero}
+	for _, trade := range dao.trades {
+		if trade.MarketID != marketID || trade.Timestamp.Before(since) {
+			continue
+		}
+		if summary.Count == 0 {
+			summary.Open, summary.High, summary.Low = trade.Price, trade.Price, trade.Price
+		}
+		summary.Count++
+		summary.High = decimal.Max(summary.High, trade.Price)
+		summary.Low = decimal.Min(summary.Low, trade.Price)
+		summary.Volume = summary.Volume.Add(trade.Quantity)
+		summary.QuoteVolume = summary.QuoteVolume.Add(trade.Quantity.Mul(trade.Price))
+	}
+	return summary, nil
+}
+
+func (dao *TradeDAOMemory) ListByMarket(marketID string, before *TradeCursor, limit int) ([]Trade, error) {
+	return dao.newestFirst(func(trade Trade) bool { return trade.MarketID == marketID }, before, limit), nil
+}
+
+func (dao *TradeDAOMemory) ListByAccount(accountID string, before *TradeCursor, limit int) ([]Trade, error) {
+	return dao.newestFirst(func(trade Trade) bool { return trade.BuyAccountID == accountID || trade.SellAccountID == accountID }, before, limit), nil
+}
+
+func (dao *TradeDAOMemory) newestFirst(match func(Trade) bool, before *TradeCursor, limit int) []Trade {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	trades := []Trade{}
+	for _, trade := range dao.trades {
+		if match(trade) && before.isAfter(trade) {
+			trades = append(trades, trade)
+		}
+	}
+	slices.SortFunc(trades, func(a, b Trade) int {
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return b.Timestamp.Compare(a.Timestamp)
+		}
+		return int(b.Sequence - a.Sequence)
+	})
+	if len(trades) > limit {
+		trades = trades[:limit]
+	}
+	return trades
+}
+
+func (dao *TradeDAOMemory) First(marketID string) (*Trade, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for _, trade := range dao.trades {
+		if trade.MarketID == marketID {
+			return &trade, nil
+		}
+	}
+	return nil, nil
+}
+
+func (dao *TradeDAOMemory) ListRange(marketID string, from, to time.Time) ([]Trade, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	trades := []Trade{}
+	for _, trade := range dao.trades {
+		if trade.MarketID == marketID && !trade.Timestamp.Before(from) && trade.Timestamp.Before(to) {
+			trades = append(trades, trade)
+		}
+	}
+	return trades, nil
+}
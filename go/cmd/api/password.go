@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/sirupsen/logrus"
+)
+
+// PasswordCharacterClass is a kind of character a password may be required to contain
+type PasswordCharacterClass string
+
+const (
+	PasswordClassLower  PasswordCharacterClass = "lower"
+	PasswordClassUpper  PasswordCharacterClass = "upper"
+	PasswordClassDigit  PasswordCharacterClass = "digit"
+	PasswordClassSymbol PasswordCharacterClass = "symbol"
+)
+
+var passwordClassErrors = map[PasswordCharacterClass]error{
+	PasswordClassLower:  domainerrors.ErrPasswordMissingLowercase,
+	PasswordClassUpper:  domainerrors.ErrPasswordMissingUppercase,
+	PasswordClassDigit:  domainerrors.ErrPasswordMissingDigit,
+	PasswordClassSymbol: domainerrors.ErrPasswordMissingSymbol,
+}
+
+func (c PasswordCharacterClass) matches(r rune) bool {
+	switch c {
+	case PasswordClassLower:
+		return unicode.IsLower(r)
+	case PasswordClassUpper:
+		return unicode.IsUpper(r)
+	case PasswordClassDigit:
+		return unicode.IsDigit(r)
+	case PasswordClassSymbol:
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	}
+	return false
+}
+
+// BreachedPasswords tells whether a password appeared in a known data breach
+type BreachedPasswords interface {
+	IsBreached(password string) (bool, error)
+}
+
+// PasswordPolicy holds the configurable rules for account passwords, lengths measured in characters
+type PasswordPolicy struct {
+	MinLength       int
+	MaxLength       int
+	RequiredClasses []PasswordCharacterClass
+	// MinScore is the lowest accepted PasswordScore, 0 disables the strength check
+	MinScore int
+	// Breached is optional, nil disables the breach check
+	Breached BreachedPasswords
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:       8,
+	MaxLength:       128,
+	RequiredClasses: []PasswordCharacterClass{PasswordClassLower, PasswordClassUpper, PasswordClassDigit},
+	MinScore:        2,
+}
+
+// NewPasswordPolicyFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_REQUIRED_CLASSES
+// (comma separated lower, upper, digit and symbol), PASSWORD_MIN_SCORE and PASSWORD_BREACH_DIR,
+// keeping the defaults for unset or invalid values
+func NewPasswordPolicyFromEnv() PasswordPolicy {
+	policy := DefaultPasswordPolicy
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && value > 0 {
+		policy.MinLength = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && value >= policy.MinLength {
+		policy.MaxLength = value
+	}
+	if value, ok := os.LookupEnv("PASSWORD_REQUIRED_CLASSES"); ok {
+		policy.RequiredClasses = nil
+		for _, class := range strings.Split(value, ",") {
+			class := PasswordCharacterClass(strings.ToLower(strings.TrimSpace(class)))
+			if _, known := passwordClassErrors[class]; known {
+				policy.RequiredClasses = append(policy.RequiredClasses, class)
+			} else if class != "" {
+				logrus.WithField("class", class).Warn("Ignoring unknown password character class")
+			}
+		}
+	}
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_SCORE")); err == nil && value >= 0 && value <= 4 {
+		policy.MinScore = value
+	}
+	if dir := os.Getenv("PASSWORD_BREACH_DIR"); dir != "" {
+		policy.Breached = &BreachedPasswordDirectory{Dir: dir}
+	}
+	return policy
+}
+
+// PasswordUserInputs is what the password must not be built from
+type PasswordUserInputs struct {
+	Name  string
+	Email string
+}
+
+// Check returns every rule password breaks, or nil when it is acceptable
+func (p PasswordPolicy) Check(password string, inputs PasswordUserInputs) []error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return append([]error{domainerrors.ErrPasswordTooShort}, p.checkClasses(password)...)
+	}
+	if length > p.MaxLength {
+		return []error{domainerrors.ErrPasswordTooLong}
+	}
+	failures := p.checkClasses(password)
+	if containsPersonalInfo(password, inputs) {
+		failures = append(failures, domainerrors.ErrPasswordContainsPersonalInfo)
+	}
+	if p.MinScore > 0 && PasswordScore(password) < p.MinScore {
+		failures = append(failures, domainerrors.ErrPasswordTooWeak)
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			// Same as the MX check, an unavailable list should not block signups
+			logrus.WithError(err).Warn("Breached password lookup failed, accepting password")
+		}
+		if breached {
+			failures = append(failures, domainerrors.ErrPasswordBreached)
+		}
+	}
+	return failures
+}
+
+func (p PasswordPolicy) checkClasses(password string) []error {
+	var failures []error
+	for _, class := range p.RequiredClasses {
+		if !strings.ContainsFunc(password, class.matches) {
+			failures = append(failures, passwordClassErrors[class])
+		}
+	}
+	return failures
+}
+
+// containsPersonalInfo reports whether password contains a part of the name or of
+// the email local part with at least three characters, ignoring case
+func containsPersonalInfo(password string, inputs PasswordUserInputs) bool {
+	lower := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(inputs.Email, "@")
+	parts := strings.Fields(inputs.Name)
+	parts = append(parts, localPart)
+	parts = append(parts, strings.FieldsFunc(localPart, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})...)
+	for _, part := range parts {
+		part = strings.ToLower(part)
+		if utf8.RuneCountInString(part) >= 3 && !nameParticles[part] && strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// BreachedPasswordDirectory looks passwords up in a local copy of a breached password
+// list in the k-anonymity range format used by Have I Been Pwned: one file per
+// five character SHA-1 prefix, holding "SUFFIX:COUNT" lines for the remaining 35 characters.
+type BreachedPasswordDirectory struct {
+	Dir string
+}
+
+func (d *BreachedPasswordDirectory) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(d.Dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(d.Dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// No breached password shares this prefix
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		candidate, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padded ranges list fake suffixes with a zero count
+		if strings.EqualFold(candidate, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
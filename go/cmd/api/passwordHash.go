@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const passwordHashScheme = "pbkdf2-sha256"
+
+// Iteration count recommended by OWASP for PBKDF2-HMAC-SHA256
+var passwordHashIterations = 600000
+
+// HashPassword derives a salted hash in the form pbkdf2-sha256$<iterations>$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIterations, encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+// CheckPassword compares password with a stored hash in constant time. Accounts
+// created before passwords were hashed still hold the plain password, which is
+// accepted here so the caller can rehash it with NeedsRehash.
+func CheckPassword(stored, password string) bool {
+	if !strings.HasPrefix(stored, passwordHashScheme+"$") {
+		return stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// NeedsRehash reports whether stored is a plain password or uses fewer iterations than today
+func NeedsRehash(stored string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return true
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	return err != nil || iterations < passwordHashIterations
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	// Keep hashing cheap in tests, the format and checks do not depend on the count
+	passwordHashIterations = 1000
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("Vq7!mZt2Lp9x")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "pbkdf2-sha256$1000$"))
+	assert.NotContains(t, hash, "Vq7!mZt2Lp9x")
+
+	other, err := HashPassword("Vq7!mZt2Lp9x")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other, "every hash must use a fresh salt")
+
+	assert.True(t, CheckPassword(hash, "Vq7!mZt2Lp9x"))
+	assert.False(t, CheckPassword(hash, "vq7!mZt2Lp9x"))
+	assert.False(t, NeedsRehash(hash))
+}
+
+func TestCheckPasswordLegacyAndMalformed(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stored   string
+		password string
+		expected bool
+	}{
+		{"Legacy plain password", "SecurePassword1234", "SecurePassword1234", true},
+		{"Legacy plain password mismatch", "SecurePassword1234", "securepassword1234", false},
+		{"Empty stored password", "", "", false},
+		{"Missing parts", "pbkdf2-sha256$1000$c2FsdA", "password", false},
+		{"Invalid iterations", "pbkdf2-sha256$abc$c2FsdA$a2V5", "password", false},
+		{"Invalid salt", "pbkdf2-sha256$1000$***$a2V5", "password", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, CheckPassword(tc.stored, tc.password))
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	assert.True(t, NeedsRehash("SecurePassword1234"))
+	assert.True(t, NeedsRehash("pbkdf2-sha256$999$c2FsdA$a2V5"))
+	assert.False(t, NeedsRehash("pbkdf2-sha256$1000$c2FsdA$a2V5"))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/sirupsen/logrus"
+)
+
+// PasswordService resets forgotten passwords and changes known ones, ending every session on success
+type PasswordService struct {
+	accounts IAccountDAO
+	tokens   IAccountTokenDAO
+	sessions *SessionService
+	mailer   mailer.Mailer
+	signer   *TokenSigner
+
+	Now          func() time.Time
+	ResetURL     string
+	TokenTTL     time.Duration
+	ResendWindow time.Duration
+	ResendLimit  int
+}
+
+func NewPasswordService(accounts IAccountDAO, tokens IAccountTokenDAO, sessions *SessionService, m mailer.Mailer, signer *TokenSigner) *PasswordService {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+	return &PasswordService{
+		accounts:     accounts,
+		tokens:       tokens,
+		sessions:     sessions,
+		mailer:       m,
+		signer:       signer,
+		Now:          time.Now,
+		ResetURL:     baseURL + "/password/reset",
+		TokenTTL:     time.Hour,
+		ResendWindow: time.Hour,
+		ResendLimit:  3,
+	}
+}
+
+// Forgot mails a reset link. Unknown emails and rate limited accounts are ignored
+// silently so the endpoint does not reveal which emails exist.
+func (s *PasswordService) Forgot(ctx context.Context, email string) error {
+	account, err := s.accounts.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return nil
+	}
+	now := s.Now()
+	issued, err := s.tokens.CountIssuedSince(account.AccountID, TokenPurposePasswordReset, now.Add(-s.ResendWindow))
+	if err != nil {
+		return err
+	}
+	if issued >= s.ResendLimit {
+		logrus.WithField("accountId", account.AccountID).Warn("Password reset email rate limited")
+		return nil
+	}
+	token, claims := s.signer.Sign(TokenPurposePasswordReset, account.AccountID, now.Add(s.TokenTTL))
+	err = s.tokens.Save(&AccountToken{
+		TokenID:   claims.ID,
+		AccountID: account.AccountID,
+		Purpose:   TokenPurposePasswordReset,
+		CreatedAt: now,
+		ExpiresAt: claims.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	link := s.ResetURL + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      account.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hello %s,\n\nUse the token below to choose a new password:\n\n%s\n\nor open %s\n\nThe token expires in %s. If you did not ask for it, ignore this email.\n", account.Name, token, link, s.TokenTTL),
+	})
+}
+
+// Reset consumes token and replaces the password of the account it was issued for
+func (s *PasswordService) Reset(token, newPassword string) error {
+	claims, err := s.signer.Verify(TokenPurposePasswordReset, token, s.Now())
+	if err != nil {
+		return err
+	}
+	stored, err := s.tokens.GetByID(claims.ID)
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.AccountID != claims.Subject || stored.Purpose != TokenPurposePasswordReset {
+		return domainerrors.ErrInvalidToken
+	}
+	account, err := s.accounts.GetByID(claims.Subject)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return domainerrors.ErrInvalidToken
+	}
+	// Validate before consuming the token so a rejected password can be retried
+	if err := s.validate(account, "password", newPassword); err != nil {
+		return err
+	}
+	consumed, err := s.tokens.MarkUsed(claims.ID, s.Now())
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return domainerrors.ErrTokenAlreadyUsed
+	}
+	return s.replace(account, newPassword)
+}
+
+// Change replaces the password of an authenticated account after checking the current one
+func (s *PasswordService) Change(accountID, currentPassword, newPassword string) error {
+	account, err := s.accounts.GetByID(accountID)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return domainerrors.ErrAccountNotFound
+	}
+	if !CheckPassword(account.Password, currentPassword) {
+		validation := &domainerrors.ValidationError{}
+		validation.Add("currentPassword", domainerrors.ErrIncorrectPassword)
+		return validation
+	}
+	if err := s.validate(account, "newPassword", newPassword); err != nil {
+		return err
+	}
+	return s.replace(account, newPassword)
+}
+
+func (s *PasswordService) validate(account *Account, field, password string) error {
+	validation := &domainerrors.ValidationError{}
+	for _, err := range DefaultPasswordPolicy.Check(password, PasswordUserInputs{Name: account.Name, Email: account.Email}) {
+		validation.Add(field, err)
+	}
+	return validation.ErrorOrNil()
+}
+
+func (s *PasswordService) replace(account *Account, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.accounts.UpdatePassword(account.AccountID, hash); err != nil {
+		return err
+	}
+	// Reset links sent before the change must not undo it
+	if err := s.tokens.InvalidateAll(account.AccountID, TokenPurposePasswordReset, s.Now()); err != nil {
+		return err
+	}
+	logrus.WithField("accountId", account.AccountID).Info("Password replaced, revoking sessions")
+	return s.sessions.RevokeAll(account.AccountID)
+}
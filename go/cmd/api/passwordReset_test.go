@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+type passwordFixture struct {
+	service  *PasswordService
+	sessions *SessionService
+	accounts *AccountDAOMemory
+	mailer   *mailer.MemoryMailer
+	now      time.Time
+}
+
+func newPasswordFixture(t *testing.T) *passwordFixture {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	f := &passwordFixture{
+		accounts: NewAccountDAOMemory(),
+		mailer:   &mailer.MemoryMailer{},
+		now:      time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	assert.NoError(t, f.accounts.Save(&Account{
+		AccountID: "550e8400-e29b-41d4-a716-446655440000",
+		Name:      "Gustavo B",
+		Email:     "gustavo@example.com",
+		Document:  "11144477735",
+		Password:  hash,
+		Status:    AccountStatusActive,
+	}))
+	clock := func() time.Time { return f.now }
+	f.sessions = NewSessionService(f.accounts, NewSessionDAOMemory())
+	f.sessions.Now = clock
+	f.service = NewPasswordService(f.accounts, NewAccountTokenDAOMemory(), f.sessions, f.mailer, NewTokenSigner([]byte("secret")))
+	f.service.Now = clock
+	return f
+}
+
+// lastResetToken reads the token line of the most recent reset email
+func (f *passwordFixture) lastResetToken(t *testing.T) string {
+	messages := f.mailer.Messages("gustavo@example.com")
+	if !assert.NotEmpty(t, messages) {
+		t.FailNow()
+	}
+	lines := strings.Split(messages[len(messages)-1].Body, "\n")
+	return strings.TrimSpace(lines[4])
+}
+
+func fieldCodeList(err error) []string {
+	var validation *domainerrors.ValidationError
+	if !errors.As(err, &validation) {
+		return nil
+	}
+	var codes []string
+	for _, field := range validation.Fields {
+		codes = append(codes, field.Field+":"+field.Code)
+	}
+	return codes
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	f := newPasswordFixture(t)
+	session, _, _ := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.NoError(t, f.service.Forgot(context.Background(), "gustavo@example.com"))
+	token := f.lastResetToken(t)
+
+	err := f.service.Reset(token, "Password123")
+	assert.Equal(t, []string{"password:password_too_weak"}, fieldCodeList(err))
+
+	assert.NoError(t, f.service.Reset(token, "Nw8#pQz4Rt6y"))
+	_, _, err = f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidCredentials)
+	_, _, err = f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Nw8#pQz4Rt6y"})
+	assert.NoError(t, err)
+	_, err = f.sessions.Authenticate(session)
+	assert.ErrorIs(t, err, domainerrors.ErrAuthenticationRequired, "existing sessions must be revoked")
+
+	assert.ErrorIs(t, f.service.Reset(token, "Xk9$wLm3Vb7n"), domainerrors.ErrTokenAlreadyUsed)
+}
+
+func TestPasswordResetInvalidatesEarlierLinks(t *testing.T) {
+	f := newPasswordFixture(t)
+	assert.NoError(t, f.service.Forgot(context.Background(), "gustavo@example.com"))
+	earlier := f.lastResetToken(t)
+	assert.NoError(t, f.service.Forgot(context.Background(), "gustavo@example.com"))
+
+	assert.NoError(t, f.service.Reset(f.lastResetToken(t), "Nw8#pQz4Rt6y"))
+
+	assert.ErrorIs(t, f.service.Reset(earlier, "Xk9$wLm3Vb7n"), domainerrors.ErrTokenAlreadyUsed)
+	assert.NoError(t, f.service.Forgot(context.Background(), "gustavo@example.com"))
+	unused := f.lastResetToken(t)
+	assert.NoError(t, f.service.Change("550e8400-e29b-41d4-a716-446655440000", "Nw8#pQz4Rt6y", "Xk9$wLm3Vb7n"))
+	assert.ErrorIs(t, f.service.Reset(unused, "Pd5%hRq8Ws2c"), domainerrors.ErrTokenAlreadyUsed)
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	f := newPasswordFixture(t)
+	assert.NoError(t, f.service.Forgot(context.Background(), "gustavo@example.com"))
+	f.now = f.now.Add(f.service.TokenTTL)
+
+	assert.ErrorIs(t, f.service.Reset(f.lastResetToken(t), "Nw8#pQz4Rt6y"), domainerrors.ErrTokenExpired)
+}
+
+func TestPasswordResetRejectsVerificationToken(t *testing.T) {
+	f := newPasswordFixture(t)
+	token, _ := NewTokenSigner([]byte("secret")).Sign(TokenPurposeEmailVerification, "550e8400-e29b-41d4-a716-446655440000", f.now.Add(time.Hour))
+
+	assert.ErrorIs(t, f.service.Reset(token, "Nw8#pQz4Rt6y"), domainerrors.ErrInvalidToken)
+}
+
+func TestPasswordForgotIsSilent(t *testing.T) {
+	f := newPasswordFixture(t)
+	assert.NoError(t, f.service.Forgot(context.Background(), "nobody@example.com"))
+	for i := 0; i < f.service.ResendLimit+2; i++ {
+		assert.NoError(t, f.service.Forgot(context.Background(), "gustavo@example.com"))
+	}
+	assert.Len(t, f.mailer.Messages("gustavo@example.com"), f.service.ResendLimit)
+}
+
+func TestPasswordChange(t *testing.T) {
+	f := newPasswordFixture(t)
+	session, _, _ := f.sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+
+	err := f.service.Change("550e8400-e29b-41d4-a716-446655440000", "wrong", "Nw8#pQz4Rt6y")
+	assert.Equal(t, []string{"currentPassword:incorrect_password"}, fieldCodeList(err))
+
+	err = f.service.Change("550e8400-e29b-41d4-a716-446655440000", "Vq7!mZt2Lp9x", "Gustavo!Kx7q")
+	assert.Equal(t, []string{"newPassword:password_contains_personal_info"}, fieldCodeList(err))
+
+	assert.NoError(t, f.service.Change("550e8400-e29b-41d4-a716-446655440000", "Vq7!mZt2Lp9x", "Nw8#pQz4Rt6y"))
+	_, err = f.sessions.Authenticate(session)
+	assert.ErrorIs(t, err, domainerrors.ErrAuthenticationRequired)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Ranked list of passwords and words that attackers try first, most common first
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars", "klaster",
+	"112233", "george", "computer", "michelle", "jessica", "pepper", "zxcvbn", "freedom",
+	"welcome", "admin", "login", "princess", "secret", "secure", "pass", "love", "hello",
+	"whatever", "summer", "winter", "spring", "autumn", "flower", "cookie", "changeme",
+	"senha", "mudar", "brasil", "flamengo", "corinthians", "palmeiras", "saopaulo", "gremio",
+	"amor", "deus", "familia", "futebol", "bitcoin", "crypto", "wallet", "money", "exchange",
+}
+
+var commonPasswordRank = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, word := range commonPasswords {
+		ranks[word] = i + 1
+	}
+	return ranks
+}()
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// Common character substitutions reverted before the dictionary lookup
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', '!': 'i',
+}
+
+// Thresholds from zxcvbn: each score means roughly 100x more guesses than the previous one
+var passwordScoreThresholds = []float64{3, 6, 8, 10}
+
+// passwordMatch is a guessable substring password[start:end]
+type passwordMatch struct {
+	start, end int
+	log10      float64
+}
+
+// PasswordScore estimates how hard password is to guess, from 0 (trivial) to 4 (very strong).
+// Like zxcvbn it splits the password into the cheapest combination of dictionary words,
+// sequences, repeats, keyboard runs, years and brute-forced characters.
+func PasswordScore(password string) int {
+	guesses := estimatePasswordGuesses(password)
+	for score, threshold := range passwordScoreThresholds {
+		if guesses < threshold {
+			return score
+		}
+	}
+	return len(passwordScoreThresholds)
+}
+
+// estimatePasswordGuesses returns log10 of the guesses needed for the cheapest split of password
+func estimatePasswordGuesses(password string) float64 {
+	runes := []rune(password)
+	matches := findPasswordMatches(runes)
+	best := make([]float64, len(runes)+1)
+	for end := 1; end <= len(runes); end++ {
+		// One brute-forced character costs ten guesses
+		best[end] = best[end-1] + 1
+		for _, match := range matches {
+			if match.end == end {
+				best[end] = math.Min(best[end], best[match.start]+match.log10)
+			}
+		}
+	}
+	return best[len(runes)]
+}
+
+func findPasswordMatches(runes []rune) []passwordMatch {
+	var matches []passwordMatch
+	add := func(start, end int, guesses float64) {
+		// A recognized pattern is never cheaper than a handful of guesses
+		matches = append(matches, passwordMatch{start: start, end: end, log10: math.Log10(math.Max(guesses, 50))})
+	}
+	lower := []rune(strings.ToLower(string(runes)))
+	for start := 0; start < len(runes); start++ {
+		for end := start + 3; end <= len(runes); end++ {
+			token := runes[start:end]
+			if guesses, ok := dictionaryGuesses(token); ok {
+				add(start, end, guesses)
+			}
+			if isKeyboardRun(lower[start:end]) && end-start >= 4 {
+				add(start, end, float64(40*(end-start)))
+			}
+			if end-start == 4 && isYear(token) {
+				add(start, end, 120)
+			}
+		}
+	}
+	matches = append(matches, findRunMatches(lower)...)
+	return matches
+}
+
+// dictionaryGuesses looks token up as typed and with substitutions reverted
+func dictionaryGuesses(token []rune) (float64, bool) {
+	lower := strings.ToLower(string(token))
+	if rank, ok := commonPasswordRank[lower]; ok {
+		return float64(rank) * uppercaseVariations(token), true
+	}
+	unleeted := strings.Map(func(r rune) rune {
+		if sub, ok := leetSubstitutions[r]; ok {
+			return sub
+		}
+		return r
+	}, lower)
+	if rank, ok := commonPasswordRank[unleeted]; ok && unleeted != lower {
+		return float64(rank) * uppercaseVariations(token) * 2, true
+	}
+	return 0, false
+}
+
+// uppercaseVariations counts the capitalizations an attacker would try for token
+func uppercaseVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && unicode.IsUpper(token[0]):
+		return 2
+	}
+	variations := 0.0
+	for i := 1; i <= upper && i <= lower; i++ {
+		variations += binomial(upper+lower, i)
+	}
+	return variations
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func isKeyboardRun(token []rune) bool {
+	text := string(token)
+	for _, row := range keyboardRows {
+		if strings.Contains(row, text) || strings.Contains(reverse(row), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func isYear(token []rune) bool {
+	text := string(token)
+	return (strings.HasPrefix(text, "19") || strings.HasPrefix(text, "20")) && strings.Trim(text, "0123456789") == ""
+}
+
+// findRunMatches finds repeated characters ("aaaa") and sequences ("abcd", "9876")
+func findRunMatches(lower []rune) []passwordMatch {
+	var matches []passwordMatch
+	for start := 0; start < len(lower); {
+		end := start + 1
+		for end < len(lower) && lower[end] == lower[start] {
+			end++
+		}
+		if end-start >= 3 {
+			guesses := charsetSize(lower[start]) * float64(end-start)
+			matches = append(matches, passwordMatch{start: start, end: end, log10: math.Log10(math.Max(guesses, 50))})
+		}
+		if end-start > 1 {
+			start = end
+			continue
+		}
+		delta := 0
+		if start+1 < len(lower) {
+			delta = int(lower[start+1]) - int(lower[start])
+		}
+		if delta == 1 || delta == -1 {
+			for end < len(lower) && int(lower[end])-int(lower[end-1]) == delta && sameCharset(lower[end], lower[start]) {
+				end++
+			}
+		}
+		if end-start >= 3 {
+			guesses := sequenceStartGuesses(lower[start]) * float64(end-start)
+			if delta < 0 {
+				guesses *= 2
+			}
+			matches = append(matches, passwordMatch{start: start, end: end, log10: math.Log10(math.Max(guesses, 50))})
+			start = end - 1
+			continue
+		}
+		start++
+	}
+	return matches
+}
+
+func sequenceStartGuesses(r rune) float64 {
+	switch r {
+	case 'a', 'z', '0', '1', '9':
+		return 4
+	}
+	return charsetSize(r)
+}
+
+func charsetSize(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLetter(r):
+		return 26
+	}
+	return 33
+}
+
+func sameCharset(a, b rune) bool {
+	return unicode.IsDigit(a) == unicode.IsDigit(b) && unicode.IsLetter(a) == unicode.IsLetter(b)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordScore(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		lowest  int
+		highest int
+	}{
+		{"Common password", "password", 0, 0},
+		{"Common password with capital", "Password123", 0, 1},
+		{"Leet common password", "P@ssw0rd", 0, 1},
+		{"Keyboard run", "qwertyuiop", 0, 1},
+		{"Repeated characters", "aaaaaaaaaaaa", 0, 1},
+		{"Sequence", "abcdefgh12345", 0, 1},
+		{"Word and year", "Monkey1987", 0, 2},
+		{"Random", "Vq7!mZt2Lp9x", 4, 4},
+		{"Long passphrase", "plinth-margin-obelisk-tundra", 4, 4},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			score := PasswordScore(tc.input)
+			assert.GreaterOrEqual(t, score, tc.lowest)
+			assert.LessOrEqual(t, score, tc.highest)
+		})
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	inputs := PasswordUserInputs{Name: "Gustavo da Silva", Email: "gus.bru@example.com"}
+	testCases := []struct {
+		name     string
+		input    string
+		expected []error
+	}{
+		{"Strong password", "Vq7!mZt2Lp9x", nil},
+		{"Too short", "Vq7!mZt", []error{domainerrors.ErrPasswordTooShort}},
+		{"Too short without classes", "vq!", []error{domainerrors.ErrPasswordTooShort, domainerrors.ErrPasswordMissingUppercase, domainerrors.ErrPasswordMissingDigit}},
+		{"Too long", "Vq7!mZt2Lp9x" + strings.Repeat("x", 120), []error{domainerrors.ErrPasswordTooLong}},
+		{"Missing lowercase", "VQ7!MZT2LP9X", []error{domainerrors.ErrPasswordMissingLowercase}},
+		{"Missing uppercase", "vq7!mzt2lp9x", []error{domainerrors.ErrPasswordMissingUppercase}},
+		{"Missing digit", "Vqx!mZtwLpex", []error{domainerrors.ErrPasswordMissingDigit}},
+		{"Weak", "Password123", []error{domainerrors.ErrPasswordTooWeak}},
+		{"Contains name", "Xq7!Gustavo9z", []error{domainerrors.ErrPasswordContainsPersonalInfo}},
+		{"Contains email part", "Xq7!bru.9zMk", []error{domainerrors.ErrPasswordContainsPersonalInfo}},
+		{"Name particle is allowed", "Vq7!daZt2Lp9x", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DefaultPasswordPolicy.Check(tc.input, inputs))
+		})
+	}
+}
+
+func TestPasswordPolicyRequiredClasses(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 4, MaxLength: 64, RequiredClasses: []PasswordCharacterClass{PasswordClassSymbol}}
+	assert.Equal(t, []error{domainerrors.ErrPasswordMissingSymbol}, policy.Check("abcdef", PasswordUserInputs{}))
+	assert.Empty(t, policy.Check("abc-def", PasswordUserInputs{}))
+}
+
+func TestBreachedPasswordDirectory(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "P@ssw0rd" is 21BD12DC183F740EE76F27B78EB39C8AD972A757
+	range21BD1 := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n2DC183F740EE76F27B78EB39C8AD972A757:52579\r\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "21BD1"), []byte(range21BD1), 0o644))
+
+	breached := &BreachedPasswordDirectory{Dir: dir}
+	found, err := breached.IsBreached("P@ssw0rd")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = breached.IsBreached("Vq7!mZt2Lp9x")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	policy := DefaultPasswordPolicy
+	policy.MinScore = 0
+	policy.Breached = breached
+	assert.Equal(t, []error{domainerrors.ErrPasswordBreached}, policy.Check("P@ssw0rd", PasswordUserInputs{}))
+}
+
+func TestNewPasswordPolicyFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_MAX_LENGTH", "6")
+	t.Setenv("PASSWORD_REQUIRED_CLASSES", "lower, symbol,unknown")
+	t.Setenv("PASSWORD_MIN_SCORE", "3")
+	t.Setenv("PASSWORD_BREACH_DIR", "/var/lib/pwned")
+	policy := NewPasswordPolicyFromEnv()
+	assert.Equal(t, 12, policy.MinLength)
+	assert.Equal(t, DefaultPasswordPolicy.MaxLength, policy.MaxLength)
+	assert.Equal(t, []PasswordCharacterClass{PasswordClassLower, PasswordClassSymbol}, policy.RequiredClasses)
+	assert.Equal(t, 3, policy.MinScore)
+	assert.Equal(t, &BreachedPasswordDirectory{Dir: "/var/lib/pwned"}, policy.Breached)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/sirupsen/logrus"
+)
+
+// Fiber locals set by RequireSession for the authenticated request
+const (
+	localAccountID = "accountId"
+	localSessionID = "sessionId"
+)
+
+// SecondFactor is checked at login for accounts that enabled it
+type SecondFactor interface {
+	Enabled(accountID string) (bool, error)
+	Verify(accountID, code string) error
+}
+
+// Credentials is what a client sends to log in, IP is the client address used for throttling
+type Credentials struct {
+	Email    string
+	Password string
+	TotpCode string
+	IP       string
+}
+
+// SessionService logs accounts in with their password and authenticates bearer tokens
+type SessionService struct {
+	accounts IAccountDAO
+	sessions ISessionDAO
+	// SecondFactor is optional, nil logs in with the password alone
+	SecondFactor SecondFactor
+	// Throttle is optional, nil allows unlimited failed logins
+	Throttle *LoginThrottle
+
+	Now        func() time.Time
+	SessionTTL time.Duration
+}
+
+func NewSessionService(accounts IAccountDAO, sessions ISessionDAO) *SessionService {
+	return &SessionService{
+		accounts:   accounts,
+		sessions:   sessions,
+		Now:        time.Now,
+		SessionTTL: 24 * time.Hour,
+	}
+}
+
+// hashSessionToken is what gets stored, so a leaked table cannot be replayed
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Login checks the credentials, and the second factor code when enabled,
+// then opens a session and returns its bearer token
+func (s *SessionService) Login(credentials Credentials) (string, *Account, error) {
+	if s.Throttle != nil {
+		if err := s.Throttle.Check(credentials.Email, credentials.IP); err != nil {
+			return "", nil, err
+		}
+	}
+	account, err := s.authenticate(credentials)
+	if errors.Is(err, domainerrors.ErrInvalidCredentials) || errors.Is(err, domainerrors.ErrInvalidTwoFactorCode) {
+		if s.Throttle != nil {
+			if err := s.Throttle.Failure(credentials.Email, credentials.IP, account); err != nil {
+				logrus.WithError(err).Error("Failed to record failed login")
+			}
+		}
+		return "", nil, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if s.Throttle != nil {
+		if err := s.Throttle.Success(credentials.Email); err != nil {
+			logrus.WithError(err).Error("Failed to reset failed logins")
+		}
+	}
+	if NeedsRehash(account.Password) {
+		if hash, err := HashPassword(credentials.Password); err == nil {
+			if err := s.accounts.UpdatePassword(account.AccountID, hash); err != nil {
+				logrus.WithError(err).WithField("accountId", account.AccountID).Warn("Failed to rehash password")
+			}
+		}
+	}
+	token, err := s.Open(account.AccountID)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, account, nil
+}
+
+// authenticate returns the account even when only the second factor failed,
+// so the failure can be attributed to it
+func (s *SessionService) authenticate(credentials Credentials) (*Account, error) {
+	account, err := s.accounts.GetByEmail(credentials.Email)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		// Spend the same time as a real check so response times do not reveal emails
+		CheckPassword(dummyPasswordHash(), credentials.Password)
+		return nil, domainerrors.ErrInvalidCredentials
+	}
+	if !CheckPassword(account.Password, credentials.Password) {
+		return account, domainerrors.ErrInvalidCredentials
+	}
+	if account.Status == AccountStatusClosed {
+		return nil, domainerrors.ErrAccountClosed
+	}
+	if s.SecondFactor != nil {
+		enabled, err := s.SecondFactor.Enabled(account.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			if err := s.SecondFactor.Verify(account.AccountID, credentials.TotpCode); err != nil {
+				return account, err
+			}
+		}
+	}
+	return account, nil
+}
+
+// Open starts a session for accountID and returns its bearer token
+func (s *SessionService) Open(accountID string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	now := s.Now()
+	err := s.sessions.Save(&Session{
+		SessionID: uuid.NewString(),
+		AccountID: accountID,
+		TokenHash: hashSessionToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.SessionTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate returns the live session for token
+func (s *SessionService) Authenticate(token string) (*Session, error) {
+	if token == "" {
+		return nil, domainerrors.ErrAuthenticationRequired
+	}
+	session, err := s.sessions.GetByTokenHash(hashSessionToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.RevokedAt != nil || !s.Now().Before(session.ExpiresAt) {
+		return nil, domainerrors.ErrAuthenticationRequired
+	}
+	return session, nil
+}
+
+func (s *SessionService) Logout(session *Session) error {
+	return s.sessions.Revoke(session.SessionID, s.Now())
+}
+
+// RevokeAll ends every session of the account, e.g. after a password change
+func (s *SessionService) RevokeAll(accountID string) error {
+	return s.sessions.RevokeAllForAccount(accountID, s.Now())
+}
+
+// RequireSession rejects requests without a valid "Authorization: Bearer <token>" header
+func RequireSession(sessions *SessionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scheme, token, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return domainerrors.ErrAuthenticationRequired
+		}
+		session, err := sessions.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			if !errors.Is(err, domainerrors.ErrAuthenticationRequired) {
+				logrus.WithError(err).Error("Error authenticating session")
+				return domainerrors.ErrInternal
+			}
+			return err
+		}
+		c.Locals(localAccountID, session.AccountID)
+		c.Locals(localSessionID, session.SessionID)
+		return c.Next()
+	}
+}
+
+// dummyPasswordHash is checked for unknown emails so login takes the same time either way
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := HashPassword(uuid.NewString())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to hash dummy password")
+	}
+	return hash
+})
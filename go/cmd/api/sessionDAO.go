@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Session is a login, identified by the SHA-256 hash of its bearer token
+type Session struct {
+	SessionID string
+	AccountID string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+// ISessionDAO defines the interface for session storage
+type ISessionDAO interface {
+	Save(session *Session) error
+	GetByTokenHash(tokenHash string) (*Session, error)
+	Revoke(sessionID string, revokedAt time.Time) error
+	RevokeAllForAccount(accountID string, revokedAt time.Time) error
+}
+
+// SessionDAODatabase implements ISessionDAO using PostgreSQL database
+type SessionDAODatabase struct {
+	db *Database
+}
+
+func NewSessionDAODatabase(db *Database) *SessionDAODatabase {
+	return &SessionDAODatabase{db: db}
+}
+
+func (dao *SessionDAODatabase) Save(session *Session) error {
+	query := "INSERT INTO ccca.session (session_id, account_id, token_hash, created_at, expires_at, revoked_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	_, err := dao.db.DB.Exec(query, session.SessionID, session.AccountID, session.TokenHash, session.CreatedAt, session.ExpiresAt, session.RevokedAt)
+	return err
+}
+
+func (dao *SessionDAODatabase) GetByTokenHash(tokenHash string) (*Session, error) {
+	query := "SELECT session_id, account_id, token_hash, created_at, expires_at, revoked_at FROM ccca.session WHERE token_hash = $1"
+	session := &Session{}
+	var revokedAt sql.NullTime
+	err := dao.db.DB.QueryRow(query, tokenHash).Scan(&session.SessionID, &session.AccountID, &session.TokenHash, &session.CreatedAt, &session.ExpiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, nil
+}
+
+func (dao *SessionDAODatabase) Revoke(sessionID string, revokedAt time.Time) error {
+	_, err := dao.db.DB.Exec("UPDATE ccca.session SET revoked_at = $1 WHERE session_id = $2 AND revoked_at IS NULL", revokedAt, sessionID)
+	return err
+}
+
+func (dao *SessionDAODatabase) RevokeAllForAccount(accountID string, revokedAt time.Time) error {
+	_, err := dao.db.DB.Exec("UPDATE ccca.session SET revoked_at = $1 WHERE account_id = $2 AND revoked_at IS NULL", revokedAt, accountID)
+	return err
+}
+
+// SessionDAOMemory implements ISessionDAO using in-memory storage
+type SessionDAOMemory struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewSessionDAOMemory() *SessionDAOMemory {
+	return &SessionDAOMemory{
+		sessions: make(map[string]*Session),
+	}
+}
+
+func (dao *SessionDAOMemory) Save(session *Session) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	stored := *session
+	dao.sessions[session.SessionID] = &stored
+	return nil
+}
+
+func (dao *SessionDAOMemory) GetByTokenHash(tokenHash string) (*Session, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for _, session := range dao.sessions {
+		if session.TokenHash == tokenHash {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (dao *SessionDAOMemory) Revoke(sessionID string, revokedAt time.Time) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	if session, exists := dao.sessions[sessionID]; exists && session.RevokedAt == nil {
+		session.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+func (dao *SessionDAOMemory) RevokeAllForAccount(accountID string, revokedAt time.Time) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for _, session := range dao.sessions {
+		if session.AccountID == accountID && session.RevokedAt == nil {
+			session.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
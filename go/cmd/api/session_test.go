@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSessionFixture(t *testing.T, password string) (*SessionService, *AccountDAOMemory, *time.Time) {
+	accounts := NewAccountDAOMemory()
+	assert.NoError(t, accounts.Save(&Account{
+		AccountID: "550e8400-e29b-41d4-a716-446655440000",
+		Name:      "Gustavo B",
+		Email:     "gustavo@example.com",
+		Document:  "11144477735",
+		Password:  password,
+		Status:    AccountStatusActive,
+	}))
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := NewSessionService(accounts, NewSessionDAOMemory())
+	service.Now = func() time.Time { return now }
+	return service, accounts, &now
+}
+
+func TestSessionLogin(t *testing.T) {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	service, _, now := newSessionFixture(t, hash)
+
+	token, account, err := service.Login(Credentials{Email: "GUSTAVO@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.NoError(t, err)
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000", account.AccountID)
+
+	session, err := service.Authenticate(token)
+	assert.NoError(t, err)
+	assert.Equal(t, account.AccountID, session.AccountID)
+
+	*now = now.Add(service.SessionTTL)
+	_, err = service.Authenticate(token)
+	assert.ErrorIs(t, err, domainerrors.ErrAuthenticationRequired)
+}
+
+func TestSessionLoginRejectsInvalidCredentials(t *testing.T) {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	service, _, _ := newSessionFixture(t, hash)
+
+	_, _, err := service.Login(Credentials{Email: "gustavo@example.com", Password: "wrong"})
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidCredentials)
+	_, _, err = service.Login(Credentials{Email: "nobody@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidCredentials)
+}
+
+func TestSessionLoginRehashesLegacyPassword(t *testing.T) {
+	service, accounts, _ := newSessionFixture(t, "SecurePassword1234")
+
+	_, _, err := service.Login(Credentials{Email: "gustavo@example.com", Password: "SecurePassword1234"})
+	assert.NoError(t, err)
+	account, _ := accounts.GetByEmail("gustavo@example.com")
+	assert.False(t, NeedsRehash(account.Password))
+	assert.True(t, CheckPassword(account.Password, "SecurePassword1234"))
+}
+
+func TestSessionRevokeAll(t *testing.T) {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	service, _, _ := newSessionFixture(t, hash)
+	first, _, _ := service.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	second, _, _ := service.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+
+	assert.NoError(t, service.RevokeAll("550e8400-e29b-41d4-a716-446655440000"))
+	for _, token := range []string{first, second} {
+		_, err := service.Authenticate(token)
+		assert.ErrorIs(t, err, domainerrors.ErrAuthenticationRequired)
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	service, _, _ := newSessionFixture(t, hash)
+	token, _, _ := service.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/", RequireSession(service), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals(localAccountID).(string))
+	})
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"Valid token", "Bearer " + token, fiber.StatusOK},
+		{"Lowercase scheme", "bearer " + token, fiber.StatusOK},
+		{"Missing header", "", fiber.StatusUnauthorized},
+		{"Unknown token", "Bearer invalid", fiber.StatusUnauthorized},
+		{"Other scheme", "Basic " + token, fiber.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, tc.expectedStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/sirupsen/logrus"
+)
+
+// TokenPurpose prevents a token issued for one flow from being accepted by another
+type TokenPurpose string
+
+const (
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeAccountUnlock     TokenPurpose = "account_unlock"
+)
+
+// TokenClaims is the signed content of a token
+type TokenClaims struct {
+	ID        string
+	Purpose   TokenPurpose
+	Subject   string
+	ExpiresAt time.Time
+}
+
+// TokenSigner issues and checks HMAC-SHA256 signed tokens
+type TokenSigner struct {
+	secret []byte
+}
+
+func NewTokenSigner(secret []byte) *TokenSigner {
+	return &TokenSigner{secret: secret}
+}
+
+// NewTokenSignerFromEnv uses TOKEN_SECRET, or a random secret that does not survive restarts
+func NewTokenSignerFromEnv() *TokenSigner {
+	if secret := os.Getenv("TOKEN_SECRET"); secret != "" {
+		return NewTokenSigner([]byte(secret))
+	}
+	logrus.Warn("TOKEN_SECRET is not set, issued tokens will be invalid after a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logrus.WithError(err).Fatal("Failed to generate token secret")
+	}
+	return NewTokenSigner(secret)
+}
+
+// Sign issues a token with a fresh ID for subject
+func (s *TokenSigner) Sign(purpose TokenPurpose, subject string, expiresAt time.Time) (string, TokenClaims) {
+	claims := TokenClaims{ID: uuid.NewString(), Purpose: purpose, Subject: subject, ExpiresAt: expiresAt}
+	payload := strings.Join([]string{claims.ID, string(purpose), subject, strconv.FormatInt(expiresAt.Unix(), 10)}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + s.signature(encoded), claims
+}
+
+// Verify checks the signature, purpose and expiry of token at the given time
+func (s *TokenSigner) Verify(purpose TokenPurpose, token string, now time.Time) (TokenClaims, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(s.signature(encoded))) {
+		return TokenClaims{}, domainerrors.ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return TokenClaims{}, domainerrors.ErrInvalidToken
+	}
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 4 || TokenPurpose(parts[1]) != purpose {
+		return TokenClaims{}, domainerrors.ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return TokenClaims{}, domainerrors.ErrInvalidToken
+	}
+	claims := TokenClaims{ID: parts[0], Purpose: purpose, Subject: parts[2], ExpiresAt: time.Unix(expiresAt, 0)}
+	if !now.Before(claims.ExpiresAt) {
+		return TokenClaims{}, domainerrors.ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func (s *TokenSigner) signature(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DeriveKey returns a 32-byte key bound to label, so TOKEN_SECRET can key other
+// purposes than token signatures without reusing the same bytes.
+func (s *TokenSigner) DeriveKey(label string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("derive|" + label))
+	return mac.Sum(nil)
+}
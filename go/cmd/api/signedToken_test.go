@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenSigner(t *testing.T) {
+	signer := NewTokenSigner([]byte("secret"))
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	token, issued := signer.Sign(TokenPurposeEmailVerification, "550e8400-e29b-41d4-a716-446655440000", now.Add(time.Hour))
+
+	claims, err := signer.Verify(TokenPurposeEmailVerification, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, issued.ID, claims.ID)
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000", claims.Subject)
+	assert.True(t, issued.ExpiresAt.Equal(claims.ExpiresAt))
+
+	encoded, signature, _ := strings.Cut(token, ".")
+	testCases := []struct {
+		name        string
+		signer      *TokenSigner
+		purpose     TokenPurpose
+		token       string
+		now         time.Time
+		expectedErr error
+	}{
+		{"Expired", signer, TokenPurposeEmailVerification, token, now.Add(time.Hour), domainerrors.ErrTokenExpired},
+		{"Other secret", NewTokenSigner([]byte("other")), TokenPurposeEmailVerification, token, now, domainerrors.ErrInvalidToken},
+		{"Other purpose", signer, TokenPurpose("password_reset"), token, now, domainerrors.ErrInvalidToken},
+		{"Tampered payload", signer, TokenPurposeEmailVerification, "x" + encoded + "." + signature, now, domainerrors.ErrInvalidToken},
+		{"Missing signature", signer, TokenPurposeEmailVerification, encoded, now, domainerrors.ErrInvalidToken},
+		{"Empty", signer, TokenPurposeEmailVerification, "", now, domainerrors.ErrInvalidToken},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.signer.Verify(tc.purpose, tc.token, tc.now)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/i18n"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Stream channels are named kind:argument, ticker takes no argument
+const (
+	StreamChannelDepth   = "depth"
+	StreamChannelTrades  = "trades"
+	StreamChannelTicker  = "ticker"
+	StreamChannelAccount = "account"
+)
+
+// Stream message types
+const (
+	StreamMessageSnapshot     = "snapshot"
+	StreamMessageUpdate       = "update"
+	StreamMessageUnsubscribed = "unsubscribed"
+	StreamMessageError        = "error"
+)
+
+// DefaultStreamBuffer is how many messages a client may fall behind before it is dropped
+const DefaultStreamBuffer = 256
+
+const (
+	streamPingInterval = 30 * time.Second
+	// streamReadTimeout is how long a client may stay silent, pongs included
+	streamReadTimeout  = 2 * streamPingInterval
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamClient is a connection to the stream. Messages wait in send for the
+// connection to write them, a client that lets it fill up is dropped.
+type StreamClient struct {
+	// accountID is the authenticated account, empty on anonymous connections
+	accountID string
+	locale    i18n.Locale
+	send      chan []byte
+	// closed and slow are guarded by the hub, slow tells the writer why send was closed
+	closed bool
+	slow   bool
+}
+
+// bookDepth is the remaining quantity at each price of a book, by side
+type bookDepth map[string]map[string]decimal.Decimal
+
+// StreamHub fans the changes of the exchange out to the clients subscribed to them.
+// Every channel numbers its messages, a snapshot carries the number of the last
+// update it includes.
+type StreamHub struct {
+	orders   IOrderDAO
+	trades   ITradeDAO
+	balances IBalanceDAO
+	tickers  *TickerService
+
+	Markets map[string]Market
+	Now     func() time.Time
+	Buffer  int
+
+	// mu guards the subscriptions and is never held while the database is read
+	mu sync.Mutex
+	// reading holds the locks of the channels being read, see lockChannels
+	reading     map[string]*channelLock
+	subscribers map[string]map[*StreamClient]bool
+	sequences   map[string]int64
+	// depths are the books of the markets with depth subscribers, as last sent
+	depths map[string]bookDepth
+}
+
+func NewStreamHub(orders IOrderDAO, trades ITradeDAO, balances IBalanceDAO, tickers *TickerService) *StreamHub {
+	return &StreamHub{
+		orders:      orders,
+		trades:      trades,
+		balances:    balances,
+		tickers:     tickers,
+		Markets:     DefaultMarkets,
+		Now:         time.Now,
+		Buffer:      DefaultStreamBuffer,
+		reading:     make(map[string]*channelLock),
+		subscribers: make(map[string]map[*StreamClient]bool),
+		sequences:   make(map[string]int64),
+		depths:      make(map[string]bookDepth),
+	}
+}
+
+// channelLock is held while a snapshot or an update of a channel is read from the database
+type channelLock struct {
+	sync.Mutex
+	// holders counts who holds or waits for the lock, it is dropped when nobody does
+	holders int
+}
+
+// lockChannels holds the reads of channels until unlock is called, so a snapshot
+// is the state right after the update its sequence numbers. Other channels are
+// read meanwhile. Channels are locked in order, a reader of several never waits
+// for one waiting for it.
+func (h *StreamHub) lockChannels(channels ...string) (unlock func()) {
+	channels = slices.Compact(slices.Sorted(slices.Values(channels)))
+	h.mu.Lock()
+	locks := make([]*channelLock, 0, len(channels))
+	for _, channel := range channels {
+		lock, exists := h.reading[channel]
+		if !exists {
+			lock = &channelLock{}
+			h.reading[channel] = lock
+		}
+		lock.holders++
+		locks = append(locks, lock)
+	}
+	h.mu.Unlock()
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i, channel := range channels {
+			if locks[i].holders--; locks[i].holders == 0 {
+				delete(h.reading, channel)
+			}
+		}
+	}
+}
+
+// Connect registers a client, accountID is empty when it did not authenticate
+func (h *StreamHub) Connect(accountID string, locale i18n.Locale) *StreamClient {
+	return &StreamClient{accountID: accountID, locale: locale, send: make(chan []byte, h.Buffer)}
+}
+
+// Disconnect drops every subscription of the client and closes its send channel
+func (h *StreamHub) Disconnect(client *StreamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dropLocked(client, false)
+}
+
+func (h *StreamHub) dropLocked(client *StreamClient, slow bool) {
+	if client.closed {
+		return
+	}
+	client.closed, client.slow = true, slow
+	for channel, subscribers := range h.subscribers {
+		if subscribers[client] {
+			h.unsubscribeLocked(client, channel)
+		}
+	}
+	close(client.send)
+}
+
+func (h *StreamHub) unsubscribeLocked(client *StreamClient, channel string) {
+	delete(h.subscribers[channel], client)
+	if len(h.subscribers[channel]) > 0 {
+		return
+	}
+	delete(h.subscribers, channel)
+	if kind, marketID, _ := strings.Cut(channel, ":"); kind == StreamChannelDepth {
+		delete(h.depths, marketID)
+	}
+}
+
+// deliverLocked queues message for client, dropping the client when it fell too far behind
+func (h *StreamHub) deliverLocked(client *StreamClient, message types.StreamMessage) {
+	if client.closed {
+		return
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		logrus.WithError(err).WithField("channel", message.Channel).Error("Error encoding stream message")
+		return
+	}
+	select {
+	case client.send <- encoded:
+	default:
+		logrus.WithFields(logrus.Fields{"accountId": client.accountID, "channel": message.Channel}).Warn("Dropping slow stream client")
+		h.dropLocked(client, true)
+	}
+}
+
+// publishLocked sends the next update of channel to its subscribers
+func (h *StreamHub) publishLocked(channel string, data any) {
+	subscribers := h.subscribers[channel]
+	if len(subscribers) == 0 {
+		return
+	}
+	h.sequences[channel]++
+	message := types.StreamMessage{Type: StreamMessageUpdate, Channel: channel, Sequence: h.sequences[channel], Data: data}
+	for client := range subscribers {
+		h.deliverLocked(client, message)
+	}
+}
+
+// Subscribe sends the client a snapshot of channel and from then on its updates
+func (h *StreamHub) Subscribe(client *StreamClient, channel string) error {
+	if err := h.authorize(client, channel); err != nil {
+		return err
+	}
+	defer h.lockChannels(channel)()
+	kind, argument, _ := strings.Cut(channel, ":")
+	var depth bookDepth
+	var snapshot any
+	var err error
+	if kind == StreamChannelDepth {
+		if depth, err = h.cachedDepth(argument); err == nil {
+			snapshot = fiber.Map{"bids": depthLevels(depth[OrderSideBuy], nil, true), "asks": depthLevels(depth[OrderSideSell], nil, false)}
+		}
+	} else {
+		snapshot, err = h.snapshot(kind, argument)
+	}
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client.closed {
+		return nil
+	}
+	if h.subscribers[channel] == nil {
+		h.subscribers[channel] = make(map[*StreamClient]bool)
+	}
+	h.subscribers[channel][client] = true
+	if depth != nil {
+		h.depths[argument] = depth
+	}
+	h.deliverLocked(client, types.StreamMessage{Type: StreamMessageSnapshot, Channel: channel, Sequence: h.sequences[channel], Data: snapshot})
+	return nil
+}
+
+// Unsubscribe stops the updates of channel
+func (h *StreamHub) Unsubscribe(client *StreamClient, channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[channel][client] {
+		h.unsubscribeLocked(client, channel)
+	}
+	h.deliverLocked(client, types.StreamMessage{Type: StreamMessageUnsubscribed, Channel: channel})
+}
+
+// authorize rejects unknown channels and the account channels of other accounts
+func (h *StreamHub) authorize(client *StreamClient, channel string) error {
+	kind, argument, _ := strings.Cut(channel, ":")
+	switch kind {
+	case StreamChannelDepth, StreamChannelTrades:
+		if _, exists := h.Markets[argument]; !exists {
+			return domainerrors.ErrMarketNotFound
+		}
+	case StreamChannelTicker:
+		if channel != StreamChannelTicker {
+			return domainerrors.ErrInvalidChannel
+		}
+	case StreamChannelAccount:
+		if client.accountID == "" {
+			return domainerrors.ErrAuthenticationRequired
+		}
+		if client.accountID != argument {
+			return domainerrors.ErrAccountAccessDenied
+		}
+	default:
+		return domainerrors.ErrInvalidChannel
+	}
+	return nil
+}
+
+// cachedDepth is the book of a market as last sent, read from the database when nobody follows it yet
+func (h *StreamHub) cachedDepth(marketID string) (bookDepth, error) {
+	h.mu.Lock()
+	depth, exists := h.depths[marketID]
+	h.mu.Unlock()
+	if exists {
+		return depth, nil
+	}
+	return h.depth(marketID)
+}
+
+// snapshot reads the current state of a trades, ticker or account channel
+func (h *StreamHub) snapshot(kind, argument string) (any, error) {
+	switch kind {
+	case StreamChannelTrades:
+		trades, err := h.trades.ListByMarket(argument, nil, DefaultTradePageSize)
+		if err != nil {
+			return nil, err
+		}
+		response := make([]fiber.Map, 0, len(trades))
+		for _, trade := range trades {
+			response = append(response, marketTradeResponse(trade))
+		}
+		return response, nil
+	case StreamChannelTicker:
+		tickers, err := h.tickers.List()
+		if err != nil {
+			return nil, err
+		}
+		response := make([]fiber.Map, 0, len(tickers))
+		for _, ticker := range tickers {
+			response = append(response, tickerResponse(ticker))
+		}
+		return response, nil
+	default:
+		return h.accountSnapshot(argument)
+	}
+}
+
+func (h *StreamHub) accountSnapshot(accountID string) (any, error) {
+	assets := []types.AssetId{}
+	for _, market := range h.Markets {
+		assets = append(assets, market.Base, market.Quote)
+	}
+	slices.Sort(assets)
+	balances, err := h.assets(accountID, slices.Compact(assets))
+	if err != nil {
+		return nil, err
+	}
+	orders, err := h.orders.ListByAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	response := []fiber.Map{}
+	for i := range orders {
+		if orders[i].Status == OrderStatusOpen || orders[i].Status == OrderStatusPending {
+			response = append(response, orderResponse(&orders[i]))
+		}
+	}
+	return fiber.Map{"balances": balances, "orders": response}, nil
+}
+
+func (h *StreamHub) assets(accountID string, assets []types.AssetId) ([]types.Asset, error) {
+	balances := make([]types.Asset, 0, len(assets))
+	for _, asset := range assets {
+		balance, err := h.balances.Get(accountID, asset)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, types.Asset{AssetID: asset, Quantity: balance.Total(), Available: balance.Available, OnHold: balance.OnHold})
+	}
+	return balances, nil
+}
+
+// depth aggregates the resting orders of a market by price
+func (h *StreamHub) depth(marketID string) (bookDepth, error) {
+	resting, err := h.orders.ListOpen(marketID)
+	if err != nil {
+		return nil, err
+	}
+	now := h.Now()
+	depth := bookDepth{}
+	for _, side := range []string{OrderSideBuy, OrderSideSell} {
+		depth[side] = make(map[string]decimal.Decimal)
+		for _, order := range bookSide(resting, side, now) {
+			price := order.Price.String()
+			depth[side][price] = depth[side][price].Add(order.Remaining())
+		}
+	}
+	return depth, nil
+}
+
+// depthLevels lists the levels of a side that differ from previous, best price first.
+// A level gone from the book is listed with a zero quantity.
+func depthLevels(levels, previous map[string]decimal.Decimal, descending bool) []fiber.Map {
+	prices := []decimal.Decimal{}
+	for price, quantity := range levels {
+		if before, exists := previous[price]; !exists || !before.Equal(quantity) {
+			prices = append(prices, decimal.RequireFromString(price))
+		}
+	}
+	for price := range previous {
+		if _, exists := levels[price]; !exists {
+			prices = append(prices, decimal.RequireFromString(price))
+		}
+	}
+	slices.SortFunc(prices, func(a, b decimal.Decimal) int {
+		if descending {
+			return b.Cmp(a)
+		}
+		return a.Cmp(b)
+	})
+	response := make([]fiber.Map, 0, len(prices))
+	for _, price := range prices {
+		response = append(response, fiber.Map{"price": price, "quantity": levels[price.String()]})
+	}
+	return response
+}
+
+// OnTrade sends the trade to the subscribers of its market
+func (h *StreamHub) OnTrade(trade Trade) {
+	channel := StreamChannelTrades + ":" + trade.MarketID
+	defer h.lockChannels(channel)()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishLocked(channel, marketTradeResponse(trade))
+}
+
+// OnBookChange sends the levels of the book that moved, the new ticker of the market
+// and the changed orders and balances of the accounts involved. What it sends is read
+// from the database first, with the channels it sends to followed by anyone locked.
+// The subscriptions are only locked to send it.
+func (h *StreamHub) OnBookChange(change BookChange) {
+	h.mu.Lock()
+	_, followed := h.depths[change.MarketID]
+	tickerFollowed := len(h.subscribers[StreamChannelTicker]) > 0
+	accounts := []string{}
+	orders := make(map[string][]fiber.Map)
+	for i := len(change.Orders) - 1; i >= 0; i-- {
+		order := &change.Orders[i]
+		// Only the latest state of an order is sent
+		if slices.ContainsFunc(change.Orders[i+1:], func(later Order) bool { return later.OrderID == order.OrderID }) {
+			continue
+		}
+		if len(h.subscribers[StreamChannelAccount+":"+order.AccountID]) == 0 {
+			continue
+		}
+		if _, seen := orders[order.AccountID]; !seen {
+			accounts = append(accounts, order.AccountID)
+		}
+		orders[order.AccountID] = append([]fiber.Map{orderResponse(order)}, orders[order.AccountID]...)
+	}
+	h.mu.Unlock()
+	// A channel nobody followed needs no lock: whoever subscribes to it now reads the change in its snapshot
+	channels := []string{}
+	if followed {
+		channels = append(channels, StreamChannelDepth+":"+change.MarketID)
+	}
+	if tickerFollowed {
+		channels = append(channels, StreamChannelTicker)
+	}
+	for _, accountID := range accounts {
+		channels = append(channels, StreamChannelAccount+":"+accountID)
+	}
+	defer h.lockChannels(channels...)()
+
+	var depth bookDepth
+	if followed {
+		var err error
+		if depth, err = h.depth(change.MarketID); err != nil {
+			logrus.WithError(err).WithField("marketId", change.MarketID).Error("Error streaming depth")
+		}
+	}
+	var ticker *Ticker
+	if tickerFollowed {
+		if read, err := h.tickers.Get(change.MarketID); err != nil {
+			logrus.WithError(err).WithField("marketId", change.MarketID).Error("Error streaming ticker")
+		} else {
+			ticker = &read
+		}
+	}
+	market := h.Markets[change.MarketID]
+	balances := make(map[string][]types.Asset)
+	for _, accountID := range accounts {
+		assets, err := h.assets(accountID, []types.AssetId{market.Base, market.Quote})
+		if err != nil {
+			logrus.WithError(err).WithField("accountId", accountID).Error("Error streaming balances")
+			continue
+		}
+		balances[accountID] = assets
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if depth != nil {
+		h.publishDepthLocked(change.MarketID, depth)
+	}
+	if ticker != nil {
+		h.publishLocked(StreamChannelTicker, tickerResponse(*ticker))
+	}
+	for _, accountID := range accounts {
+		if assets, exists := balances[accountID]; exists {
+			h.publishLocked(StreamChannelAccount+":"+accountID, fiber.Map{"orders": orders[accountID], "balances": assets})
+		}
+	}
+}
+
+// publishDepthLocked sends the levels of depth that differ from the book as last sent,
+// unless the last subscriber of the market left meanwhile
+func (h *StreamHub) publishDepthLocked(marketID string, depth bookDepth) {
+	previous, exists := h.depths[marketID]
+	if !exists {
+		return
+	}
+	bids := depthLevels(depth[OrderSideBuy], previous[OrderSideBuy], true)
+	asks := depthLevels(depth[OrderSideSell], previous[OrderSideSell], false)
+	h.depths[marketID] = depth
+	if len(bids) > 0 || len(asks) > 0 {
+		h.publishLocked(StreamChannelDepth+":"+marketID, fiber.Map{"bids": bids, "asks": asks})
+	}
+}
+
+// OnBalanceChange sends the balance of an asset that changed outside the exchange,
+// through a deposit or a withdrawal
+func (h *StreamHub) OnBalanceChange(accountID string, asset types.AssetId) {
+	channel := StreamChannelAccount + ":" + accountID
+	defer h.lockChannels(channel)()
+	h.mu.Lock()
+	followed := len(h.subscribers[channel]) > 0
+	h.mu.Unlock()
+	if !followed {
+		return
+	}
+	balances, err := h.assets(accountID, []types.AssetId{asset})
+	if err != nil {
+		logrus.WithError(err).WithField("accountId", accountID).Error("Error streaming balances")
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishLocked(channel, fiber.Map{"balances": balances})
+}
+
+// Handle runs a message the client sent
+func (h *StreamHub) Handle(client *StreamClient, raw []byte) {
+	var request types.StreamRequest
+	if err := json.Unmarshal(raw, &request); err != nil {
+		h.fail(client, "", domainerrors.ErrInvalidStreamMessage)
+		return
+	}
+	switch request.Op {
+	case "subscribe":
+		if err := h.Subscribe(client, request.Channel); err != nil {
+			h.fail(client, request.Channel, err)
+		}
+	case "unsubscribe":
+		h.Unsubscribe(client, request.Channel)
+	default:
+		h.fail(client, request.Channel, domainerrors.ErrInvalidStreamMessage)
+	}
+}
+
+// fail tells the client why its message was refused, in its language
+func (h *StreamHub) fail(client *StreamClient, channel string, err error) {
+	var domainErr *domainerrors.Error
+	if !errors.As(err, &domainErr) {
+		logrus.WithError(err).WithField("channel", channel).Error("Error handling stream message")
+		domainErr = domainerrors.ErrInternal
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deliverLocked(client, types.StreamMessage{
+		Type:    StreamMessageError,
+		Channel: channel,
+		Code:    domainErr.Code,
+		Message: i18n.Translate(client.locale, domainErr.Code, domainErr.Message),
+	})
+}
+
+// Serve runs a WebSocket connection: what the client sends is handled as it
+// arrives while its messages are written from another goroutine
+func (h *StreamHub) Serve(ws *wsConn, client *StreamClient) {
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		h.write(ws, client)
+	}()
+	for {
+		message, err := ws.ReadMessage(time.Now().Add(streamReadTimeout))
+		if err != nil {
+			break
+		}
+		h.Handle(client, message)
+	}
+	h.Disconnect(client)
+	<-written
+}
+
+func (h *StreamHub) write(ws *wsConn, client *StreamClient) {
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case message, open := <-client.send:
+			if !open {
+				if client.slow {
+					ws.Close(wsClosePolicyViolation, "slow consumer")
+				} else {
+					ws.Close(wsCloseNormal, "")
+				}
+				return
+			}
+			if err := ws.WriteText(message, time.Now().Add(streamWriteTimeout)); err != nil {
+				ws.conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := ws.Ping(time.Now().Add(streamWriteTimeout)); err != nil {
+				ws.conn.Close()
+				return
+			}
+		}
+	}
+}
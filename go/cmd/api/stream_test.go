@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/i18n"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// stream returns a hub fed by the fixture's exchange
+func (f *exchangeFixture) stream() *StreamHub {
+	tickers := NewTickerService(f.orders, f.exchange.trades)
+	tickers.Now = func() time.Time { return f.now }
+	stream := NewStreamHub(f.orders, f.exchange.trades, f.balances, tickers)
+	stream.Now = func() time.Time { return f.now }
+	f.exchange.AddBookListener(tickers)
+	f.exchange.AddTradeListener(stream)
+	f.exchange.AddBookListener(stream)
+	return stream
+}
+
+// streamMessage is a message of the stream as a client decodes it
+type streamMessage struct {
+	Type     string          `json:"type"`
+	Channel  string          `json:"channel"`
+	Sequence int64           `json:"sequence"`
+	Data     json.RawMessage `json:"data"`
+	Code     string          `json:"code"`
+}
+
+type depthLevel struct {
+	Price    string `json:"price"`
+	Quantity string `json:"quantity"`
+}
+
+type depthData struct {
+	Bids []depthLevel `json:"bids"`
+	Asks []depthLevel `json:"asks"`
+}
+
+// drain returns what was sent to client
+func drain(t *testing.T, client *StreamClient) []streamMessage {
+	messages := []streamMessage{}
+	for {
+		select {
+		case encoded, open := <-client.send:
+			if !open {
+				return messages
+			}
+			var message streamMessage
+			assert.NoError(t, json.Unmarshal(encoded, &message))
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func TestStreamDepth(t *testing.T) {
+	f := newExchangeFixture(t)
+	stream := f.stream()
+	f.asks(t)
+	client := stream.Connect("", i18n.DefaultLocale)
+
+	assert.NoError(t, stream.Subscribe(client, "depth:BTC-USD"))
+	buyer := f.account(t, "0", "1000")
+	f.limit(t, buyer, OrderSideBuy, "1.5", "100.5")
+	f.limit(t, buyer, OrderSideBuy, "1", "90")
+	messages := drain(t, client)
+
+	if assert.Len(t, messages, 3) {
+		var snapshot, take, rest depthData
+		assert.Equal(t, StreamMessageSnapshot, messages[0].Type)
+		assert.NoError(t, json.Unmarshal(messages[0].Data, &snapshot))
+		assert.Equal(t, []depthLevel{{"100", "1"}, {"101", "1"}, {"110", "1"}}, snapshot.Asks)
+		assert.Empty(t, snapshot.Bids)
+		// The bid took the best ask and rests for the rest
+		assert.NoError(t, json.Unmarshal(messages[1].Data, &take))
+		assert.Equal(t, []depthLevel{{"100", "0"}}, take.Asks)
+		assert.Equal(t, []depthLevel{{"100.5", "0.5"}}, take.Bids)
+		assert.NoError(t, json.Unmarshal(messages[2].Data, &rest))
+		assert.Equal(t, []depthLevel{{"90", "1"}}, rest.Bids)
+		assert.Empty(t, rest.Asks)
+		for i, message := range messages[1:] {
+			assert.Equal(t, StreamMessageUpdate, message.Type)
+			assert.Equal(t, messages[0].Sequence+int64(i)+1, message.Sequence)
+		}
+	}
+}
+
+func TestStreamAccount(t *testing.T) {
+	f := newExchangeFixture(t)
+	stream := f.stream()
+	maker := f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	owner := stream.Connect(buyer, i18n.DefaultLocale)
+	other := stream.Connect(maker, i18n.DefaultLocale)
+	anonymous := stream.Connect("", i18n.DefaultLocale)
+
+	assert.NoError(t, stream.Subscribe(owner, "account:"+buyer))
+	assert.ErrorIs(t, stream.Subscribe(other, "account:"+buyer), domainerrors.ErrAccountAccessDenied)
+	assert.ErrorIs(t, stream.Subscribe(anonymous, "account:"+buyer), domainerrors.ErrAuthenticationRequired)
+	order := f.limit(t, buyer, OrderSideBuy, "0.5", "100")
+	messages := drain(t, owner)
+
+	if assert.Len(t, messages, 2) {
+		var update struct {
+			Orders   []map[string]any `json:"orders"`
+			Balances []types.Asset    `json:"balances"`
+		}
+		assert.NoError(t, json.Unmarshal(messages[1].Data, &update))
+		if assert.Len(t, update.Orders, 1) {
+			assert.Equal(t, order.OrderID, update.Orders[0]["orderId"])
+			assert.Equal(t, OrderStatusFilled, update.Orders[0]["status"])
+		}
+		assert.Equal(t, []types.Asset{
+			{AssetID: types.AssetIdBTC, Quantity: dec("0.5"), Available: dec("0.5"), OnHold: dec("0")},
+			{AssetID: types.AssetIdUSD, Quantity: dec("950"), Available: dec("950"), OnHold: dec("0")},
+		}, update.Balances)
+	}
+	assert.Empty(t, drain(t, other))
+}
+
+func TestStreamDropsSlowClients(t *testing.T) {
+	f := newExchangeFixture(t)
+	stream := f.stream()
+	stream.Buffer = 2
+	f.asks(t)
+	slow := stream.Connect("", i18n.DefaultLocale)
+	assert.NoError(t, stream.Subscribe(slow, "trades:BTC-USD"))
+	buyer := f.account(t, "0", "1000")
+
+	_, _, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("2.5")})
+	f.exchange.Flush()
+
+	assert.NoError(t, err)
+	assert.Len(t, drain(t, slow), 2)
+	assert.True(t, slow.closed)
+	assert.True(t, slow.slow)
+	assert.Empty(t, stream.subscribers)
+}
+
+func TestStreamRejections(t *testing.T) {
+	f := newExchangeFixture(t)
+	stream := f.stream()
+	client := stream.Connect("", i18n.DefaultLocale)
+	testCases := []struct {
+		name         string
+		message      string
+		expectedCode string
+	}{
+		{"Not JSON", "subscribe", domainerrors.ErrInvalidStreamMessage.Code},
+		{"Unknown op", `{"op":"watch","channel":"ticker"}`, domainerrors.ErrInvalidStreamMessage.Code},
+		{"Unknown channel", `{"op":"subscribe","channel":"orders:BTC-USD"}`, domainerrors.ErrInvalidChannel.Code},
+		{"Ticker of a market", `{"op":"subscribe","channel":"ticker:BTC-USD"}`, domainerrors.ErrInvalidChannel.Code},
+		{"Unknown market", `{"op":"subscribe","channel":"depth:ETH-USD"}`, domainerrors.ErrMarketNotFound.Code},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stream.Handle(client, []byte(tc.message))
+			messages := drain(t, client)
+			if assert.Len(t, messages, 1) {
+				assert.Equal(t, StreamMessageError, messages[0].Type)
+				assert.Equal(t, tc.expectedCode, messages[0].Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Ticker is the summary of a market over the rolling window ending at Timestamp.
+// Prices are nil when there is nothing to take them from: LastPrice when the
+// market never traded, BestBid and BestAsk on an empty side of the book, and
+// Open, High, Low and ChangePercent when nothing traded in the window.
+type Ticker struct {
+	MarketID      string
+	LastPrice     *decimal.Decimal
+	BestBid       *decimal.Decimal
+	BestAsk       *decimal.Decimal
+	Open          *decimal.Decimal
+	High          *decimal.Decimal
+	Low           *decimal.Decimal
+	Volume        decimal.Decimal
+	QuoteVolume   decimal.Decimal
+	ChangePercent *decimal.Decimal
+	Timestamp     time.Time
+}
+
+// TickerService serves the tickers of the markets from a cache. A market's ticker
+// is rebuilt whenever its book changes, trades included, so reads find it ready.
+// It is never served older than MaxAge since the window moves on without trades,
+// and the reads that find it too old share a single rebuild.
+type TickerService struct {
+	orders IOrderDAO
+	trades ITradeDAO
+
+	Markets map[string]Market
+	Now     func() time.Time
+	Window  time.Duration
+	MaxAge  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]Ticker
+	// changes counts the book changes of each market, a ticker computed while
+	// one happened is served but not cached
+	changes map[string]int
+	// building are the rebuilds in progress by market
+	building map[string]*tickerBuild
+}
+
+// tickerBuild is a rebuild of a ticker, done is closed once ticker and err are set
+type tickerBuild struct {
+	changes int
+	done    chan struct{}
+	ticker  Ticker
+	err     error
+}
+
+func NewTickerService(orders IOrderDAO, trades ITradeDAO) *TickerService {
+	return &TickerService{
+		orders:   orders,
+		trades:   trades,
+		Markets:  DefaultMarkets,
+		Now:      time.Now,
+		Window:   24 * time.Hour,
+		MaxAge:   time.Second,
+		cache:    make(map[string]Ticker),
+		changes:  make(map[string]int),
+		building: make(map[string]*tickerBuild),
+	}
+}
+
+// tickerMaxAgeFromEnv reads TICKER_MAX_AGE, one second by default
+func tickerMaxAgeFromEnv() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("TICKER_MAX_AGE")); err == nil && value > 0 {
+		return value
+	}
+	return time.Second
+}
+
+// OnBookChange rebuilds the ticker of the market that changed
+func (s *TickerService) OnBookChange(change BookChange) {
+	s.mu.Lock()
+	delete(s.cache, change.MarketID)
+	s.changes[change.MarketID]++
+	s.mu.Unlock()
+	if _, err := s.rebuild(change.MarketID); err != nil {
+		logrus.WithError(err).WithField("marketId", change.MarketID).Error("Error refreshing ticker")
+	}
+}
+
+// Get returns the ticker of a market
+func (s *TickerService) Get(marketID string) (Ticker, error) {
+	if _, exists := s.Markets[marketID]; !exists {
+		return Ticker{}, domainerrors.ErrMarketNotFound
+	}
+	now := s.Now()
+	s.mu.Lock()
+	cached, exists := s.cache[marketID]
+	s.mu.Unlock()
+	if exists && now.Sub(cached.Timestamp) < s.MaxAge {
+		return cached, nil
+	}
+	return s.rebuild(marketID)
+}
+
+// rebuild computes the ticker of a market and caches it. A read that comes while
+// it is computed waits for the same ticker, unless the book changed since it started.
+func (s *TickerService) rebuild(marketID string) (Ticker, error) {
+	s.mu.Lock()
+	changes := s.changes[marketID]
+	if build, exists := s.building[marketID]; exists && build.changes == changes {
+		s.mu.Unlock()
+		<-build.done
+		return build.ticker, build.err
+	}
+	build := &tickerBuild{changes: changes, done: make(chan struct{})}
+	s.building[marketID] = build
+	s.mu.Unlock()
+
+	build.ticker, build.err = s.compute(marketID, s.Now())
+	s.mu.Lock()
+	if s.building[marketID] == build {
+		delete(s.building, marketID)
+	}
+	if build.err == nil && s.changes[marketID] == changes {
+		s.cache[marketID] = build.ticker
+	}
+	s.mu.Unlock()
+	close(build.done)
+	return build.ticker, build.err
+}
+
+// List returns the tickers of every market, by market id
+func (s *TickerService) List() ([]Ticker, error) {
+	marketIDs := make([]string, 0, len(s.Markets))
+	for marketID := range s.Markets {
+		marketIDs = append(marketIDs, marketID)
+	}
+	slices.Sort(marketIDs)
+	tickers := make([]Ticker, 0, len(marketIDs))
+	for _, marketID := range marketIDs {
+		ticker, err := s.Get(marketID)
+		if err != nil {
+			return nil, err
+		}
+		tickers = append(tickers, ticker)
+	}
+	return tickers, nil
+}
+
+func (s *TickerService) compute(marketID string, now time.Time) (Ticker, error) {
+	ticker := Ticker{MarketID: marketID, Timestamp: now}
+	last, err := s.trades.Last(marketID)
+	if err != nil {
+		return Ticker{}, err
+	}
+	if last != nil {
+		ticker.LastPrice = &last.Price
+	}
+	resting, err := s.orders.ListOpen(marketID)
+	if err != nil {
+		return Ticker{}, err
+	}
+	if bids := bookSide(resting, OrderSideBuy, now); len(bids) > 0 {
+		ticker.BestBid = &bids[0].Price
+	}
+	if asks := bookSide(resting, OrderSideSell, now); len(asks) > 0 {
+		ticker.BestAsk = &asks[0].Price
+	}
+	summary, err := s.trades.SummarySince(marketID, now.Add(-s.Window))
+	if err != nil {
+		return Ticker{}, err
+	}
+	ticker.Volume, ticker.QuoteVolume = summary.Volume, summary.QuoteVolume
+	if summary.Count > 0 && last != nil {
+		ticker.Open, ticker.High, ticker.Low = &summary.Open, &summary.High, &summary.Low
+		change := last.Price.Sub(summary.Open).Div(summary.Open).Mul(decimal.NewFromInt(100)).Round(2)
+		ticker.ChangePercent = &change
+	}
+	return ticker, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// tickers returns a ticker service over the fixture's book, reading its clock without advancing it
+func (f *exchangeFixture) tickers() *TickerService {
+	tickers := NewTickerService(f.orders, f.exchange.trades)
+	tickers.Now = func() time.Time { return f.now }
+	f.exchange.AddBookListener(tickers)
+	return tickers
+}
+
+func orNone(value *decimal.Decimal) string {
+	if value == nil {
+		return "none"
+	}
+	return value.String()
+}
+
+func TestTicker(t *testing.T) {
+	f := newExchangeFixture(t)
+	tickers := f.tickers()
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	f.limit(t, buyer, OrderSideBuy, "1", "90")
+
+	_, _, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("1.5")})
+	assert.NoError(t, err)
+	ticker, err := tickers.Get("BTC-USD")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "101", orNone(ticker.LastPrice))
+	assert.Equal(t, "90", orNone(ticker.BestBid))
+	assert.Equal(t, "101", orNone(ticker.BestAsk))
+	assert.Equal(t, "100", orNone(ticker.Open))
+	assert.Equal(t, "101", orNone(ticker.High))
+	assert.Equal(t, "100", orNone(ticker.Low))
+	assert.Equal(t, "1.5", ticker.Volume.String())
+	assert.Equal(t, "150.5", ticker.QuoteVolume.String())
+	assert.Equal(t, "1", orNone(ticker.ChangePercent))
+}
+
+func TestTickerCache(t *testing.T) {
+	f := newExchangeFixture(t)
+	tickers := f.tickers()
+	tickers.Window, tickers.MaxAge = time.Minute, 5*time.Minute
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	f.limit(t, buyer, OrderSideBuy, "1", "100")
+	_, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+
+	// The window moves on without trades, which is only seen once the ticker gets too old
+	f.now = f.now.Add(2 * time.Minute)
+	cached, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", orNone(cached.Open))
+	f.now = f.now.Add(5 * time.Minute)
+	aged, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "none", orNone(aged.Open))
+
+	// A change of the book is seen right away
+	f.limit(t, buyer, OrderSideBuy, "1", "95")
+	changed, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "95", orNone(changed.BestBid))
+	f.limit(t, buyer, OrderSideBuy, "1", "101")
+	traded, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "101", orNone(traded.LastPrice))
+	assert.Equal(t, "110", orNone(traded.BestAsk))
+}
+
+func TestTickerWindow(t *testing.T) {
+	trades := NewTradeDAOMemory()
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	for _, trade := range []struct {
+		at    time.Time
+		price string
+	}{
+		{now.Add(-25 * time.Hour), "80"},
+		{now.Add(-23 * time.Hour), "100"},
+		{now.Add(-time.Hour), "90"},
+	} {
+		assert.NoError(t, trades.Save(&Trade{TradeID: uuid.NewString(), MarketID: "BTC-USD", Side: OrderSideBuy, Quantity: dec("1"), Price: dec(trade.price), Timestamp: trade.at}))
+	}
+	tickers := NewTickerService(NewOrderDAOMemory(), trades)
+	tickers.Now = func() time.Time { return now }
+
+	ticker, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", orNone(ticker.Open))
+	assert.Equal(t, "90", orNone(ticker.Low))
+	assert.Equal(t, "2", ticker.Volume.String())
+	assert.Equal(t, "-10", orNone(ticker.ChangePercent))
+	assert.Equal(t, "none", orNone(ticker.BestBid))
+
+	// A day without trades keeps the last price only
+	now = now.Add(24 * time.Hour)
+	quiet, err := tickers.Get("BTC-USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "90", orNone(quiet.LastPrice))
+	assert.Equal(t, "none", orNone(quiet.Open))
+	assert.Equal(t, "none", orNone(quiet.ChangePercent))
+	assert.Equal(t, "0", quiet.Volume.String())
+
+	_, err = tickers.Get("ETH-USD")
+	assert.ErrorIs(t, err, domainerrors.ErrMarketNotFound)
+}
+
+func TestTickerRefreshedOnBookChange(t *testing.T) {
+	f := newExchangeFixture(t)
+	tickers := f.tickers()
+
+	f.asks(t)
+
+	cached, exists := tickers.cache["BTC-USD"]
+	assert.True(t, exists)
+	assert.Equal(t, "100", orNone(cached.BestAsk))
+}
+
+// blockingTrades counts the reads of the last trade and holds them until release is closed
+type blockingTrades struct {
+	ITradeDAO
+	reads   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blockingTrades) Last(marketID string) (*Trade, error) {
+	b.reads.Add(1)
+	<-b.release
+	return b.ITradeDAO.Last(marketID)
+}
+
+func TestTickerReadsShareARebuild(t *testing.T) {
+	trades := &blockingTrades{ITradeDAO: NewTradeDAOMemory(), release: make(chan struct{})}
+	tickers := NewTickerService(NewOrderDAOMemory(), trades)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tickers.Get("BTC-USD")
+			assert.NoError(t, err)
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(trades.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), trades.reads.Load())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Page sizes of the trade listings
+const (
+	DefaultTradePageSize = 50
+	MaxTradePageSize     = 500
+)
+
+// Fill is a trade seen from one of the accounts that took part in it
+type Fill struct {
+	Trade Trade
+	// OrderID and Side are those of the account's order
+	OrderID  string
+	Side     string
+	Fee      decimal.Decimal
+	FeeAsset types.AssetId
+	Maker    bool
+}
+
+// fillOf returns the side of trade that accountID took. An account trading with
+// itself sees the taker side.
+func fillOf(trade Trade, accountID string) Fill {
+	fill := Fill{Trade: trade, Side: OrderSideBuy, OrderID: trade.BuyOrderID}
+	if trade.BuyAccountID != accountID || (trade.SellAccountID == accountID && trade.Side == OrderSideSell) {
+		fill.Side, fill.OrderID = OrderSideSell, trade.SellOrderID
+	}
+	fill.Fee, fill.FeeAsset, fill.Maker = trade.feeOf(fill.Side)
+	return fill
+}
+
+// EncodeTradeCursor returns the opaque cursor that continues a listing after trade
+func EncodeTradeCursor(trade Trade) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d", trade.Timestamp.UnixNano(), trade.Sequence))
+}
+
+func decodeTradeCursor(cursor string) (*TradeCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domainerrors.ErrInvalidCursor
+	}
+	var nanos, sequence int64
+	if _, err := fmt.Sscanf(string(raw), "%d.%d", &nanos, &sequence); err != nil || sequence <= 0 {
+		return nil, domainerrors.ErrInvalidCursor
+	}
+	return &TradeCursor{Timestamp: time.Unix(0, nanos), Sequence: sequence}, nil
+}
+
+// parsePageSize reads the limit query parameter, DefaultTradePageSize when empty
+func parsePageSize(value string) (int, error) {
+	if value == "" {
+		return DefaultTradePageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MaxTradePageSize {
+		return 0, domainerrors.ErrInvalidLimit
+	}
+	return limit, nil
+}
+
+// tradePage runs a newest first listing and returns the cursor of the next page,
+// empty when this one is the last
+func tradePage(cursor, limit string, list func(before *TradeCursor, limit int) ([]Trade, error)) ([]Trade, string, error) {
+	before, err := decodeTradeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	size, err := parsePageSize(limit)
+	if err != nil {
+		return nil, "", err
+	}
+	// One more than asked tells whether there is a next page
+	trades, err := list(before, size+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(trades) <= size {
+		return trades, "", nil
+	}
+	trades = trades[:size]
+	return trades, EncodeTradeCursor(trades[size-1]), nil
+}
+
+// MarketTrades is the public feed of the latest trades of a market
+func (e *Exchange) MarketTrades(marketID, cursor, limit string) ([]Trade, string, error) {
+	if _, exists := e.Markets[marketID]; !exists {
+		return nil, "", domainerrors.ErrMarketNotFound
+	}
+	return tradePage(cursor, limit, func(before *TradeCursor, size int) ([]Trade, error) {
+		return e.trades.ListByMarket(marketID, before, size)
+	})
+}
+
+// AccountTrades returns the fills of an account across markets, newest first
+func (e *Exchange) AccountTrades(accountID, cursor, limit string) ([]Fill, string, error) {
+	trades, next, err := tradePage(cursor, limit, func(before *TradeCursor, size int) ([]Trade, error) {
+		return e.trades.ListByAccount(accountID, before, size)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	fills := make([]Fill, 0, len(trades))
+	for _, trade := range trades {
+		fills = append(fills, fillOf(trade, accountID))
+	}
+	return fills, next, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarketTradesPagination(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.asks(t)
+	buyer := f.account(t, "0", "1000")
+	// Three trades at the same instant, then two more
+	_, sweep, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("2.5")})
+	assert.NoError(t, err)
+	_, last, err := f.exchange.Place(buyer, types.PlaceOrderRequest{MarketID: "BTC-USD", Side: OrderSideBuy, Type: OrderTypeMarket, Quantity: dec("0.5")})
+	assert.NoError(t, err)
+	expected := []string{last[0].TradeID, sweep[2].TradeID, sweep[1].TradeID, sweep[0].TradeID}
+
+	var seen []string
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		trades, next, err := f.exchange.MarketTrades("BTC-USD", cursor, "3")
+		assert.NoError(t, err)
+		for _, trade := range trades {
+			seen = append(seen, trade.TradeID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	assert.Equal(t, expected, seen)
+}
+
+func TestMarketTradesRejections(t *testing.T) {
+	f := newExchangeFixture(t)
+	testCases := []struct {
+		name        string
+		marketID    string
+		cursor      string
+		limit       string
+		expectedErr error
+	}{
+		{"Unknown market", "ETH-USD", "", "", domainerrors.ErrMarketNotFound},
+		{"Garbage cursor", "BTC-USD", "not a cursor!", "", domainerrors.ErrInvalidCursor},
+		{"Cursor without sequence", "BTC-USD", "MTIz", "", domainerrors.ErrInvalidCursor},
+		{"Zero limit", "BTC-USD", "", "0", domainerrors.ErrInvalidLimit},
+		{"Limit too large", "BTC-USD", "", "501", domainerrors.ErrInvalidLimit},
+		{"Limit not a number", "BTC-USD", "", "ten", domainerrors.ErrInvalidLimit},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := f.exchange.MarketTrades(tc.marketID, tc.cursor, tc.limit)
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestAccountTradesShowTheAccountSide(t *testing.T) {
+	f := newExchangeFixture(t)
+	f.exchange.Fees.Schedules = map[string]FeeSchedule{"BTC-USD": {{MinVolume: dec("0"), MakerRate: dec("0.001"), TakerRate: dec("0.002")}}}
+	seller := f.account(t, "1", "0")
+	buyer := f.account(t, "0", "1000")
+	sell := f.limit(t, seller, OrderSideSell, "1", "100")
+	buy := f.limit(t, buyer, OrderSideBuy, "1", "100")
+
+	sellerFills, next, err := f.exchange.AccountTrades(seller, "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, next)
+	buyerFills, _, err := f.exchange.AccountTrades(buyer, "", "")
+	assert.NoError(t, err)
+
+	if assert.Len(t, sellerFills, 1) && assert.Len(t, buyerFills, 1) {
+		assert.Equal(t, OrderSideSell, sellerFills[0].Side)
+		assert.Equal(t, sell.OrderID, sellerFills[0].OrderID)
+		assert.True(t, sellerFills[0].Maker)
+		assert.Equal(t, "0.1", sellerFills[0].Fee.String())
+		assert.Equal(t, types.AssetIdUSD, sellerFills[0].FeeAsset)
+		assert.Equal(t, OrderSideBuy, buyerFills[0].Side)
+		assert.Equal(t, buy.OrderID, buyerFills[0].OrderID)
+		assert.False(t, buyerFills[0].Maker)
+		assert.Equal(t, "0.002", buyerFills[0].Fee.String())
+	}
+	others, _, err := f.exchange.AccountTrades(f.account(t, "0", "0"), "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, others)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/totp"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// StepUpPolicy holds the per-asset quantities above which a withdrawal needs a second factor
+type StepUpPolicy struct {
+	Thresholds map[types.AssetId]decimal.Decimal
+}
+
+var DefaultStepUpPolicy = StepUpPolicy{
+	Thresholds: map[types.AssetId]decimal.Decimal{
+		types.AssetIdBTC: decimal.RequireFromString("0.1"),
+		types.AssetIdUSD: decimal.NewFromInt(1000),
+	},
+}
+
+// NewStepUpPolicyFromEnv reads STEP_UP_THRESHOLDS as comma separated ASSET=QUANTITY pairs,
+// e.g. "BTC=0.5,USD=2000", keeping the defaults for assets that are not listed
+func NewStepUpPolicyFromEnv() StepUpPolicy {
+	policy := StepUpPolicy{Thresholds: make(map[types.AssetId]decimal.Decimal)}
+	for asset, threshold := range DefaultStepUpPolicy.Thresholds {
+		policy.Thresholds[asset] = threshold
+	}
+	for _, pair := range strings.Split(os.Getenv("STEP_UP_THRESHOLDS"), ",") {
+		asset, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			continue
+		}
+		threshold, err := decimal.NewFromString(strings.TrimSpace(value))
+		if err != nil || threshold.IsNegative() {
+			logrus.WithField("pair", pair).Warn("Ignoring invalid step-up threshold")
+			continue
+		}
+		policy.Thresholds[types.AssetId(strings.ToUpper(strings.TrimSpace(asset)))] = threshold
+	}
+	return policy
+}
+
+// Requires reports whether moving quantity of asset needs a second factor. Assets
+// without a threshold always do.
+func (p StepUpPolicy) Requires(asset types.AssetId, quantity decimal.Decimal) bool {
+	threshold, exists := p.Thresholds[asset]
+	return !exists || quantity.GreaterThan(threshold)
+}
+
+// TwoFactorService enrolls authenticator apps and checks their codes or recovery codes
+type TwoFactorService struct {
+	accounts IAccountDAO
+	store    ITwoFactorDAO
+	attempts ILoginAttemptDAO
+
+	Now               func() time.Time
+	Issuer            string
+	RecoveryCodeCount int
+	StepUp            StepUpPolicy
+	// MaxFailures invalid codes within FailureWindow lock Verify for the account during LockoutDuration
+	MaxFailures     int
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+}
+
+func NewTwoFactorService(accounts IAccountDAO, store ITwoFactorDAO, attempts ILoginAttemptDAO) *TwoFactorService {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "CCCA Exchange"
+	}
+	return &TwoFactorService{
+		accounts:          accounts,
+		store:             store,
+		attempts:          attempts,
+		Now:               time.Now,
+		Issuer:            issuer,
+		RecoveryCodeCount: 10,
+		StepUp:            DefaultStepUpPolicy,
+		MaxFailures:       5,
+		FailureWindow:     time.Hour,
+		LockoutDuration:   15 * time.Minute,
+	}
+}
+
+// Enroll starts or restarts an enrollment and returns the secret and its otpauth:// URI.
+// Codes are not required until the enrollment is confirmed.
+func (s *TwoFactorService) Enroll(accountID string) (string, string, error) {
+	account, err := s.accounts.GetByID(accountID)
+	if err != nil {
+		return "", "", err
+	}
+	if account == nil {
+		return "", "", domainerrors.ErrAccountNotFound
+	}
+	existing, err := s.store.GetByAccountID(accountID)
+	if err != nil {
+		return "", "", err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return "", "", domainerrors.ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.store.Save(&TwoFactor{AccountID: accountID, Secret: secret}); err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(s.Issuer, account.Email, secret), nil
+}
+
+// Confirm enables the enrollment with a first valid code and returns the recovery codes,
+// which are only ever shown here
+func (s *TwoFactorService) Confirm(accountID, code string) ([]string, error) {
+	twoFactor, err := s.store.GetByAccountID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, domainerrors.ErrTwoFactorNotEnrolled
+	}
+	if twoFactor.ConfirmedAt != nil {
+		return nil, domainerrors.ErrTwoFactorAlreadyEnabled
+	}
+	now := s.Now()
+	step, ok := totp.Validate(twoFactor.Secret, code, now)
+	if !ok {
+		return nil, domainerrors.ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.ReplaceRecoveryCodes(accountID, hashes); err != nil {
+		return nil, err
+	}
+	twoFactor.ConfirmedAt = &now
+	twoFactor.LastUsedStep = step
+	if err := s.store.Save(twoFactor); err != nil {
+		return nil, err
+	}
+	logrus.WithField("accountId", accountID).Info("Two-factor authentication enabled")
+	return codes, nil
+}
+
+// Enabled reports whether the account has a confirmed enrollment
+func (s *TwoFactorService) Enabled(accountID string) (bool, error) {
+	twoFactor, err := s.store.GetByAccountID(accountID)
+	if err != nil {
+		return false, err
+	}
+	return twoFactor != nil && twoFactor.ConfirmedAt != nil, nil
+}
+
+func twoFactorThrottleKey(accountID string) string {
+	return "two_factor:" + accountID
+}
+
+// Verify accepts a current authenticator code, each at most once, or an unused recovery code.
+// Every caller shares one count of invalid codes per account, too many lock it for a while
+// so neither a six digit code nor a recovery code can be guessed.
+func (s *TwoFactorService) Verify(accountID, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return domainerrors.ErrTwoFactorRequired
+	}
+	twoFactor, err := s.store.GetByAccountID(accountID)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || twoFactor.ConfirmedAt == nil {
+		return domainerrors.ErrTwoFactorNotEnabled
+	}
+	now := s.Now()
+	key := twoFactorThrottleKey(accountID)
+	attempts, err := s.attempts.Get(key)
+	if err != nil {
+		return err
+	}
+	if attempts != nil && attempts.LockedUntil != nil && now.Before(*attempts.LockedUntil) {
+		return domainerrors.ErrTwoFactorLocked
+	}
+	err = s.check(twoFactor, code, now)
+	if errors.Is(err, domainerrors.ErrInvalidTwoFactorCode) {
+		return s.failure(accountID, now)
+	}
+	if err != nil {
+		return err
+	}
+	if attempts != nil {
+		return s.attempts.Reset(key)
+	}
+	return nil
+}
+
+func (s *TwoFactorService) check(twoFactor *TwoFactor, code string, now time.Time) error {
+	if step, ok := totp.Validate(twoFactor.Secret, code, now); ok {
+		fresh, err := s.store.UseStep(twoFactor.AccountID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			// A code seen by an eavesdropper must not work a second time
+			return domainerrors.ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	used, err := s.store.UseRecoveryCode(twoFactor.AccountID, hashRecoveryCode(code), now)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return domainerrors.ErrInvalidTwoFactorCode
+	}
+	logrus.WithField("accountId", twoFactor.AccountID).Warn("Recovery code used")
+	return nil
+}
+
+// failure counts an invalid code and locks the account once there were too many
+func (s *TwoFactorService) failure(accountID string, now time.Time) error {
+	key := twoFactorThrottleKey(accountID)
+	failures, err := s.attempts.RecordFailure(key, now, s.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if failures < s.MaxFailures {
+		return domainerrors.ErrInvalidTwoFactorCode
+	}
+	if err := s.attempts.Lock(key, now.Add(s.LockoutDuration)); err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{"accountId": accountID, "failures": failures}).Warn("Two-factor verification locked")
+	return domainerrors.ErrTwoFactorLocked
+}
+
+// Disable removes the enrollment after checking a code
+func (s *TwoFactorService) Disable(accountID, code string) error {
+	if err := s.Verify(accountID, code); err != nil {
+		return err
+	}
+	logrus.WithField("accountId", accountID).Info("Two-factor authentication disabled")
+	return s.store.Delete(accountID)
+}
+
+// RequireStepUp checks code when the account has two-factor enabled and the
+// quantity is above the step-up threshold of the asset. Every route that moves
+// funds out of an account calls it: /withdraw today, /transfer once it exists.
+func (s *TwoFactorService) RequireStepUp(accountID string, asset types.AssetId, quantity decimal.Decimal, code string) error {
+	if !s.StepUp.Requires(asset, quantity) {
+		return nil
+	}
+	enabled, err := s.Enabled(accountID)
+	if err != nil || !enabled {
+		return err
+	}
+	return s.Verify(accountID, code)
+}
+
+// Recovery codes are random enough that a fast hash is sufficient at rest
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes returns codes formatted as XXXXX-XXXXX and their hashes
+func (s *TwoFactorService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, s.RecoveryCodeCount)
+	hashes := make([]string, 0, s.RecoveryCodeCount)
+	for i := 0; i < s.RecoveryCodeCount; i++ {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		encoded := base32.StdEncoding.EncodeToString(random)[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
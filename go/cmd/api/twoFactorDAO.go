@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// TwoFactor is the TOTP enrollment of an account, enforced once ConfirmedAt is set
+type TwoFactor struct {
+	AccountID    string
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+// RecoveryCode is a one-time fallback for a lost authenticator, stored hashed
+type RecoveryCode struct {
+	AccountID string
+	CodeHash  string
+	UsedAt    *time.Time
+}
+
+// ITwoFactorDAO defines the interface for TOTP enrollment and recovery code storage
+type ITwoFactorDAO interface {
+	Save(twoFactor *TwoFactor) error
+	GetByAccountID(accountID string) (*TwoFactor, error)
+	Delete(accountID string) error
+	// UseStep records the step of an accepted code and returns false if it is not newer than the last one
+	UseStep(accountID string, step int64) (bool, error)
+	ReplaceRecoveryCodes(accountID string, codeHashes []string) error
+	// UseRecoveryCode consumes the code and returns false if it does not exist or was already used
+	UseRecoveryCode(accountID string, codeHash string, usedAt time.Time) (bool, error)
+}
+
+// TwoFactorDAODatabase implements ITwoFactorDAO using PostgreSQL database
+type TwoFactorDAODatabase struct {
+	db *Database
+}
+
+func NewTwoFactorDAODatabase(db *Database) *TwoFactorDAODatabase {
+	return &TwoFactorDAODatabase{db: db}
+}
+
+func (dao *TwoFactorDAODatabase) Save(twoFactor *TwoFactor) error {
+	query := `INSERT INTO ccca.account_totp (account_id, secret, confirmed_at, last_used_step) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id) DO UPDATE SET secret = EXCLUDED.secret, confirmed_at = EXCLUDED.confirmed_at, last_used_step = EXCLUDED.last_used_step`
+	_, err := dao.db.DB.Exec(query, twoFactor.AccountID, twoFactor.Secret, twoFactor.ConfirmedAt, twoFactor.LastUsedStep)
+	return err
+}
+
+func (dao *TwoFactorDAODatabase) GetByAccountID(accountID string) (*TwoFactor, error) {
+	query := "SELECT account_id, secret, confirmed_at, last_used_step FROM ccca.account_totp WHERE account_id = $1"
+	twoFactor := &TwoFactor{}
+	var confirmedAt sql.NullTime
+	err := dao.db.DB.QueryRow(query, accountID).Scan(&twoFactor.AccountID, &twoFactor.Secret, &confirmedAt, &twoFactor.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if confirmedAt.Valid {
+		twoFactor.ConfirmedAt = &confirmedAt.Time
+	}
+	return twoFactor, nil
+}
+
+func (dao *TwoFactorDAODatabase) Delete(accountID string) error {
+	tx, err := dao.db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM ccca.account_recovery_code WHERE account_id = $1", accountID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM ccca.account_totp WHERE account_id = $1", accountID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (dao *TwoFactorDAODatabase) UseStep(accountID string, step int64) (bool, error) {
+	result, err := dao.db.DB.Exec("UPDATE ccca.account_totp SET last_used_step = $1 WHERE account_id = $2 AND last_used_step < $1", step, accountID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (dao *TwoFactorDAODatabase) ReplaceRecoveryCodes(accountID string, codeHashes []string) error {
+	tx, err := dao.db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM ccca.account_recovery_code WHERE account_id = $1", accountID); err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO ccca.account_recovery_code (account_id, code_hash) VALUES ($1, $2)", accountID, codeHash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (dao *TwoFactorDAODatabase) UseRecoveryCode(accountID string, codeHash string, usedAt time.Time) (bool, error) {
+	query := "UPDATE ccca.account_recovery_code SET used_at = $1 WHERE account_id = $2 AND code_hash = $3 AND used_at IS NULL"
+	result, err := dao.db.DB.Exec(query, usedAt, accountID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// TwoFactorDAOMemory implements ITwoFactorDAO using in-memory storage
+type TwoFactorDAOMemory struct {
+	mu            sync.Mutex
+	enrollments   map[string]*TwoFactor
+	recoveryCodes map[string][]*RecoveryCode
+}
+
+func NewTwoFactorDAOMemory() *TwoFactorDAOMemory {
+	return &TwoFactorDAOMemory{
+		enrollments:   make(map[string]*TwoFactor),
+		recoveryCodes: make(map[string][]*RecoveryCode),
+	}
+}
+
+func (dao *TwoFactorDAOMemory) Save(twoFactor *TwoFactor) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	stored := *twoFactor
+	dao.enrollments[twoFactor.AccountID] = &stored
+	return nil
+}
+
+func (dao *TwoFactorDAOMemory) GetByAccountID(accountID string) (*TwoFactor, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	twoFactor, exists := dao.enrollments[accountID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *twoFactor
+	return &copied, nil
+}
+
+func (dao *TwoFactorDAOMemory) Delete(accountID string) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	delete(dao.enrollments, accountID)
+	delete(dao.recoveryCodes, accountID)
+	return nil
+}
+
+func (dao *TwoFactorDAOMemory) UseStep(accountID string, step int64) (bool, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	twoFactor, exists := dao.enrollments[accountID]
+	if !exists || twoFactor.LastUsedStep >= step {
+		return false, nil
+	}
+	twoFactor.LastUsedStep = step
+	return true, nil
+}
+
+func (dao *TwoFactorDAOMemory) ReplaceRecoveryCodes(accountID string, codeHashes []string) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	codes := make([]*RecoveryCode, 0, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes = append(codes, &RecoveryCode{AccountID: accountID, CodeHash: codeHash})
+	}
+	dao.recoveryCodes[accountID] = codes
+	return nil
+}
+
+func (dao *TwoFactorDAOMemory) UseRecoveryCode(accountID string, codeHash string, usedAt time.Time) (bool, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	for _, code := range dao.recoveryCodes[accountID] {
+		if code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
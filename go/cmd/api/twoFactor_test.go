@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/totp"
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+const twoFactorAccountID = "550e8400-e29b-41d4-a716-446655440000"
+
+type twoFactorFixture struct {
+	service  *TwoFactorService
+	accounts *AccountDAOMemory
+	now      time.Time
+}
+
+func newTwoFactorFixture(t *testing.T) *twoFactorFixture {
+	f := &twoFactorFixture{
+		accounts: NewAccountDAOMemory(),
+		now:      time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	assert.NoError(t, f.accounts.Save(&Account{
+		AccountID: twoFactorAccountID,
+		Name:      "Gustavo B",
+		Email:     "gustavo@example.com",
+		Document:  "11144477735",
+		Status:    AccountStatusActive,
+	}))
+	f.service = NewTwoFactorService(f.accounts, NewTwoFactorDAOMemory(), NewLoginAttemptDAOMemory())
+	f.service.Now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *twoFactorFixture) code(t *testing.T, secret string) string {
+	code, err := totp.CodeAt(secret, totp.Step(f.now))
+	assert.NoError(t, err)
+	return code
+}
+
+// enable enrolls and confirms, returning the secret and recovery codes
+func (f *twoFactorFixture) enable(t *testing.T) (string, []string) {
+	secret, _, err := f.service.Enroll(twoFactorAccountID)
+	assert.NoError(t, err)
+	codes, err := f.service.Confirm(twoFactorAccountID, f.code(t, secret))
+	assert.NoError(t, err)
+	return secret, codes
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	secret, uri, err := f.service.Enroll(twoFactorAccountID)
+	assert.NoError(t, err)
+	parsed, _ := url.Parse(uri)
+	assert.Equal(t, secret, parsed.Query().Get("secret"))
+	assert.Contains(t, parsed.Path, "gustavo@example.com")
+
+	enabled, _ := f.service.Enabled(twoFactorAccountID)
+	assert.False(t, enabled, "enrollment is not enforced before confirmation")
+
+	_, err = f.service.Confirm(twoFactorAccountID, "000000")
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidTwoFactorCode)
+
+	codes, err := f.service.Confirm(twoFactorAccountID, f.code(t, secret))
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Regexp(t, `^[A-Z2-7]{5}-[A-Z2-7]{5}$`, codes[0])
+	enabled, _ = f.service.Enabled(twoFactorAccountID)
+	assert.True(t, enabled)
+
+	_, _, err = f.service.Enroll(twoFactorAccountID)
+	assert.ErrorIs(t, err, domainerrors.ErrTwoFactorAlreadyEnabled)
+}
+
+func TestTwoFactorConfirmWithoutEnrollment(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	_, err := f.service.Confirm(twoFactorAccountID, "123456")
+	assert.ErrorIs(t, err, domainerrors.ErrTwoFactorNotEnrolled)
+}
+
+func TestTwoFactorVerifyRejectsReplayedCode(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	secret, _ := f.enable(t)
+
+	// The confirmation code was already used for this step
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, f.code(t, secret)), domainerrors.ErrInvalidTwoFactorCode)
+
+	f.now = f.now.Add(totp.Period)
+	code := f.code(t, secret)
+	assert.NoError(t, f.service.Verify(twoFactorAccountID, code))
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, code), domainerrors.ErrInvalidTwoFactorCode)
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, ""), domainerrors.ErrTwoFactorRequired)
+}
+
+func TestTwoFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	_, codes := f.enable(t)
+
+	assert.NoError(t, f.service.Verify(twoFactorAccountID, codes[0]))
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, codes[0]), domainerrors.ErrInvalidTwoFactorCode)
+	// Users often type recovery codes without the dash or in lowercase
+	relaxed := codes[1][:5] + codes[1][6:]
+	assert.NoError(t, f.service.Verify(twoFactorAccountID, " "+relaxed+" "))
+}
+
+func TestTwoFactorVerifyLocksAfterTooManyInvalidCodes(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	secret, codes := f.enable(t)
+	f.now = f.now.Add(totp.Period)
+
+	// Guesses through step-up count like any other
+	for i := 1; i < f.service.MaxFailures; i++ {
+		assert.ErrorIs(t, f.service.RequireStepUp(twoFactorAccountID, types.AssetIdBTC, dec("1"), "000000"), domainerrors.ErrInvalidTwoFactorCode)
+	}
+	assert.ErrorIs(t, f.service.Disable(twoFactorAccountID, "000000"), domainerrors.ErrTwoFactorLocked)
+
+	// While locked even the right codes are refused
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, f.code(t, secret)), domainerrors.ErrTwoFactorLocked)
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, codes[0]), domainerrors.ErrTwoFactorLocked)
+
+	f.now = f.now.Add(f.service.LockoutDuration)
+	assert.NoError(t, f.service.Verify(twoFactorAccountID, f.code(t, secret)))
+	// A valid code starts the count over
+	assert.ErrorIs(t, f.service.Verify(twoFactorAccountID, "000000"), domainerrors.ErrInvalidTwoFactorCode)
+	assert.NoError(t, f.service.Verify(twoFactorAccountID, codes[0]))
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	_, codes := f.enable(t)
+
+	assert.ErrorIs(t, f.service.Disable(twoFactorAccountID, "000000"), domainerrors.ErrInvalidTwoFactorCode)
+	assert.NoError(t, f.service.Disable(twoFactorAccountID, codes[0]))
+	enabled, _ := f.service.Enabled(twoFactorAccountID)
+	assert.False(t, enabled)
+	assert.ErrorIs(t, f.service.Disable(twoFactorAccountID, codes[1]), domainerrors.ErrTwoFactorNotEnabled)
+}
+
+func TestTwoFactorRequireStepUp(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	f.service.StepUp = StepUpPolicy{Thresholds: map[types.AssetId]decimal.Decimal{types.AssetIdBTC: decimal.NewFromInt(1)}}
+
+	// Accounts without two-factor are not blocked
+	assert.NoError(t, f.service.RequireStepUp(twoFactorAccountID, types.AssetIdBTC, decimal.NewFromInt(5), ""))
+
+	secret, _ := f.enable(t)
+	assert.NoError(t, f.service.RequireStepUp(twoFactorAccountID, types.AssetIdBTC, decimal.NewFromInt(1), ""))
+	assert.ErrorIs(t, f.service.RequireStepUp(twoFactorAccountID, types.AssetIdBTC, decimal.RequireFromString("1.01"), ""), domainerrors.ErrTwoFactorRequired)
+	assert.ErrorIs(t, f.service.RequireStepUp(twoFactorAccountID, types.AssetIdUSD, decimal.NewFromInt(1), ""), domainerrors.ErrTwoFactorRequired, "assets without threshold always step up")
+
+	f.now = f.now.Add(totp.Period)
+	assert.NoError(t, f.service.RequireStepUp(twoFactorAccountID, types.AssetIdBTC, decimal.NewFromInt(5), f.code(t, secret)))
+}
+
+func TestNewStepUpPolicyFromEnv(t *testing.T) {
+	t.Setenv("STEP_UP_THRESHOLDS", "btc=0.5, USD=abc,ETH=2")
+	policy := NewStepUpPolicyFromEnv()
+	assert.True(t, decimal.RequireFromString("0.5").Equal(policy.Thresholds[types.AssetIdBTC]))
+	assert.True(t, DefaultStepUpPolicy.Thresholds[types.AssetIdUSD].Equal(policy.Thresholds[types.AssetIdUSD]))
+	assert.True(t, decimal.NewFromInt(2).Equal(policy.Thresholds["ETH"]))
+}
+
+func TestSessionLoginEnforcesTwoFactor(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	hash, _ := HashPassword("Vq7!mZt2Lp9x")
+	assert.NoError(t, f.accounts.UpdatePassword(twoFactorAccountID, hash))
+	sessions := NewSessionService(f.accounts, NewSessionDAOMemory())
+	sessions.SecondFactor = f.service
+	sessions.Now = func() time.Time { return f.now }
+
+	_, _, err := sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.NoError(t, err)
+
+	secret, _ := f.enable(t)
+	_, _, err = sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x"})
+	assert.ErrorIs(t, err, domainerrors.ErrTwoFactorRequired)
+	f.now = f.now.Add(totp.Period)
+	_, _, err = sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Wrong!Pass9x", TotpCode: f.code(t, secret)})
+	assert.ErrorIs(t, err, domainerrors.ErrInvalidCredentials)
+	_, _, err = sessions.Login(Credentials{Email: "gustavo@example.com", Password: "Vq7!mZt2Lp9x", TotpCode: f.code(t, secret)})
+	assert.NoError(t, err)
+}
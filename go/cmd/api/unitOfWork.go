@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/types"
+)
+
+// querier runs queries on the database or inside a transaction, *sql.DB and *sql.Tx both are one
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// inTransaction runs fn in a transaction of its own when q is the database, and
+// in the transaction q already is otherwise
+func inTransaction(q querier, fn func(tx querier) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		return fn(q)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExchangeTx is what an operation on the exchange or on its accounts writes through.
+// Its DAOs see what the operation wrote so far, nobody else does until it is committed.
+type ExchangeTx struct {
+	Accounts IAccountDAO
+	Holdings IAccountHoldingsDAO
+	Orders   IOrderDAO
+	Trades   ITradeDAO
+	Balances IBalanceDAO
+
+	lockMarket  func(marketID string) error
+	lockAccount func(accountID string, exclusive bool) error
+}
+
+// LockMarket keeps other operations on the market, on this server or another,
+// waiting until the transaction ends
+func (tx ExchangeTx) LockMarket(marketID string) error {
+	if tx.lockMarket == nil {
+		return nil
+	}
+	return tx.lockMarket(marketID)
+}
+
+// ShareAccount keeps the account from being closed until the transaction ends,
+// the operations that only share it do not wait for each other
+func (tx ExchangeTx) ShareAccount(accountID string) error {
+	if tx.lockAccount == nil {
+		return nil
+	}
+	return tx.lockAccount(accountID, false)
+}
+
+// LockAccount keeps every other operation locking or sharing the account waiting
+// until the transaction ends
+func (tx ExchangeTx) LockAccount(accountID string) error {
+	if tx.lockAccount == nil {
+		return nil
+	}
+	return tx.lockAccount(accountID, true)
+}
+
+// IUnitOfWork runs fn in a transaction, committed when fn returns nil and rolled back otherwise
+type IUnitOfWork interface {
+	Run(fn func(tx ExchangeTx) error) error
+}
+
+// UnitOfWorkDatabase implements IUnitOfWork using a PostgreSQL transaction
+type UnitOfWorkDatabase struct {
+	db *Database
+
+	// HouseAccountID is credited the fees of every market. Its ledger is written
+	// without waiting for the other units writing it, or the markets would wait on
+	// each other; its entries may be committed out of entry id order.
+	HouseAccountID string
+}
+
+func NewUnitOfWorkDatabase(db *Database) *UnitOfWorkDatabase {
+	return &UnitOfWorkDatabase{db: db}
+}
+
+func (uow *UnitOfWorkDatabase) Run(fn func(tx ExchangeTx) error) error {
+	tx, err := uow.db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	ledger := []BalanceEntry{}
+	err = fn(ExchangeTx{
+		Accounts: &AccountDAODatabase{db: tx},
+		Holdings: &AccountHoldingsDAODatabase{db: tx},
+		Orders:   &OrderDAODatabase{db: tx},
+		Trades:   &TradeDAODatabase{db: tx},
+		Balances: &BalanceDAODatabase{db: tx, ledger: &ledger},
+		lockMarket: func(marketID string) error {
+			_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", "market:"+marketID)
+			return err
+		},
+		lockAccount: func(accountID string, exclusive bool) error {
+			mode := "SHARE"
+			if exclusive {
+				mode = "UPDATE"
+			}
+			_, err := tx.Exec("SELECT 1 FROM ccca.account WHERE account_id = $1 FOR "+mode, accountID)
+			return err
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeLedger(tx, ledger, uow.HouseAccountID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnitOfWorkMemory implements IUnitOfWork over the in-memory DAOs. It undoes a failed
+// unit by restoring what they held before it started, units run one at a time.
+type UnitOfWorkMemory struct {
+	mu       sync.Mutex
+	accounts *AccountDAOMemory
+	holdings *AccountHoldingsDAOMemory
+	orders   *OrderDAOMemory
+	trades   *TradeDAOMemory
+	balances *BalanceDAOMemory
+}
+
+func NewUnitOfWorkMemory(accounts *AccountDAOMemory, holdings *AccountHoldingsDAOMemory, orders *OrderDAOMemory, trades *TradeDAOMemory, balances *BalanceDAOMemory) *UnitOfWorkMemory {
+	return &UnitOfWorkMemory{accounts: accounts, holdings: holdings, orders: orders, trades: trades, balances: balances}
+}
+
+func (uow *UnitOfWorkMemory) Run(fn func(tx ExchangeTx) error) error {
+	uow.mu.Lock()
+	defer uow.mu.Unlock()
+	restoreAccounts := uow.accounts.snapshot()
+	restoreOrders := uow.orders.snapshot()
+	restoreTrades := uow.trades.snapshot()
+	restoreBalances := uow.balances.snapshot()
+	if err := fn(ExchangeTx{Accounts: uow.accounts, Holdings: uow.holdings, Orders: uow.orders, Trades: uow.trades, Balances: uow.balances}); err != nil {
+		restoreAccounts()
+		restoreOrders()
+		restoreTrades()
+		restoreBalances()
+		return err
+	}
+	return nil
+}
+
+// snapshot returns a function that puts the accounts back as they are now
+func (dao *AccountDAOMemory) snapshot() func() {
+	accounts := make(map[string]*Account, len(dao.accounts))
+	for accountID, account := range dao.accounts {
+		saved := *account
+		accounts[accountID] = &saved
+	}
+	emailIndex, documentIndex := maps.Clone(dao.emailIndex), maps.Clone(dao.documentIndex)
+	return func() {
+		dao.accounts, dao.emailIndex, dao.documentIndex = accounts, emailIndex, documentIndex
+	}
+}
+
+// snapshot returns a function that puts the orders back as they are now
+func (dao *OrderDAOMemory) snapshot() func() {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	orders, sequence := maps.Clone(dao.orders), slices.Clone(dao.sequence)
+	return func() {
+		dao.mu.Lock()
+		defer dao.mu.Unlock()
+		dao.orders, dao.sequence = orders, sequence
+	}
+}
+
+// snapshot returns a function that puts the trades back as they are now
+func (dao *TradeDAOMemory) snapshot() func() {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	trades := slices.Clone(dao.trades)
+	return func() {
+		dao.mu.Lock()
+		defer dao.mu.Unlock()
+		dao.trades = trades
+	}
+}
+
+// snapshot returns a function that puts the balances and the ledger back as they are now
+func (dao *BalanceDAOMemory) snapshot() func() {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+	balances := make(map[string]map[types.AssetId]Balance, len(dao.balances))
+	for accountID, assets := range dao.balances {
+		balances[accountID] = maps.Clone(assets)
+	}
+	entries := slices.Clone(dao.entries)
+	return func() {
+		dao.mu.Lock()
+		defer dao.mu.Unlock()
+		dao.balances, dao.entries = balances, entries
+	}
+}
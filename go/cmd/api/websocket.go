@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebSocket opcodes and close codes of RFC 6455 used by the stream
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsCloseNormal          = 1000
+	wsCloseProtocolError   = 1002
+	wsClosePolicyViolation = 1008
+	wsCloseTooBig          = 1009
+)
+
+// wsAcceptGUID is appended to the client key to prove the server speaks WebSocket
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessageSize bounds what a client can send, subscriptions are small
+const wsMaxMessageSize = 64 * 1024
+
+var errWebSocketClosed = errors.New("websocket closed")
+
+// wsConn is the server side of a WebSocket connection. Reads must come from a
+// single goroutine, writes are safe from any.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+}
+
+// isWebSocketUpgrade tells whether the request asks to switch to WebSocket
+func isWebSocketUpgrade(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") &&
+		strings.Contains(strings.ToLower(c.Get(fiber.HeaderConnection)), "upgrade")
+}
+
+// upgradeWebSocket completes the opening handshake and hands the connection to serve,
+// which owns it until it returns
+func upgradeWebSocket(c *fiber.Ctx, serve func(conn *wsConn)) error {
+	key := c.Get("Sec-WebSocket-Key")
+	if !isWebSocketUpgrade(c) || c.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		return fiber.NewError(fiber.StatusUpgradeRequired, "Expected a WebSocket upgrade")
+	}
+	digest := sha1.Sum([]byte(key + wsAcceptGUID))
+	accept := base64.StdEncoding.EncodeToString(digest[:])
+	c.Context().HijackSetNoResponse(true)
+	c.Context().Hijack(func(conn net.Conn) {
+		handshake := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n"
+		if _, err := io.WriteString(conn, handshake); err != nil {
+			conn.Close()
+			return
+		}
+		serve(&wsConn{conn: conn, reader: bufio.NewReader(conn)})
+	})
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the way.
+// It fails with errWebSocketClosed once the client closed the connection.
+func (ws *wsConn) ReadMessage(deadline time.Time) ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		if err := ws.conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			ws.Close(wsCloseNormal, "")
+			return nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if started {
+				ws.Close(wsCloseProtocolError, "expected a continuation frame")
+				return nil, errWebSocketClosed
+			}
+			started = true
+		case wsOpContinuation:
+			if !started {
+				ws.Close(wsCloseProtocolError, "unexpected continuation frame")
+				return nil, errWebSocketClosed
+			}
+		default:
+			ws.Close(wsCloseProtocolError, "unknown opcode")
+			return nil, errWebSocketClosed
+		}
+		if len(message)+len(payload) > wsMaxMessageSize {
+			ws.Close(wsCloseTooBig, "message too big")
+			return nil, errWebSocketClosed
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (ws *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0F
+	// Clients must mask every frame
+	if header[1]&0x80 == 0 {
+		ws.Close(wsCloseProtocolError, "frames must be masked")
+		return false, 0, nil, errWebSocketClosed
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > wsMaxMessageSize {
+		ws.Close(wsCloseTooBig, "message too big")
+		return false, 0, nil, errWebSocketClosed
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends message as a single text frame
+func (ws *wsConn) WriteText(message []byte, deadline time.Time) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if err := ws.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return ws.writeFrameLocked(wsOpText, message)
+}
+
+// Ping asks the client for a pong, which ReadMessage takes as a sign of life
+func (ws *wsConn) Ping(deadline time.Time) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if err := ws.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return ws.writeFrameLocked(wsOpPing, nil)
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	return ws.writeFrameLocked(opcode, payload)
+}
+
+func (ws *wsConn) writeFrameLocked(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+// Close sends a close frame with code and reason and closes the connection
+func (ws *wsConn) Close(code uint16, reason string) {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if err := ws.conn.SetWriteDeadline(time.Now().Add(time.Second)); err == nil {
+		ws.writeFrameLocked(wsOpClose, append(binary.BigEndian.AppendUint16(nil, code), reason...))
+	}
+	ws.conn.Close()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsDial opens a WebSocket to the /ws route of app as a client would
+func wsDial(t *testing.T, app *fiber.App) (net.Conn, *bufio.Reader) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// The key and accept value are the example of RFC 6455
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return conn, reader
+}
+
+// wsSend writes a masked client frame
+func wsSend(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wsReceive reads an unmasked server frame
+func wsReceive(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func TestWebSocketStream(t *testing.T) {
+	f := newExchangeFixture(t)
+	stream := f.stream()
+	f.asks(t)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", func(c *fiber.Ctx) error {
+		return handleStream(c, stream)
+	})
+	conn, reader := wsDial(t, app)
+
+	wsSend(t, conn, wsOpPing, []byte("hello"))
+	opcode, payload := wsReceive(t, reader)
+	assert.Equal(t, byte(wsOpPong), opcode)
+	assert.Equal(t, "hello", string(payload))
+
+	wsSend(t, conn, wsOpText, []byte(`{"op":"subscribe","channel":"depth:BTC-USD"}`))
+	opcode, payload = wsReceive(t, reader)
+	assert.Equal(t, byte(wsOpText), opcode)
+	var snapshot streamMessage
+	assert.NoError(t, json.Unmarshal(payload, &snapshot))
+	assert.Equal(t, StreamMessageSnapshot, snapshot.Type)
+	assert.Equal(t, "depth:BTC-USD", snapshot.Channel)
+
+	f.limit(t, f.account(t, "0", "1000"), OrderSideBuy, "1", "50")
+	_, payload = wsReceive(t, reader)
+	var update streamMessage
+	assert.NoError(t, json.Unmarshal(payload, &update))
+	assert.Equal(t, StreamMessageUpdate, update.Type)
+	assert.Equal(t, snapshot.Sequence+1, update.Sequence)
+
+	wsSend(t, conn, wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+	opcode, _ = wsReceive(t, reader)
+	assert.Equal(t, byte(wsOpClose), opcode)
+}
+
+func TestWebSocketUpgradeRequired(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/ws", func(c *fiber.Ctx) error {
+		return handleStream(c, NewStreamHub(NewOrderDAOMemory(), NewTradeDAOMemory(), NewBalanceDAOMemory(), nil))
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/ws", nil))
+
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusUpgradeRequired, resp.StatusCode)
+}
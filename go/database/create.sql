@@ -5,14 +5,104 @@ create table ccca.account (
 	name text,
 	email text,
 	document text,
+	document_type text,
 	password text,
+	status text,
 	primary key (account_id)
 );
 
+create unique index account_document_key on ccca.account (document);
+create unique index account_email_key on ccca.account (lower(email));
+
+create table ccca.account_token (
+	token_id uuid,
+	account_id uuid,
+	purpose text,
+	created_at timestamptz,
+	expires_at timestamptz,
+	used_at timestamptz,
+	primary key (token_id)
+);
+
+create index account_token_account_idx on ccca.account_token (account_id, purpose, created_at);
+
+create table ccca.session (
+	session_id uuid,
+	account_id uuid,
+	token_hash text,
+	created_at timestamptz,
+	expires_at timestamptz,
+	revoked_at timestamptz,
+	primary key (session_id)
+);
+
+create unique index session_token_hash_key on ccca.session (token_hash);
+create index session_account_idx on ccca.session (account_id);
+
+create table ccca.account_totp (
+	account_id uuid,
+	secret text,
+	confirmed_at timestamptz,
+	last_used_step bigint default 0,
+	primary key (account_id)
+);
+
+create table ccca.account_recovery_code (
+	account_id uuid,
+	code_hash text,
+	used_at timestamptz,
+	primary key (account_id, code_hash)
+);
+
+create table ccca.login_attempt (
+	key text,
+	failures integer,
+	last_failure_at timestamptz,
+	locked_until timestamptz,
+	primary key (key)
+);
+
+create table ccca.audit_event (
+	event_id uuid,
+	type text,
+	account_id uuid,
+	ip text,
+	detail text,
+	occurred_at timestamptz,
+	primary key (event_id)
+);
+
+create index audit_event_account_idx on ccca.audit_event (account_id, occurred_at);
+
+create table ccca.api_key (
+	key_id text,
+	account_id uuid,
+	name text,
+	scopes text,
+	allowed_ips text,
+	encrypted_secret text,
+	created_at timestamptz,
+	expires_at timestamptz,
+	revoked_at timestamptz,
+	last_used_at timestamptz,
+	primary key (key_id)
+);
+
+create index api_key_account_idx on ccca.api_key (account_id, created_at);
+
+create table ccca.api_key_nonce (
+	key_id text,
+	nonce text,
+	seen_at timestamptz,
+	primary key (key_id, nonce)
+);
+
 create table ccca.account_asset (
 	account_id uuid,
 	asset_id text,
-	quantity numeric,
+	-- available can be withdrawn or put on hold, on_hold is locked by open orders
+	available numeric not null default 0,
+	on_hold numeric not null default 0,
 	primary key (account_id, asset_id)
 );
 
@@ -21,15 +111,26 @@ create table ccca.order (
 	market_id text,
 	account_id uuid,
 	side text,
+	type text,
 	quantity numeric,
 	price numeric,
+	quote_quantity numeric,
 	fill_quantity numeric,
 	fill_price numeric,
 	status text,
 	timestamp timestamptz,
+	time_in_force text,
+	post_only boolean,
+	expires_at timestamptz,
+	stop_price numeric,
+	triggered_at timestamptz,
 	primary key (order_id)
 );
 
+create index order_market_status_idx on ccca.order (market_id, status, timestamp);
+create index order_expires_at_idx on ccca.order (expires_at) where status in ('open', 'pending') and expires_at is not null;
+create index order_account_idx on ccca.order (account_id, timestamp);
+
 create table ccca.trade (
 	trade_id uuid,
 	market_id text,
@@ -39,5 +140,46 @@ create table ccca.trade (
 	quantity numeric,
 	price numeric,
 	timestamp timestamptz,
+	-- sequence orders trades executed at the same instant, stop orders trigger in this order
+	sequence bigserial,
+	buy_account_id uuid,
+	sell_account_id uuid,
+	-- fees are charged in the asset each side receives
+	maker_fee numeric,
+	maker_fee_asset text,
+	taker_fee numeric,
+	taker_fee_asset text,
 	primary key (trade_id)
-);
\ No newline at end of file
+);
+
+create index trade_market_sequence_idx on ccca.trade (market_id, sequence);
+create index trade_market_timestamp_idx on ccca.trade (market_id, timestamp);
+create index trade_buy_account_idx on ccca.trade (buy_account_id, timestamp);
+create index trade_sell_account_idx on ccca.trade (sell_account_id, timestamp);
+
+-- candles are OHLCV bars built from ccca.trade, open_time is the start of the interval in UTC
+create table ccca.candle (
+	market_id text,
+	interval text,
+	open_time timestamptz,
+	open numeric,
+	high numeric,
+	low numeric,
+	close numeric,
+	volume numeric,
+	trade_count integer,
+	primary key (market_id, interval, open_time)
+);
+
+-- the ledger: every balance of ccca.account_asset right after each change, in the order they happened
+create table ccca.balance_entry (
+	entry_id bigserial,
+	account_id uuid,
+	asset_id text,
+	available numeric,
+	on_hold numeric,
+	timestamp timestamptz not null default now(),
+	primary key (entry_id)
+);
+
+create index balance_entry_account_idx on ccca.balance_entry (account_id, entry_id);
\ No newline at end of file
@@ -0,0 +1,206 @@
+package domainerrors
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kind classifies a domain error so the transport layer can choose a status code
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindMalformed
+	KindValidation
+	KindBusinessRule
+	KindNotFound
+	KindUnauthorized
+	KindForbidden
+	KindRateLimited
+)
+
+// Error is a domain error with a stable, machine-readable code
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+var registry []*Error
+
+// New declares a domain error and registers its code so catalogs can be checked for completeness
+func New(kind Kind, code, message string) *Error {
+	err := &Error{Kind: kind, Code: code, Message: message}
+	registry = append(registry, err)
+	return err
+}
+
+// All returns every declared domain error
+func All() []*Error {
+	return append([]*Error(nil), registry...)
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors by code so copies of a sentinel still satisfy errors.Is
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrInternal           = New(KindInternal, "internal_error", "Internal server error")
+	ErrInvalidRequestBody = New(KindMalformed, "invalid_request_body", "Invalid request body")
+	ErrValidationFailed   = New(KindValidation, "validation_failed", "Request validation failed")
+
+	ErrInvalidName        = New(KindValidation, "invalid_name", "Invalid name")
+	ErrNameTooShort       = New(KindValidation, "name_too_short", "Name is too short")
+	ErrNameTooLong        = New(KindValidation, "name_too_long", "Name is too long")
+	ErrInvalidEmail       = New(KindValidation, "invalid_email", "Invalid email")
+	ErrDisposableEmail    = New(KindValidation, "disposable_email", "Disposable email addresses are not allowed")
+	ErrEmailUndeliverable = New(KindValidation, "email_undeliverable", "Email domain cannot receive mail")
+	ErrInvalidPassword    = New(KindValidation, "invalid_password", "Invalid password")
+
+	ErrPasswordTooShort             = New(KindValidation, "password_too_short", "Password is too short")
+	ErrPasswordTooLong              = New(KindValidation, "password_too_long", "Password is too long")
+	ErrPasswordMissingLowercase     = New(KindValidation, "password_missing_lowercase", "Password must contain a lowercase letter")
+	ErrPasswordMissingUppercase     = New(KindValidation, "password_missing_uppercase", "Password must contain an uppercase letter")
+	ErrPasswordMissingDigit         = New(KindValidation, "password_missing_digit", "Password must contain a digit")
+	ErrPasswordMissingSymbol        = New(KindValidation, "password_missing_symbol", "Password must contain a symbol")
+	ErrPasswordTooWeak              = New(KindValidation, "password_too_weak", "Password is too easy to guess")
+	ErrPasswordContainsPersonalInfo = New(KindValidation, "password_contains_personal_info", "Password must not contain your name or email")
+	ErrPasswordBreached             = New(KindValidation, "password_breached", "Password has appeared in a data breach")
+
+	ErrInvalidDocument = New(KindValidation, "invalid_document", "Invalid document")
+
+	ErrAccountIDRequired = New(KindValidation, "account_id_required", "accountId is required")
+	ErrInvalidAccountID  = New(KindValidation, "invalid_account_id", "Invalid account ID format")
+	ErrInvalidAsset      = New(KindValidation, "invalid_asset", "assetId is required and must be valid")
+	ErrInvalidQuantity   = New(KindValidation, "invalid_quantity", "quantity is required and must be a valid positive number")
+
+	ErrDuplicateEmail        = New(KindBusinessRule, "duplicate_email", "Email already exists")
+	ErrDuplicateDocument     = New(KindBusinessRule, "duplicate_document", "An account with this document already exists")
+	ErrInsufficientFunds     = New(KindBusinessRule, "insufficient_funds", "Insufficient asset quantity")
+	ErrAccountHasBalance     = New(KindBusinessRule, "account_has_balance", "Withdraw every asset before closing the account")
+	ErrInsufficientLiquidity = New(KindBusinessRule, "insufficient_liquidity", "Not enough liquidity on the book to fill the order")
+	ErrSlippageExceeded      = New(KindBusinessRule, "slippage_exceeded", "Filling the order would go past its worst price")
+	ErrOrderTooSmall         = New(KindBusinessRule, "order_too_small", "quoteQuantity does not pay for a single lot at the best price")
+	ErrOrderNotOpen          = New(KindBusinessRule, "order_not_open", "Order is no longer open")
+	ErrAccountHasOpenOrders  = New(KindBusinessRule, "account_has_open_orders", "Cancel every open order before closing the account")
+	ErrOrderNotFillable      = New(KindBusinessRule, "order_not_fillable", "Fill-or-kill order cannot be filled entirely")
+	ErrPostOnlyWouldTake     = New(KindBusinessRule, "post_only_would_take", "Post-only order would take liquidity from the book")
+
+	ErrAccountNotFound = New(KindNotFound, "account_not_found", "Account not found")
+	ErrOrderNotFound   = New(KindNotFound, "order_not_found", "Order not found")
+	ErrMarketNotFound  = New(KindNotFound, "market_not_found", "Market not found")
+	ErrAPIKeyNotFound  = New(KindNotFound, "api_key_not_found", "API key not found")
+
+	ErrInvalidToken     = New(KindValidation, "invalid_token", "Invalid token")
+	ErrTokenExpired     = New(KindValidation, "token_expired", "Token has expired")
+	ErrTokenAlreadyUsed = New(KindValidation, "token_already_used", "Token has already been used")
+
+	ErrInvalidAPIKeyName  = New(KindValidation, "invalid_api_key_name", "name is required and must be at most 64 characters")
+	ErrInvalidAPIKeyScope = New(KindValidation, "invalid_api_key_scope", "scopes must list at least one of read, trade and withdraw")
+	ErrInvalidIPAddress   = New(KindValidation, "invalid_ip_address", "Invalid IP address or CIDR range")
+	ErrInvalidExpiry      = New(KindValidation, "invalid_expiry", "Expiry must be in the future")
+
+	ErrInvalidMarket        = New(KindValidation, "invalid_market", "marketId is not a listed market")
+	ErrInvalidOrderSide     = New(KindValidation, "invalid_order_side", "side must be buy or sell")
+	ErrInvalidOrderType     = New(KindValidation, "invalid_order_type", "type must be limit, market, stop or stop_limit")
+	ErrInvalidPrice         = New(KindValidation, "invalid_price", "price must be a positive multiple of the market tick size")
+	ErrInvalidLotSize       = New(KindValidation, "invalid_lot_size", "quantity must be a positive multiple of the market lot size")
+	ErrInvalidQuoteQuantity = New(KindValidation, "invalid_quote_quantity", "Market orders need either quantity or a positive quoteQuantity, limit orders only quantity")
+	ErrInvalidSlippage      = New(KindValidation, "invalid_slippage", "maxSlippage must be at least 0 and below 1")
+	ErrInvalidTimeInForce   = New(KindValidation, "invalid_time_in_force", "timeInForce must be GTC, IOC, FOK or GTD, market orders are always FOK")
+	ErrInvalidPostOnly      = New(KindValidation, "invalid_post_only", "postOnly is only allowed on GTC and GTD limit orders")
+	ErrInvalidCursor        = New(KindValidation, "invalid_cursor", "cursor is not valid")
+	ErrInvalidLimit         = New(KindValidation, "invalid_limit", "limit must be a number between 1 and 500")
+	ErrInvalidStopPrice     = New(KindValidation, "invalid_stop_price", "stopPrice must be a positive multiple of the market tick size on stop orders and absent otherwise")
+	ErrInvalidInterval      = New(KindValidation, "invalid_interval", "interval must be one of 1m, 5m, 1h or 1d")
+	ErrInvalidTimeRange     = New(KindValidation, "invalid_time_range", "from and to must be RFC 3339 times, from before to, spanning at most 1000 candles")
+	ErrInvalidChannel       = New(KindValidation, "invalid_channel", "channel must be depth:<marketId>, trades:<marketId>, ticker or account:<accountId>")
+	ErrInvalidStreamMessage = New(KindValidation, "invalid_stream_message", "Messages must be JSON objects with op subscribe or unsubscribe and a channel")
+	ErrInvalidLastEventID   = New(KindValidation, "invalid_last_event_id", "Last-Event-ID must be the id of an event of the stream")
+
+	ErrIncorrectPassword = New(KindValidation, "incorrect_password", "Current password is incorrect")
+
+	ErrInvalidCredentials     = New(KindUnauthorized, "invalid_credentials", "Invalid email or password")
+	ErrAuthenticationRequired = New(KindUnauthorized, "authentication_required", "Authentication required")
+	ErrInvalidAPIKey          = New(KindUnauthorized, "invalid_api_key", "Invalid, expired or revoked API key")
+	ErrInvalidSignature       = New(KindUnauthorized, "invalid_signature", "Invalid request signature")
+	ErrRequestExpired         = New(KindUnauthorized, "request_expired", "Request timestamp is missing or too far from the server time")
+	ErrReplayedRequest        = New(KindUnauthorized, "replayed_request", "Request nonce has already been used")
+	ErrTwoFactorRequired      = New(KindUnauthorized, "two_factor_required", "A two-factor authentication code is required")
+	ErrInvalidTwoFactorCode   = New(KindUnauthorized, "invalid_two_factor_code", "Invalid two-factor authentication code")
+
+	ErrTwoFactorNotEnrolled    = New(KindBusinessRule, "two_factor_not_enrolled", "Two-factor enrollment has not been started")
+	ErrTwoFactorAlreadyEnabled = New(KindBusinessRule, "two_factor_already_enabled", "Two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = New(KindBusinessRule, "two_factor_not_enabled", "Two-factor authentication is not enabled")
+
+	ErrEmailNotVerified    = New(KindForbidden, "email_not_verified", "Email address has not been verified")
+	ErrAccountClosed       = New(KindForbidden, "account_closed", "Account is closed")
+	ErrIPNotAllowed        = New(KindForbidden, "ip_not_allowed", "Requests from this IP address are not allowed for this API key")
+	ErrInsufficientScope   = New(KindForbidden, "insufficient_scope", "API key does not have the required scope")
+	ErrAccountAccessDenied = New(KindForbidden, "account_access_denied", "Credentials do not belong to this account")
+	ErrTooManyRequests     = New(KindRateLimited, "too_many_requests", "Too many requests, try again later")
+	ErrLoginLocked         = New(KindRateLimited, "login_locked", "Too many failed login attempts, try again later")
+	ErrTwoFactorLocked     = New(KindRateLimited, "two_factor_locked", "Too many invalid two-factor codes, try again later")
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field error found while validating a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records err against field; errors that are not domain errors are reported as internal
+func (e *ValidationError) Add(field string, err error) {
+	domainErr := ErrInternal
+	errors.As(err, &domainErr)
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: domainErr.Code, Message: domainErr.Message})
+}
+
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+// ErrorOrNil returns nil when no field failed so callers can return it directly
+func (e *ValidationError) ErrorOrNil() error {
+	if !e.HasErrors() {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is matches ErrValidationFailed and any of the collected field error codes
+func (e *ValidationError) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code == ErrValidationFailed.Code {
+		return true
+	}
+	for _, field := range e.Fields {
+		if field.Code == t.Code {
+			return true
+		}
+	}
+	return false
+}
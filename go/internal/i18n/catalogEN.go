@@ -0,0 +1,87 @@
+package i18n
+
+var catalogEN = Catalog{
+	"internal_error":                  "Internal server error",
+	"invalid_request_body":            "Invalid request body",
+	"validation_failed":               "Request validation failed",
+	"invalid_name":                    "Invalid name",
+	"name_too_short":                  "Name is too short",
+	"name_too_long":                   "Name is too long",
+	"invalid_email":                   "Invalid email",
+	"disposable_email":                "Disposable email addresses are not allowed",
+	"email_undeliverable":             "Email domain cannot receive mail",
+	"invalid_password":                "Invalid password",
+	"password_too_short":              "Password is too short",
+	"password_too_long":               "Password is too long",
+	"password_missing_lowercase":      "Password must contain a lowercase letter",
+	"password_missing_uppercase":      "Password must contain an uppercase letter",
+	"password_missing_digit":          "Password must contain a digit",
+	"password_missing_symbol":         "Password must contain a symbol",
+	"password_too_weak":               "Password is too easy to guess",
+	"password_contains_personal_info": "Password must not contain your name or email",
+	"password_breached":               "Password has appeared in a data breach",
+	"invalid_document":                "Invalid document",
+	"account_id_required":             "accountId is required",
+	"invalid_account_id":              "Invalid account ID format",
+	"invalid_asset":                   "assetId is required and must be valid",
+	"invalid_quantity":                "quantity is required and must be a valid positive number",
+	"duplicate_email":                 "Email already exists",
+	"duplicate_document":              "An account with this document already exists",
+	"insufficient_funds":              "Insufficient asset quantity",
+	"account_not_found":               "Account not found",
+	"invalid_token":                   "Invalid token",
+	"token_expired":                   "Token has expired",
+	"token_already_used":              "Token has already been used",
+	"incorrect_password":              "Current password is incorrect",
+	"invalid_credentials":             "Invalid email or password",
+	"authentication_required":         "Authentication required",
+	"two_factor_required":             "A two-factor authentication code is required",
+	"invalid_two_factor_code":         "Invalid two-factor authentication code",
+	"two_factor_not_enrolled":         "Two-factor enrollment has not been started",
+	"two_factor_already_enabled":      "Two-factor authentication is already enabled",
+	"two_factor_not_enabled":          "Two-factor authentication is not enabled",
+	"two_factor_locked":               "Too many invalid two-factor codes, try again later",
+	"email_not_verified":              "Email address has not been verified",
+	"too_many_requests":               "Too many requests, try again later",
+	"login_locked":                    "Too many failed login attempts, try again later",
+	"invalid_api_key_name":            "name is required and must be at most 64 characters",
+	"invalid_api_key_scope":           "scopes must list at least one of read, trade and withdraw",
+	"invalid_ip_address":              "Invalid IP address or CIDR range",
+	"invalid_expiry":                  "Expiry must be in the future",
+	"invalid_api_key":                 "Invalid, expired or revoked API key",
+	"invalid_signature":               "Invalid request signature",
+	"request_expired":                 "Request timestamp is missing or too far from the server time",
+	"replayed_request":                "Request nonce has already been used",
+	"api_key_not_found":               "API key not found",
+	"ip_not_allowed":                  "Requests from this IP address are not allowed for this API key",
+	"insufficient_scope":              "API key does not have the required scope",
+	"account_access_denied":           "Credentials do not belong to this account",
+	"account_has_balance":             "Withdraw every asset before closing the account",
+	"account_has_open_orders":         "Cancel every open order before closing the account",
+	"account_closed":                  "Account is closed",
+	"invalid_market":                  "marketId is not a listed market",
+	"invalid_order_side":              "side must be buy or sell",
+	"invalid_order_type":              "type must be limit, market, stop or stop_limit",
+	"invalid_price":                   "price must be a positive multiple of the market tick size",
+	"invalid_lot_size":                "quantity must be a positive multiple of the market lot size",
+	"invalid_quote_quantity":          "Market orders need either quantity or a positive quoteQuantity, limit orders only quantity",
+	"invalid_slippage":                "maxSlippage must be at least 0 and below 1",
+	"order_not_found":                 "Order not found",
+	"insufficient_liquidity":          "Not enough liquidity on the book to fill the order",
+	"slippage_exceeded":               "Filling the order would go past its worst price",
+	"order_too_small":                 "quoteQuantity does not pay for a single lot at the best price",
+	"order_not_open":                  "Order is no longer open",
+	"invalid_time_in_force":           "timeInForce must be GTC, IOC, FOK or GTD, market orders are always FOK",
+	"invalid_post_only":               "postOnly is only allowed on GTC and GTD limit orders",
+	"order_not_fillable":              "Fill-or-kill order cannot be filled entirely",
+	"post_only_would_take":            "Post-only order would take liquidity from the book",
+	"invalid_stop_price":              "stopPrice must be a positive multiple of the market tick size on stop orders and absent otherwise",
+	"invalid_cursor":                  "cursor is not valid",
+	"invalid_limit":                   "limit must be a number between 1 and 500",
+	"market_not_found":                "Market not found",
+	"invalid_interval":                "interval must be one of 1m, 5m, 1h or 1d",
+	"invalid_time_range":              "from and to must be RFC 3339 times, from before to, spanning at most 1000 candles",
+	"invalid_channel":                 "channel must be depth:<marketId>, trades:<marketId>, ticker or account:<accountId>",
+	"invalid_stream_message":          "Messages must be JSON objects with op subscribe or unsubscribe and a channel",
+	"invalid_last_event_id":           "Last-Event-ID must be the id of an event of the stream",
+}
@@ -0,0 +1,87 @@
+package i18n
+
+var catalogPTBR = Catalog{
+	"internal_error":                  "Erro interno do servidor",
+	"invalid_request_body":            "Corpo da requisição inválido",
+	"validation_failed":               "A validação da requisição falhou",
+	"invalid_name":                    "Nome inválido",
+	"name_too_short":                  "Nome muito curto",
+	"name_too_long":                   "Nome muito longo",
+	"invalid_email":                   "E-mail inválido",
+	"disposable_email":                "E-mails descartáveis não são permitidos",
+	"email_undeliverable":             "O domínio do e-mail não pode receber mensagens",
+	"invalid_password":                "Senha inválida",
+	"password_too_short":              "Senha muito curta",
+	"password_too_long":               "Senha muito longa",
+	"password_missing_lowercase":      "A senha deve conter uma letra minúscula",
+	"password_missing_uppercase":      "A senha deve conter uma letra maiúscula",
+	"password_missing_digit":          "A senha deve conter um dígito",
+	"password_missing_symbol":         "A senha deve conter um símbolo",
+	"password_too_weak":               "A senha é fácil demais de adivinhar",
+	"password_contains_personal_info": "A senha não pode conter seu nome ou e-mail",
+	"password_breached":               "A senha apareceu em um vazamento de dados",
+	"invalid_document":                "Documento inválido",
+	"account_id_required":             "accountId é obrigatório",
+	"invalid_account_id":              "Formato de ID de conta inválido",
+	"invalid_asset":                   "assetId é obrigatório e deve ser válido",
+	"invalid_quantity":                "quantity é obrigatório e deve ser um número positivo válido",
+	"duplicate_email":                 "E-mail já cadastrado",
+	"duplicate_document":              "Já existe uma conta com este documento",
+	"insufficient_funds":              "Quantidade do ativo insuficiente",
+	"account_not_found":               "Conta não encontrada",
+	"invalid_token":                   "Token inválido",
+	"token_expired":                   "O token expirou",
+	"token_already_used":              "O token já foi utilizado",
+	"incorrect_password":              "A senha atual está incorreta",
+	"invalid_credentials":             "E-mail ou senha inválidos",
+	"authentication_required":         "Autenticação necessária",
+	"two_factor_required":             "É necessário um código de autenticação em dois fatores",
+	"invalid_two_factor_code":         "Código de autenticação em dois fatores inválido",
+	"two_factor_not_enrolled":         "O cadastro da autenticação em dois fatores não foi iniciado",
+	"two_factor_already_enabled":      "A autenticação em dois fatores já está ativada",
+	"two_factor_not_enabled":          "A autenticação em dois fatores não está ativada",
+	"two_factor_locked":               "Muitos códigos de autenticação em dois fatores inválidos, tente novamente mais tarde",
+	"email_not_verified":              "O endereço de e-mail não foi verificado",
+	"too_many_requests":               "Muitas requisições, tente novamente mais tarde",
+	"login_locked":                    "Muitas tentativas de login malsucedidas, tente novamente mais tarde",
+	"invalid_api_key_name":            "name é obrigatório e deve ter no máximo 64 caracteres",
+	"invalid_api_key_scope":           "scopes deve conter ao menos um entre read, trade e withdraw",
+	"invalid_ip_address":              "Endereço IP ou faixa CIDR inválida",
+	"invalid_expiry":                  "A expiração deve estar no futuro",
+	"invalid_api_key":                 "Chave de API inválida, expirada ou revogada",
+	"invalid_signature":               "Assinatura da requisição inválida",
+	"request_expired":                 "O horário da requisição está ausente ou muito distante do horário do servidor",
+	"replayed_request":                "O nonce da requisição já foi utilizado",
+	"api_key_not_found":               "Chave de API não encontrada",
+	"ip_not_allowed":                  "Requisições deste endereço IP não são permitidas para esta chave de API",
+	"insufficient_scope":              "A chave de API não possui o escopo necessário",
+	"account_access_denied":           "As credenciais não pertencem a esta conta",
+	"account_has_balance":             "Saque todos os ativos antes de encerrar a conta",
+	"account_has_open_orders":         "Cancele todas as ordens abertas antes de encerrar a conta",
+	"account_closed":                  "A conta está encerrada",
+	"invalid_market":                  "marketId não é um mercado listado",
+	"invalid_order_side":              "side deve ser buy ou sell",
+	"invalid_order_type":              "type deve ser limit, market, stop ou stop_limit",
+	"invalid_price":                   "price deve ser um múltiplo positivo do tick do mercado",
+	"invalid_lot_size":                "quantity deve ser um múltiplo positivo do lote do mercado",
+	"invalid_quote_quantity":          "Ordens a mercado precisam de quantity ou de um quoteQuantity positivo, ordens limitadas apenas de quantity",
+	"invalid_slippage":                "maxSlippage deve ser no mínimo 0 e menor que 1",
+	"order_not_found":                 "Ordem não encontrada",
+	"insufficient_liquidity":          "Não há liquidez suficiente no livro para executar a ordem",
+	"slippage_exceeded":               "Executar a ordem ultrapassaria o seu pior preço",
+	"order_too_small":                 "quoteQuantity não paga um único lote ao melhor preço",
+	"order_not_open":                  "A ordem não está mais aberta",
+	"invalid_time_in_force":           "timeInForce deve ser GTC, IOC, FOK ou GTD, ordens a mercado são sempre FOK",
+	"invalid_post_only":               "postOnly só é permitido em ordens limitadas GTC e GTD",
+	"order_not_fillable":              "A ordem fill-or-kill não pode ser executada por completo",
+	"post_only_would_take":            "A ordem post-only retiraria liquidez do livro",
+	"invalid_stop_price":              "stopPrice deve ser um múltiplo positivo do tick do mercado em ordens stop e ausente nas demais",
+	"invalid_cursor":                  "cursor não é válido",
+	"invalid_limit":                   "limit deve ser um número entre 1 e 500",
+	"market_not_found":                "Mercado não encontrado",
+	"invalid_interval":                "interval deve ser 1m, 5m, 1h ou 1d",
+	"invalid_time_range":              "from e to devem ser datas RFC 3339, from antes de to, abrangendo no máximo 1000 candles",
+	"invalid_channel":                 "channel deve ser depth:<marketId>, trades:<marketId>, ticker ou account:<accountId>",
+	"invalid_stream_message":          "Mensagens devem ser objetos JSON com op subscribe ou unsubscribe e um channel",
+	"invalid_last_event_id":           "Last-Event-ID deve ser o id de um evento do stream",
+}
@@ -0,0 +1,114 @@
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locale is a BCP 47 language tag with a message catalog
+type Locale string
+
+const (
+	LocaleEN   Locale = "en"
+	LocalePTBR Locale = "pt-BR"
+)
+
+// DefaultLocale is used when the client accepts none of the shipped locales
+const DefaultLocale = LocaleEN
+
+// Catalog maps error codes to localized messages
+type Catalog map[string]string
+
+var catalogs = map[Locale]Catalog{
+	LocaleEN:   catalogEN,
+	LocalePTBR: catalogPTBR,
+}
+
+// Locales returns the shipped locales
+func Locales() []Locale {
+	locales := make([]Locale, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Slice(locales, func(i, j int) bool { return locales[i] < locales[j] })
+	return locales
+}
+
+// CatalogFor returns the catalog of a shipped locale
+func CatalogFor(locale Locale) (Catalog, bool) {
+	catalog, ok := catalogs[locale]
+	return catalog, ok
+}
+
+// Translate returns the message for code in locale, falling back to the default
+// locale and finally to the given message
+func Translate(locale Locale, code, fallback string) string {
+	if message, ok := catalogs[locale][code]; ok {
+		return message
+	}
+	if message, ok := catalogs[DefaultLocale][code]; ok {
+		return message
+	}
+	return fallback
+}
+
+// Negotiate picks the best shipped locale for an Accept-Language header value.
+// A bare language such as "pt" or a regional variant such as "en-GB" matches the
+// shipped locale with the same primary language.
+func Negotiate(acceptLanguage string) Locale {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if value, ok := strings.CutPrefix(param, "q="); ok {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			candidates = append(candidates, candidate{tag: tag, quality: quality})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+	for _, c := range candidates {
+		if locale, ok := match(c.tag); ok {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+func match(tag string) (Locale, bool) {
+	if tag == "*" {
+		return DefaultLocale, true
+	}
+	for locale := range catalogs {
+		if strings.EqualFold(string(locale), tag) {
+			return locale, true
+		}
+	}
+	language := primaryLanguage(tag)
+	for _, locale := range Locales() {
+		if primaryLanguage(string(locale)) == language {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+func primaryLanguage(tag string) string {
+	language, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	return strings.ToLower(language)
+}
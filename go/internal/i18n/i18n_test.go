@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/domainerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryErrorCodeIsTranslated(t *testing.T) {
+	for _, locale := range Locales() {
+		catalog, _ := CatalogFor(locale)
+		for _, domainErr := range domainerrors.All() {
+			assert.NotEmpty(t, catalog[domainErr.Code], "missing %s translation for %s", locale, domainErr.Code)
+		}
+	}
+}
+
+func TestCatalogsHaveNoUnknownCodes(t *testing.T) {
+	known := map[string]bool{}
+	for _, domainErr := range domainerrors.All() {
+		known[domainErr.Code] = true
+	}
+	for _, locale := range Locales() {
+		catalog, _ := CatalogFor(locale)
+		for code := range catalog {
+			assert.True(t, known[code], "%s catalog has unknown code %s", locale, code)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected Locale
+	}{
+		{"Empty header", "", LocaleEN},
+		{"Exact pt-BR", "pt-BR", LocalePTBR},
+		{"Lowercase pt-br", "pt-br", LocalePTBR},
+		{"Bare language", "pt", LocalePTBR},
+		{"Other Portuguese region", "pt-PT", LocalePTBR},
+		{"English region", "en-GB", LocaleEN},
+		{"Quality ordering", "en;q=0.5, pt-BR;q=0.9", LocalePTBR},
+		{"Unsupported first", "fr-FR, pt;q=0.8", LocalePTBR},
+		{"Only unsupported", "fr-FR, de", LocaleEN},
+		{"Zero quality ignored", "pt-BR;q=0, en", LocaleEN},
+		{"Wildcard", "*", LocaleEN},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Negotiate(tc.input))
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "Nome inválido", Translate(LocalePTBR, "invalid_name", "Invalid name"))
+	assert.Equal(t, "Invalid name", Translate(LocaleEN, "invalid_name", ""))
+	assert.Equal(t, "Invalid name", Translate("fr", "invalid_name", ""))
+	assert.Equal(t, "Method Not Allowed", Translate(LocalePTBR, "method_not_allowed", "Method Not Allowed"))
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: filepath.Join(dir, "mail")}
+
+	err := m.Send(context.Background(), Message{To: "gustavo@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "mail", "*-gustavo@example.com.eml"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		content, err := os.ReadFile(files[0])
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "To: gustavo@example.com\r\n")
+		assert.Contains(t, string(content), "Subject: Hello\r\n")
+		assert.Contains(t, string(content), "line 1\r\nline 2")
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := &MemoryMailer{}
+	assert.NoError(t, m.Send(context.Background(), Message{To: "a@example.com", Subject: "first"}))
+	assert.NoError(t, m.Send(context.Background(), Message{To: "b@example.com", Subject: "other"}))
+	assert.NoError(t, m.Send(context.Background(), Message{To: "A@example.com", Subject: "second"}))
+
+	messages := m.Messages("a@example.com")
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "first", messages[0].Subject)
+		assert.Equal(t, "second", messages[1].Subject)
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("MAILER", "smtp")
+	t.Setenv("SMTP_ADDR", "smtp.example.com:587")
+	t.Setenv("SMTP_USERNAME", "user")
+	assert.IsType(t, &SMTPMailer{}, NewFromEnv())
+
+	t.Setenv("MAILER", "memory")
+	assert.IsType(t, &MemoryMailer{}, NewFromEnv())
+
+	t.Setenv("MAILER", "")
+	t.Setenv("MAIL_DIR", "/tmp/mail")
+	assert.Equal(t, &FileMailer{Dir: "/tmp/mail"}, NewFromEnv())
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
@@ -12,25 +14,97 @@ type SignupRequest struct {
 	Password string `json:"password"`
 }
 
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	TotpCode string `json:"totpCode"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowedIps"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+// UpdateAccountRequest changes only the fields that are present
+type UpdateAccountRequest struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+type CloseAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// PlaceOrderRequest places a limit order with quantity and price, or a market order
+// with either quantity or quoteQuantity and optional maxSlippage or worstPrice guards.
+// Limit orders take a timeInForce (GTC by default, expiresAt with GTD) and postOnly.
+// Stop and stop_limit orders wait off the book until the last trade reaches stopPrice,
+// a stop buy needs worstPrice to bound what it reserves.
+type PlaceOrderRequest struct {
+	MarketID      string          `json:"marketId"`
+	Side          string          `json:"side"`
+	Type          string          `json:"type"`
+	Quantity      decimal.Decimal `json:"quantity"`
+	Price         decimal.Decimal `json:"price"`
+	QuoteQuantity decimal.Decimal `json:"quoteQuantity"`
+	MaxSlippage   decimal.Decimal `json:"maxSlippage"`
+	WorstPrice    decimal.Decimal `json:"worstPrice"`
+	TimeInForce   string          `json:"timeInForce"`
+	PostOnly      bool            `json:"postOnly"`
+	ExpiresAt     *time.Time      `json:"expiresAt"`
+	StopPrice     decimal.Decimal `json:"stopPrice"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
 type User struct {
-	AccountID uuid.UUID `json:"accountId"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Document  string    `json:"document"`
-	Password  string    `json:"password"`
+	AccountID    uuid.UUID `json:"accountId"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Document     string    `json:"document"`
+	DocumentType string    `json:"documentType"`
+	Password     string    `json:"password"`
 }
 
 type Account struct {
-	AccountID uuid.UUID `json:"accountId"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Document  string    `json:"document"`
-	Assets    []Asset   `json:"assets"`
+	AccountID    uuid.UUID `json:"accountId"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Document     string    `json:"document"`
+	DocumentType string    `json:"documentType"`
+	Status       string    `json:"status"`
+	Assets       []Asset   `json:"assets"`
 }
 
+// Asset is a balance of an account. Quantity is the total, Available plus OnHold,
+// which is locked by open orders.
 type Asset struct {
-	AssetID  AssetId         `json:"assetId"`
-	Quantity decimal.Decimal `json:"quantity"`
+	AssetID   AssetId         `json:"assetId"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	Available decimal.Decimal `json:"available"`
+	OnHold    decimal.Decimal `json:"onHold"`
 }
 
 type DepositRequest struct {
@@ -50,6 +124,8 @@ type WithdrawRequest struct {
 	AccountID string          `json:"accountId"`
 	AssetID   AssetId         `json:"assetId"`
 	Quantity  decimal.Decimal `json:"quantity"`
+	// TotpCode is required above the step-up threshold when two-factor is enabled
+	TotpCode string `json:"totpCode"`
 }
 
 func (a AssetId) String() string {
@@ -66,3 +142,23 @@ func (a AssetId) String() string {
 func (a AssetId) IsValid() bool {
 	return a == AssetIdBTC || a == AssetIdUSD
 }
+
+// StreamRequest is a message a client sends on the WebSocket stream
+type StreamRequest struct {
+	// Op is subscribe or unsubscribe
+	Op      string `json:"op"`
+	Channel string `json:"channel"`
+}
+
+// StreamMessage is a message the WebSocket stream sends. Snapshots and updates of a
+// channel carry consecutive sequence numbers, an update that does not follow the
+// last one seen means messages were lost and the channel must be subscribed again.
+type StreamMessage struct {
+	// Type is snapshot, update, unsubscribed or error
+	Type     string `json:"type"`
+	Channel  string `json:"channel,omitempty"`
+	Sequence int64  `json:"sequence"`
+	Data     any    `json:"data,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func patchJSON(t *testing.T, url string, body interface{}, token string) (*http.Response, map[string]interface{}) {
+	inputJson, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return resp, response
+}
+
+// verifiedSession signs up, verifies the email and logs in
+func verifiedSession(t *testing.T, email string) (string, string) {
+	accountID := signup(t, email)
+	token, err := LastMailedToken(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+	return accountID, session
+}
+
+func TestUpdateAccountProfile(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	accountID, session := verifiedSession(t, email)
+	newEmail := fmt.Sprintf("maria-%d@example.com", time.Now().UnixNano())
+
+	// When
+	resp, response := patchJSON(t, "http://app:3000/accounts/"+accountID, map[string]string{"name": "Maria Silva", "email": newEmail}, session)
+
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Maria Silva", response["name"])
+	assert.Equal(t, newEmail, response["email"])
+	assert.Equal(t, "pending", accountStatus(t, accountID, session))
+	token, err := LastMailedToken(newEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, "active", accountStatus(t, accountID, session))
+}
+
+func TestUpdateAnotherAccountIsForbidden(t *testing.T) {
+	// Given
+	_, session := verifiedSession(t, fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano()))
+	otherID := signup(t, fmt.Sprintf("other-%d@example.com", time.Now().UnixNano()))
+
+	// When
+	resp, response := patchJSON(t, "http://app:3000/accounts/"+otherID, map[string]string{"name": "Maria Silva"}, session)
+
+	// Then
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "account_access_denied", response["code"])
+}
+
+func TestCloseAccount(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	accountID, session := verifiedSession(t, email)
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": accountID, "assetId": "BTC", "quantity": "1"}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// When
+	resp, response := postJSON(t, "http://app:3000/accounts/"+accountID+"/close", map[string]string{"password": "Vq7!mZt2Lp9x"}, session)
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "account_has_balance", response["code"])
+
+	// When
+	resp, _ = postJSON(t, "http://app:3000/withdraw", map[string]string{"accountId": accountID, "assetId": "BTC", "quantity": "1"}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/accounts/"+accountID+"/close", map[string]string{"password": "Vq7!mZt2Lp9x"}, session)
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	status, _ := Login(t, email, "Vq7!mZt2Lp9x")
+	assert.Equal(t, http.StatusForbidden, status)
+	// Closing revoked the session
+	resp, response = postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": accountID, "assetId": "BTC", "quantity": "1"}, session)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "authentication_required", response["code"])
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signedGet sends a GET request signed with an API key as a trading bot would
+func signedGet(t *testing.T, path, keyID, secret, nonce string) *http.Response {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + "GET\n" + path + "\n"))
+	req, err := http.NewRequest(http.MethodGet, "http://app:3000"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", keyID)
+	req.Header.Set("X-API-Timestamp", timestamp)
+	req.Header.Set("X-API-Nonce", nonce)
+	req.Header.Set("X-API-Signature", hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	accountID := signup(t, email)
+	token, err := LastMailedToken(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+
+	// When
+	resp, created := postJSON(t, "http://app:3000/api-keys", map[string]interface{}{"name": "bot", "scopes": []string{"read"}}, session)
+	// Then
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	keyID := created["keyId"].(string)
+	secret := created["secret"].(string)
+
+	path := "/accounts/" + accountID
+	assert.Equal(t, http.StatusOK, signedGet(t, path, keyID, secret, "first").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, signedGet(t, path, keyID, secret, "first").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, signedGet(t, path, keyID, "wrong", "second").StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete, "http://app:3000/api-keys/"+keyID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+session)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, signedGet(t, path, keyID, secret, "third").StatusCode)
+}
+
+func TestCreateAPIKeyRequiresSession(t *testing.T) {
+	// When
+	resp, response := postJSON(t, "http://app:3000/api-keys", map[string]interface{}{"name": "bot", "scopes": []string{"read"}}, "")
+	// Then
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "authentication_required", response["code"])
+}
@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandles(t *testing.T) {
+	// Given
+	sellerID, seller := verifiedSession(t, fmt.Sprintf("seller-%d@example.com", time.Now().UnixNano()))
+	buyerID, buyer := verifiedSession(t, fmt.Sprintf("buyer-%d@example.com", time.Now().UnixNano()))
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": sellerID, "assetId": "BTC", "quantity": "1"}, seller)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": buyerID, "assetId": "USD", "quantity": "100"}, buyer)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "buy", "type": "limit", "quantity": "0.5", "price": "0.01"}, buyer)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "sell", "type": "limit", "quantity": "0.5", "price": "0.01"}, seller)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// When
+	resp, response := getJSON(t, "http://app:3000/candles/BTC-USD?interval=1m", "")
+
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	candles := response["candles"].([]interface{})
+	if assert.NotEmpty(t, candles) {
+		candle := candles[len(candles)-1].(map[string]interface{})
+		assert.Equal(t, "0.01", candle["close"])
+		assert.GreaterOrEqual(t, candle["trades"], float64(1))
+	}
+	resp, response = getJSON(t, "http://app:3000/candles/BTC-USD?interval=15m", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "invalid_interval", response["code"])
+	resp, _ = getJSON(t, "http://app:3000/candles/DOGE-USD?interval=1m", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -17,29 +17,60 @@ type CreateAccountOptions struct {
 	Asset    types.Asset
 }
 
-func CreateValidAccount(options CreateAccountOptions) (string, error) {
+// authorizedRequest sends a JSON request on behalf of the session
+func authorizedRequest(method, url, session string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+session)
+	return http.DefaultClient.Do(req)
+}
+
+// CreateValidAccount signs up and verifies an account and returns its id and a session
+func CreateValidAccount(options CreateAccountOptions) (string, string, error) {
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
 	inputNewAccount := map[string]string{
 		"name":     "Gustavo B",
-		"email":    fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano()),
-		"document": "11144477735",
-		"password": "SecurePassword1234",
+		"email":    email,
+		"document": GenerateCPF(),
+		"password": "Vq7!mZt2Lp9x",
 	}
 	inputNewAccountJson, err := json.Marshal(inputNewAccount)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	resp, err := http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputNewAccountJson))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer resp.Body.Close()
 	var responseNewAccount map[string]string
 	err = json.NewDecoder(resp.Body).Decode(&responseNewAccount)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	newAccountID := responseNewAccount["accountId"]
 
+	// Deposits and withdrawals require a verified email
+	token, err := LastMailedToken(email)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err = VerifyEmail(token)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to verify email, status code: %d", resp.StatusCode)
+	}
+	session, err := login(email, "Vq7!mZt2Lp9x")
+	if err != nil {
+		return "", "", err
+	}
+
 	if options.AddAsset {
 		assetId := "BTC"
 		quantity := "10"
@@ -56,24 +87,46 @@ func CreateValidAccount(options CreateAccountOptions) (string, error) {
 		}
 		inputAssetJson, err := json.Marshal(inputAsset)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
-		resp, err = http.Post("http://app:3000/deposit", "application/json", bytes.NewBuffer(inputAssetJson))
+		resp, err = authorizedRequest(http.MethodPost, "http://app:3000/deposit", session, inputAssetJson)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("failed to add asset, status code: %d", resp.StatusCode)
+			return "", "", fmt.Errorf("failed to add asset, status code: %d", resp.StatusCode)
 		}
 	}
 
-	return newAccountID, nil
+	return newAccountID, session, nil
+}
+
+// login returns the token of a new session
+func login(email, password string) (string, error) {
+	inputJson, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.Post("http://app:3000/login", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to log in, status code: %d", resp.StatusCode)
+	}
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	token, _ := response["token"].(string)
+	return token, nil
 }
 
 func TestDepositEndpoint(t *testing.T) {
 	// Given
-	newAccountID, err := CreateValidAccount(CreateAccountOptions{})
+	newAccountID, session, err := CreateValidAccount(CreateAccountOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,7 +141,7 @@ func TestDepositEndpoint(t *testing.T) {
 		t.Fatal(err)
 	}
 	// When
-	resp, err := http.Post("http://app:3000/deposit", "application/json", bytes.NewBuffer(inputDepositJson))
+	resp, err := authorizedRequest(http.MethodPost, "http://app:3000/deposit", session, inputDepositJson)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,7 +155,7 @@ func TestDepositEndpoint(t *testing.T) {
 	}
 	assert.Equal(t, "Deposit completed", response["message"], "Expected message to indicate deposit completed")
 
-	resp, err = http.Get(fmt.Sprintf("http://app:3000/accounts/%s", newAccountID))
+	resp, err = authorizedRequest(http.MethodGet, "http://app:3000/accounts/"+newAccountID, session, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -123,7 +176,7 @@ func TestDepositEndpoint(t *testing.T) {
 }
 
 func TestInvalidDepositRequest(t *testing.T) {
-	accountID, err := CreateValidAccount(CreateAccountOptions{})
+	accountID, session, err := CreateValidAccount(CreateAccountOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,8 +192,8 @@ func TestInvalidDepositRequest(t *testing.T) {
 				"assetId":  "BTC",
 				"quantity": "10",
 			},
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "accountId is required",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "account_id_required",
 		},
 		{
 			name: "Missing accountId",
@@ -149,8 +202,8 @@ func TestInvalidDepositRequest(t *testing.T) {
 				"assetId":   "BTC",
 				"quantity":  "10",
 			},
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "accountId is required",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "account_id_required",
 		},
 		{
 			name: "Missing assetId",
@@ -158,8 +211,8 @@ func TestInvalidDepositRequest(t *testing.T) {
 				"accountId": accountID,
 				"quantity":  "10",
 			},
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "assetId is required and must be valid",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_asset",
 		},
 		{
 			name: "Missing quantity",
@@ -167,8 +220,8 @@ func TestInvalidDepositRequest(t *testing.T) {
 				"accountId": accountID,
 				"assetId":   "BTC",
 			},
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "quantity is required and must be a valid positive integer",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_quantity",
 		},
 		{
 			name: "Negative quantity",
@@ -177,8 +230,8 @@ func TestInvalidDepositRequest(t *testing.T) {
 				"assetId":   "BTC",
 				"quantity":  "-10",
 			},
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "quantity is required and must be a valid positive integer",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_quantity",
 		},
 		{
 			name: "Invalid Asset ID",
@@ -187,8 +240,8 @@ func TestInvalidDepositRequest(t *testing.T) {
 				"assetId":   "INVALID",
 				"quantity":  "10",
 			},
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "assetId is required and must be valid",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_asset",
 		},
 	}
 
@@ -198,30 +251,30 @@ func TestInvalidDepositRequest(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			resp, err := http.Post("http://app:3000/deposit", "application/json", bytes.NewBuffer(inputJson))
+			resp, err := authorizedRequest(http.MethodPost, "http://app:3000/deposit", session, inputJson)
 			if err != nil {
 				t.Fatal(err)
 			}
 			defer resp.Body.Close()
 			assert.Equal(t, tc.expectedCode, resp.StatusCode)
-			var response map[string]string
+			var response map[string]interface{}
 			err = json.NewDecoder(resp.Body).Decode(&response)
 			if err != nil {
 				t.Fatal(err)
 			}
-			assert.Equal(t, tc.expectedErr, response["error"], "Expected error message to match")
+			assert.Equal(t, tc.expectedErr, firstFieldErrorCode(response), "Expected error code to match")
 		})
 	}
 }
 
 func TestGetAccountWithNoAssets(t *testing.T) {
 	// Given
-	newAccountID, err := CreateValidAccount(CreateAccountOptions{})
+	newAccountID, session, err := CreateValidAccount(CreateAccountOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
 	// When
-	resp, err := http.Get(fmt.Sprintf("http://app:3000/accounts/%s", newAccountID))
+	resp, err := authorizedRequest(http.MethodGet, "http://app:3000/accounts/"+newAccountID, session, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Documents must be unique per account, so every signup needs a fresh one
+
+func checkDigit(chars string, firstWeight, maxWeight int) int {
+	sum := 0
+	weight := firstWeight
+	for i := 0; i < len(chars); i++ {
+		sum += int(chars[i]-'0') * weight
+		weight--
+		if weight < 2 {
+			weight = maxWeight
+		}
+	}
+	remainder := sum % 11
+	if remainder < 2 {
+		return 0
+	}
+	return 11 - remainder
+}
+
+func GenerateCPF() string {
+	base := fmt.Sprintf("%09d", rand.Intn(1_000_000_000))
+	base += fmt.Sprint(checkDigit(base, 10, 10))
+	return base + fmt.Sprint(checkDigit(base, 11, 11))
+}
+
+func GenerateCNPJ(alphanumeric bool) string {
+	const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	base := make([]byte, 12)
+	for i := range base {
+		if alphanumeric {
+			base[i] = alphabet[rand.Intn(len(alphabet))]
+		} else {
+			base[i] = alphabet[rand.Intn(10)]
+		}
+	}
+	cnpj := string(base)
+	cnpj += fmt.Sprint(checkDigit(cnpj, 5, 9))
+	return cnpj + fmt.Sprint(checkDigit(cnpj, 6, 9))
+}
+
+func FormatCPF(cpf string) string {
+	return fmt.Sprintf("%s.%s.%s-%s", cpf[0:3], cpf[3:6], cpf[6:9], cpf[9:])
+}
+
+func FormatCNPJ(cnpj string) string {
+	return fmt.Sprintf("%s.%s.%s/%s-%s", cnpj[0:2], cnpj[2:5], cnpj[5:8], cnpj[8:12], cnpj[12:])
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func deleteRequest(t *testing.T, url string, token string) *http.Response {
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestPlaceMatchAndCancelOrders(t *testing.T) {
+	// Given
+	sellerID, seller := verifiedSession(t, fmt.Sprintf("seller-%d@example.com", time.Now().UnixNano()))
+	buyerID, buyer := verifiedSession(t, fmt.Sprintf("buyer-%d@example.com", time.Now().UnixNano()))
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": sellerID, "assetId": "BTC", "quantity": "1"}, seller)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": buyerID, "assetId": "USD", "quantity": "1000000"}, buyer)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// When
+	resp, sell := postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "sell", "type": "limit", "quantity": "1", "price": "999999.99"}, seller)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, buy := postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "buy", "type": "market", "quantity": "0.5"}, buyer)
+
+	// Then
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "filled", buy["status"])
+	assert.Equal(t, "0.5", buy["fillQuantity"])
+
+	resp = deleteRequest(t, fmt.Sprintf("http://app:3000/orders/%v", sell["orderId"]), seller)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = deleteRequest(t, fmt.Sprintf("http://app:3000/orders/%v", sell["orderId"]), buyer)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMarketOrderWithoutLiquidity(t *testing.T) {
+	// Given
+	buyerID, buyer := verifiedSession(t, fmt.Sprintf("buyer-%d@example.com", time.Now().UnixNano()))
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": buyerID, "assetId": "USD", "quantity": "100"}, buyer)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// When
+	resp, response := postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "buy", "type": "market", "quantity": "100000000"}, buyer)
+
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "insufficient_liquidity", response["code"])
+}
+
+func TestPostOnlyImmediateOrCancelIsInvalid(t *testing.T) {
+	// Given
+	_, buyer := verifiedSession(t, fmt.Sprintf("buyer-%d@example.com", time.Now().UnixNano()))
+
+	// When
+	resp, response := postJSON(t, "http://app:3000/orders", map[string]interface{}{"marketId": "BTC-USD", "side": "buy", "type": "limit", "quantity": "1", "price": "100", "timeInForce": "IOC", "postOnly": true}, buyer)
+
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "invalid_post_only", firstFieldErrorCode(response))
+}
+
+func TestFundsOnHoldCannotBeWithdrawn(t *testing.T) {
+	// Given
+	sellerID, seller := verifiedSession(t, fmt.Sprintf("seller-%d@example.com", time.Now().UnixNano()))
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": sellerID, "assetId": "BTC", "quantity": "1"}, seller)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "sell", "type": "limit", "quantity": "0.75", "price": "99999999.99"}, seller)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// When
+	resp, response := postJSON(t, "http://app:3000/withdraw", map[string]string{"accountId": sellerID, "assetId": "BTC", "quantity": "0.5"}, seller)
+
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "insufficient_funds", response["code"])
+	resp, err := authorizedRequest(http.MethodGet, "http://app:3000/accounts/"+sellerID, seller, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var account map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		t.Fatal(err)
+	}
+	asset := account["assets"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "1", asset["quantity"])
+	assert.Equal(t, "0.25", asset["available"])
+	assert.Equal(t, "0.75", asset["onHold"])
+}
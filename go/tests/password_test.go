@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postJSON(t *testing.T, url string, body interface{}, token string) (*http.Response, map[string]interface{}) {
+	inputJson, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return resp, response
+}
+
+func Login(t *testing.T, email, password string) (int, string) {
+	resp, response := postJSON(t, "http://app:3000/login", map[string]string{"email": email, "password": password}, "")
+	token, _ := response["token"].(string)
+	return resp.StatusCode, token
+}
+
+func TestLogin(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	signup(t, email)
+	// When
+	status, token := Login(t, email, "Vq7!mZt2Lp9x")
+	// Then
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, token)
+
+	status, _ = Login(t, email, "Wrong!Pass9x")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestPasswordResetRevokesSessions(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	signup(t, email)
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+	// When
+	resp, _ := postJSON(t, "http://app:3000/password/forgot", map[string]string{"email": email}, "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	token, err := LastMailedToken(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = postJSON(t, "http://app:3000/password/reset", map[string]string{"token": token, "password": "Nw8#pQz4Rt6y"}, "")
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	status, _ := Login(t, email, "Vq7!mZt2Lp9x")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = Login(t, email, "Nw8#pQz4Rt6y")
+	assert.Equal(t, http.StatusOK, status)
+	resp, _ = postJSON(t, "http://app:3000/password/change", map[string]string{"currentPassword": "Nw8#pQz4Rt6y", "newPassword": "Xk9$wLm3Vb7n"}, session)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, response := postJSON(t, "http://app:3000/password/reset", map[string]string{"token": token, "password": "Xk9$wLm3Vb7n"}, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "token_already_used", response["code"])
+}
+
+func TestForgotPasswordForUnknownEmail(t *testing.T) {
+	// When
+	resp, _ := postJSON(t, "http://app:3000/password/forgot", map[string]string{"email": "nobody@example.com"}, "")
+	// Then
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func TestChangePassword(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	signup(t, email)
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+	// When
+	resp, response := postJSON(t, "http://app:3000/password/change", map[string]string{"currentPassword": "Wrong!Pass9x", "newPassword": "Nw8#pQz4Rt6y"}, session)
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "incorrect_password", firstFieldErrorCode(response))
+
+	resp, _ = postJSON(t, "http://app:3000/password/change", map[string]string{"currentPassword": "Vq7!mZt2Lp9x", "newPassword": "Nw8#pQz4Rt6y"}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	status, _ := Login(t, email, "Nw8#pQz4Rt6y")
+	assert.Equal(t, http.StatusOK, status)
+
+	resp, _ = postJSON(t, "http://app:3000/password/change", map[string]string{"currentPassword": "Nw8#pQz4Rt6y", "newPassword": "Xk9$wLm3Vb7n"}, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -5,19 +5,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+func firstFieldErrorCode(response map[string]interface{}) interface{} {
+	fieldErrors, ok := response["errors"].([]interface{})
+	if !ok || len(fieldErrors) == 0 {
+		return nil
+	}
+	return fieldErrors[0].(map[string]interface{})["code"]
+}
+
 func TestSignupEndpoint(t *testing.T) {
 	// Given
 	input := map[string]string{
 		"name":     "Gustavo B",
 		"email":    fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano()),
-		"document": "11144477735",
-		"password": "SecurePassword1234",
+		"document": GenerateCPF(),
+		"password": "Vq7!mZt2Lp9x",
 	}
 	inputJson, err := json.Marshal(input)
 	if err != nil {
@@ -38,7 +47,8 @@ func TestSignupEndpoint(t *testing.T) {
 	}
 	newAccountID := response["accountId"]
 	assert.NotEmpty(t, newAccountID, "Expected account_id to be present in response")
-	resp, err = http.Get(fmt.Sprintf("http://app:3000/accounts/%s", newAccountID))
+	_, session := Login(t, input["email"], input["password"])
+	resp, err = authorizedRequest(http.MethodGet, "http://app:3000/accounts/"+newAccountID, session, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,6 +60,7 @@ func TestSignupEndpoint(t *testing.T) {
 		t.Fatal(err)
 	}
 	assert.Equal(t, newAccountID, accountResponse["accountId"], "Expected accountId in response to match the one created")
+	assert.Equal(t, FormatCPF(input["document"]), accountResponse["document"], "Expected the document to be formatted")
 }
 
 func TestInvalidNameSignup(t *testing.T) {
@@ -62,26 +73,38 @@ func TestInvalidNameSignup(t *testing.T) {
 		{
 			name:         "Single word name",
 			inputName:    "Gustavo",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid name",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_name",
 		},
 		{
 			name:         "Empty name",
 			inputName:    "",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid name",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "name_too_short",
 		},
 		{
 			name:         "Only spaces",
 			inputName:    "   ",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid name",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "name_too_short",
 		},
 		{
 			name:         "Name with more than two words",
 			inputName:    "Gustavo Bruno B",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid name",
+			expectedCode: http.StatusOK,
+			expectedErr:  "",
+		},
+		{
+			name:         "Name with particles and accents",
+			inputName:    "Maria da Conceição Santos",
+			expectedCode: http.StatusOK,
+			expectedErr:  "",
+		},
+		{
+			name:         "Name with digits",
+			inputName:    "Gustavo B2",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_name",
 		},
 		{
 			name:         "Valid name",
@@ -97,8 +120,8 @@ func TestInvalidNameSignup(t *testing.T) {
 			input := map[string]string{
 				"name":     tc.inputName,
 				"email":    fmt.Sprintf("valid-%d@example.com", time.Now().UnixNano()),
-				"document": "11144477735",
-				"password": "SecurePassword1234",
+				"document": GenerateCPF(),
+				"password": "Vq7!mZt2Lp9x",
 			}
 			inputJson, err := json.Marshal(input)
 			if err != nil {
@@ -113,13 +136,13 @@ func TestInvalidNameSignup(t *testing.T) {
 			// Then
 			assert.Equal(t, tc.expectedCode, resp.StatusCode)
 
-			if tc.expectedCode == http.StatusBadRequest {
-				var response map[string]string
+			if tc.expectedCode != http.StatusOK {
+				var response map[string]interface{}
 				err = json.NewDecoder(resp.Body).Decode(&response)
 				if err != nil {
 					t.Fatal(err)
 				}
-				assert.Equal(t, tc.expectedErr, response["error"])
+				assert.Equal(t, tc.expectedErr, firstFieldErrorCode(response))
 			}
 		})
 	}
@@ -135,32 +158,32 @@ func TestInvalidEmailSignup(t *testing.T) {
 		{
 			name:         "Invalid email format",
 			inputEmail:   "invalid-email",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid email",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_email",
 		},
 		{
 			name:         "Empty email",
 			inputEmail:   "",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid email",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_email",
 		},
 		{
 			name:         "Email with spaces",
 			inputEmail:   "test @example.com",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid email",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_email",
 		},
 		{
 			name:         "Email without domain",
 			inputEmail:   "test@",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid email",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_email",
 		},
 		{
 			name:         "Email with invalid characters",
 			inputEmail:   "test@exa$mple.com",
-			expectedCode: http.StatusBadRequest,
-			expectedErr:  "Invalid email",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedErr:  "invalid_email",
 		},
 		{
 			name:         "Valid email",
@@ -176,8 +199,8 @@ func TestInvalidEmailSignup(t *testing.T) {
 			input := map[string]string{
 				"name":     "Gustavo B",
 				"email":    tc.inputEmail,
-				"document": "11144477735",
-				"password": "SecurePassword1234",
+				"document": GenerateCPF(),
+				"password": "Vq7!mZt2Lp9x",
 			}
 			inputJson, err := json.Marshal(input)
 			if err != nil {
@@ -192,13 +215,13 @@ func TestInvalidEmailSignup(t *testing.T) {
 			// Then
 			assert.Equal(t, tc.expectedCode, resp.StatusCode)
 
-			if tc.expectedCode == http.StatusBadRequest {
-				var response map[string]string
+			if tc.expectedCode != http.StatusOK {
+				var response map[string]interface{}
 				err = json.NewDecoder(resp.Body).Decode(&response)
 				if err != nil {
 					t.Fatal(err)
 				}
-				assert.Equal(t, tc.expectedErr, response["error"])
+				assert.Equal(t, tc.expectedErr, firstFieldErrorCode(response))
 			}
 		})
 	}
@@ -209,8 +232,8 @@ func TestDuplicatedEmail(t *testing.T) {
 	input := map[string]string{
 		"name":     "Gustavo B",
 		"email":    fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano()),
-		"document": "11144477735",
-		"password": "SecurePassword1234",
+		"document": GenerateCPF(),
+		"password": "Vq7!mZt2Lp9x",
 	}
 	inputJson, err := json.Marshal(input)
 	if err != nil {
@@ -232,13 +255,15 @@ func TestDuplicatedEmail(t *testing.T) {
 	}
 	defer resp.Body.Close()
 
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-	var response map[string]string
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	var response map[string]interface{}
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
 		t.Fatal(err)
 	}
-	assert.Equal(t, "Email already exists", response["error"])
+	assert.Equal(t, "validation_failed", response["code"])
+	assert.Equal(t, "duplicate_email", firstFieldErrorCode(response))
 }
 
 func TestInvalidPasswordSignup(t *testing.T) {
@@ -250,25 +275,37 @@ func TestInvalidPasswordSignup(t *testing.T) {
 	}{
 		{
 			name:          "Password too short",
-			inputPassword: "short",
-			expectedCode:  http.StatusBadRequest,
-			expectedErr:   "Invalid password",
+			inputPassword: "Sh0rt",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "password_too_short",
 		},
 		{
 			name:          "Password without numbers",
 			inputPassword: "NoNumbersHere",
-			expectedCode:  http.StatusBadRequest,
-			expectedErr:   "Invalid password",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "password_missing_digit",
 		},
 		{
 			name:          "Password without uppercase letters",
 			inputPassword: "nouppercase123",
-			expectedCode:  http.StatusBadRequest,
-			expectedErr:   "Invalid password",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "password_missing_uppercase",
+		},
+		{
+			name:          "Common password",
+			inputPassword: "Password123",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "password_too_weak",
+		},
+		{
+			name:          "Password with the user's name",
+			inputPassword: "Gustavo!Kx7q",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "password_contains_personal_info",
 		},
 		{
 			name:          "Valid password",
-			inputPassword: "Valid1234",
+			inputPassword: "Valid!x7Qm2z",
 			expectedCode:  http.StatusOK,
 			expectedErr:   "",
 		},
@@ -280,7 +317,7 @@ func TestInvalidPasswordSignup(t *testing.T) {
 			input := map[string]string{
 				"name":     "Gustavo B",
 				"email":    fmt.Sprintf("valid-%d@example.com", time.Now().UnixNano()),
-				"document": "11144477735",
+				"document": GenerateCPF(),
 				"password": tc.inputPassword,
 			}
 			inputJson, err := json.Marshal(input)
@@ -296,13 +333,13 @@ func TestInvalidPasswordSignup(t *testing.T) {
 			// Then
 			assert.Equal(t, tc.expectedCode, resp.StatusCode)
 
-			if tc.expectedCode == http.StatusBadRequest {
-				var response map[string]string
+			if tc.expectedCode != http.StatusOK {
+				var response map[string]interface{}
 				err = json.NewDecoder(resp.Body).Decode(&response)
 				if err != nil {
 					t.Fatal(err)
 				}
-				assert.Equal(t, tc.expectedErr, response["error"])
+				assert.Equal(t, tc.expectedErr, firstFieldErrorCode(response))
 			}
 		})
 	}
@@ -318,39 +355,57 @@ func TestInvalidDocument(t *testing.T) {
 		{
 			name:          "Invalid document format",
 			inputDocument: "12345678901",
-			expectedCode:  http.StatusBadRequest,
-			expectedErr:   "Invalid document",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "invalid_document",
 		},
 		{
 			name:          "Empty document",
 			inputDocument: "",
-			expectedCode:  http.StatusBadRequest,
-			expectedErr:   "Invalid document",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "invalid_document",
 		},
 		{
 			name:          "Document with spaces",
 			inputDocument: "111 325 777 35",
-			expectedCode:  http.StatusBadRequest,
-			expectedErr:   "Invalid document",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "invalid_document",
 		},
 		{
 			name:          "Valid document",
-			inputDocument: "11144477735",
+			inputDocument: GenerateCPF(),
 			expectedCode:  http.StatusOK,
 			expectedErr:   "",
 		},
 		{
 			name:          "Valid document",
-			inputDocument: "111 444 777 35",
+			inputDocument: strings.NewReplacer(".", " ", "-", " ").Replace(FormatCPF(GenerateCPF())),
 			expectedCode:  http.StatusOK,
 			expectedErr:   "",
 		},
 		{
 			name:          "Valid document",
-			inputDocument: "111.444.777-35",
+			inputDocument: FormatCPF(GenerateCPF()),
+			expectedCode:  http.StatusOK,
+			expectedErr:   "",
+		},
+		{
+			name:          "Valid CNPJ",
+			inputDocument: FormatCNPJ(GenerateCNPJ(false)),
+			expectedCode:  http.StatusOK,
+			expectedErr:   "",
+		},
+		{
+			name:          "Valid alphanumeric CNPJ",
+			inputDocument: FormatCNPJ(GenerateCNPJ(true)),
 			expectedCode:  http.StatusOK,
 			expectedErr:   "",
 		},
+		{
+			name:          "Invalid CNPJ",
+			inputDocument: "11.222.333/0001-82",
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedErr:   "invalid_document",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -360,7 +415,7 @@ func TestInvalidDocument(t *testing.T) {
 				"name":     "Gustavo B",
 				"email":    fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano()),
 				"document": tc.inputDocument,
-				"password": "SecurePassword1234",
+				"password": "Vq7!mZt2Lp9x",
 			}
 			inputJson, err := json.Marshal(input)
 			if err != nil {
@@ -375,14 +430,138 @@ func TestInvalidDocument(t *testing.T) {
 			// Then
 			assert.Equal(t, tc.expectedCode, resp.StatusCode)
 
-			if tc.expectedCode == http.StatusBadRequest {
-				var response map[string]string
+			if tc.expectedCode != http.StatusOK {
+				var response map[string]interface{}
 				err = json.NewDecoder(resp.Body).Decode(&response)
 				if err != nil {
 					t.Fatal(err)
 				}
-				assert.Equal(t, tc.expectedErr, response["error"])
+				assert.Equal(t, tc.expectedErr, firstFieldErrorCode(response))
 			}
 		})
 	}
 }
+
+func TestSignupReportsAllInvalidFields(t *testing.T) {
+	// Given
+	input := map[string]string{
+		"name":     "Gustavo",
+		"email":    "invalid-email",
+		"document": "12345678901",
+		"password": "short",
+	}
+	inputJson, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// When
+	resp, err := http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var response map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]interface{}{}
+	for _, fieldError := range response["errors"].([]interface{}) {
+		fieldError := fieldError.(map[string]interface{})
+		fields[fieldError["field"].(string)] = fieldError["code"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"name":     "invalid_name",
+		"email":    "invalid_email",
+		"password": "invalid_password",
+		"document": "invalid_document",
+	}, fields)
+}
+
+func TestDuplicatedDocument(t *testing.T) {
+	// Given
+	document := GenerateCPF()
+	input := map[string]string{
+		"name":     "Gustavo B",
+		"email":    fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano()),
+		"document": document,
+		"password": "Vq7!mZt2Lp9x",
+	}
+	inputJson, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// When the same document is used with a different email and formatting
+	input["email"] = fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	input["document"] = FormatCPF(document)
+	inputJson, err = json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var response map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "duplicate_document", firstFieldErrorCode(response))
+}
+
+func TestDuplicatedEmailIsCaseInsensitive(t *testing.T) {
+	// Given
+	localPart := fmt.Sprintf("Gustavo-%d", time.Now().UnixNano())
+	input := map[string]string{
+		"name":     "Gustavo B",
+		"email":    localPart + "@Example.COM",
+		"document": GenerateCPF(),
+		"password": "Vq7!mZt2Lp9x",
+	}
+	inputJson, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// When
+	input["email"] = strings.ToLower(localPart) + "@example.com"
+	input["document"] = GenerateCPF()
+	inputJson, err = json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var response map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "duplicate_email", firstFieldErrorCode(response))
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openStream opens the WebSocket stream, adding header lines such as Authorization
+func openStream(t *testing.T, headers string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", "app:3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: app:3000\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+headers+"\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	return conn, reader
+}
+
+// sendStream writes message as a masked text frame, messages must be under 126 bytes
+func sendStream(t *testing.T, conn net.Conn, message map[string]string) {
+	payload, _ := json.Marshal(message)
+	mask := []byte{7, 7, 7, 7}
+	frame := append([]byte{0x81, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receiveStream reads the next text frame, which the server never masks
+func receiveStream(t *testing.T, reader *bufio.Reader) map[string]interface{} {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7F)
+	if length >= 126 {
+		extended := make([]byte, 2)
+		if length == 127 {
+			extended = make([]byte, 8)
+		}
+		io.ReadFull(reader, extended)
+		length = 0
+		for _, b := range extended {
+			length = length<<8 | int(b)
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestStream(t *testing.T) {
+	// Given
+	conn, reader := openStream(t, "")
+
+	// When
+	sendStream(t, conn, map[string]string{"op": "subscribe", "channel": "ticker"})
+	snapshot := receiveStream(t, reader)
+	sendStream(t, conn, map[string]string{"op": "subscribe", "channel": "account:00000000-0000-0000-0000-000000000000"})
+	rejected := receiveStream(t, reader)
+
+	// Then
+	assert.Equal(t, "snapshot", snapshot["type"])
+	assert.Equal(t, "ticker", snapshot["channel"])
+	assert.NotEmpty(t, snapshot["data"])
+	assert.Equal(t, "error", rejected["type"])
+	assert.Equal(t, "authentication_required", rejected["code"])
+}
+
+func TestStreamAccountUpdates(t *testing.T) {
+	// Given
+	accountID, session := verifiedSession(t, "stream-"+time.Now().Format("150405.000000000")+"@example.com")
+	conn, reader := openStream(t, "Authorization: Bearer "+session+"\r\n")
+	sendStream(t, conn, map[string]string{"op": "subscribe", "channel": "account:" + accountID})
+	snapshot := receiveStream(t, reader)
+
+	// When
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": accountID, "assetId": "USD", "quantity": "10"}, session)
+	update := receiveStream(t, reader)
+
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "snapshot", snapshot["type"])
+	assert.Equal(t, "update", update["type"])
+	assert.Equal(t, snapshot["sequence"].(float64)+1, update["sequence"])
+	balances := update["data"].(map[string]interface{})["balances"].([]interface{})
+	if assert.Len(t, balances, 1) {
+		assert.Equal(t, "10", balances[0].(map[string]interface{})["available"])
+	}
+}
+
+// readEvent reads the next Server-Sent Event, skipping heartbeats
+func readEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	event := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(event) > 0 {
+			return event
+		}
+		if name, value, found := strings.Cut(line, ": "); found && name != "" {
+			event[name] = value
+		}
+	}
+}
+
+func openAccountStream(t *testing.T, accountID, token, lastEventID string) *http.Response {
+	req, _ := http.NewRequest("GET", "http://app:3000/accounts/"+accountID+"/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAccountBalanceStream(t *testing.T) {
+	// Given
+	accountID, session := verifiedSession(t, "sse-"+time.Now().Format("150405.000000000")+"@example.com")
+	resp := openAccountStream(t, accountID, session, "")
+	reader := bufio.NewReader(resp.Body)
+
+	// When
+	postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": accountID, "assetId": "USD", "quantity": "10"}, session)
+	deposit := readEvent(t, reader)
+	postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": accountID, "assetId": "USD", "quantity": "5"}, session)
+	resumed := openAccountStream(t, accountID, session, deposit["id"])
+	missed := readEvent(t, bufio.NewReader(resumed.Body))
+
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "balance", deposit["event"])
+	assert.Contains(t, deposit["data"], `"available":"10"`)
+	assert.Equal(t, "balance", missed["event"])
+	assert.Contains(t, missed["data"], `"available":"15"`)
+}
+
+func TestAccountBalanceStreamInvalidLastEventID(t *testing.T) {
+	// Given
+	accountID, token := verifiedSession(t, "sse-invalid-"+time.Now().Format("150405.000000000")+"@example.com")
+
+	// When
+	resp := openAccountStream(t, accountID, token, "latest")
+
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTicker(t *testing.T) {
+	// When
+	resp, response := getJSON(t, "http://app:3000/ticker", "")
+
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	tickers := response["tickers"].([]interface{})
+	if assert.NotEmpty(t, tickers) {
+		ticker := tickers[0].(map[string]interface{})
+		assert.Equal(t, "BTC-USD", ticker["marketId"])
+		assert.Contains(t, ticker, "bestBid")
+		assert.Contains(t, ticker, "changePercent")
+	}
+	resp, response = getJSON(t, "http://app:3000/ticker/BTC-USD", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "BTC-USD", response["marketId"])
+	resp, _ = getJSON(t, "http://app:3000/ticker/DOGE-USD", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
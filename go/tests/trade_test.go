@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getJSON(t *testing.T, url string, token string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return resp, response
+}
+
+func TestTradeHistory(t *testing.T) {
+	// Given
+	sellerID, seller := verifiedSession(t, fmt.Sprintf("seller-%d@example.com", time.Now().UnixNano()))
+	buyerID, buyer := verifiedSession(t, fmt.Sprintf("buyer-%d@example.com", time.Now().UnixNano()))
+	resp, _ := postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": sellerID, "assetId": "BTC", "quantity": "1"}, seller)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": buyerID, "assetId": "USD", "quantity": "100"}, buyer)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "buy", "type": "limit", "quantity": "0.5", "price": "0.01"}, buyer)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, sell := postJSON(t, "http://app:3000/orders", map[string]string{"marketId": "BTC-USD", "side": "sell", "type": "limit", "quantity": "0.5", "price": "0.01"}, seller)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// When
+	resp, response := getJSON(t, "http://app:3000/accounts/"+sellerID+"/trades", seller)
+
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	fills := response["trades"].([]interface{})
+	if assert.NotEmpty(t, fills) {
+		fill := fills[0].(map[string]interface{})
+		assert.Equal(t, sell["orderId"], fill["orderId"])
+		assert.Equal(t, "sell", fill["side"])
+		assert.Equal(t, "taker", fill["liquidity"])
+		assert.Equal(t, "USD", fill["feeAsset"])
+	}
+	resp, _ = getJSON(t, "http://app:3000/accounts/"+sellerID+"/trades", buyer)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, response = getJSON(t, "http://app:3000/trades/BTC-USD?limit=1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, response["trades"], 1)
+	assert.NotNil(t, response["nextCursor"])
+	resp, _ = getJSON(t, "http://app:3000/trades/DOGE-USD", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
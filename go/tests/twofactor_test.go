@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gusbru/clean_code_and_clean_architecture/internal/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+// nextTOTPCode waits for a fresh period so the code was not used for an earlier request
+func nextTOTPCode(t *testing.T, secret string) string {
+	now := time.Now()
+	time.Sleep(time.Unix((totp.Step(now)+1)*int64(totp.Period/time.Second), 0).Sub(now))
+	code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTwoFactorLoginAndWithdrawStepUp(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for TOTP periods")
+	}
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	accountID := signup(t, email)
+	token, err := LastMailedToken(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+	resp, _ = postJSON(t, "http://app:3000/deposit", map[string]string{"accountId": accountID, "assetId": "BTC", "quantity": "10"}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, enrollment := postJSON(t, "http://app:3000/2fa/enroll", map[string]string{}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	secret := enrollment["secret"].(string)
+	assert.Contains(t, enrollment["otpauthUri"], "otpauth://totp/")
+	code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, confirmation := postJSON(t, "http://app:3000/2fa/confirm", map[string]string{"code": code}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, confirmation["recoveryCodes"], 10)
+
+	// When
+	status, _ := Login(t, email, "Vq7!mZt2Lp9x")
+	// Then
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	withdraw := map[string]string{"accountId": accountID, "assetId": "BTC", "quantity": "5"}
+	resp, response := postJSON(t, "http://app:3000/withdraw", withdraw, session)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "two_factor_required", response["code"])
+
+	withdraw["totpCode"] = nextTOTPCode(t, secret)
+	resp, _ = postJSON(t, "http://app:3000/withdraw", withdraw, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, response = postJSON(t, "http://app:3000/withdraw", withdraw, session)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "invalid_two_factor_code", response["code"])
+
+	// Small withdrawals stay below the step-up threshold
+	resp, _ = postJSON(t, "http://app:3000/withdraw", map[string]string{"accountId": accountID, "assetId": "BTC", "quantity": "0.01"}, session)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var mailedTokenRegex = regexp.MustCompile(`token=([A-Za-z0-9_%.-]+)`)
+
+// mailDir must point to the MAIL_DIR used by the app container
+func mailDir() string {
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "ccca-mail")
+}
+
+// LastMailedToken reads the token link of the newest email written by the file mailer
+func LastMailedToken(email string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(mailDir(), "*-"+email+".eml"))
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no email sent to %s", email)
+	}
+	sort.Strings(files)
+	content, err := os.ReadFile(files[len(files)-1])
+	if err != nil {
+		return "", err
+	}
+	match := mailedTokenRegex.FindSubmatch(content)
+	if match == nil {
+		return "", fmt.Errorf("no token link in email to %s", email)
+	}
+	return url.QueryUnescape(string(match[1]))
+}
+
+func VerifyEmail(token string) (*http.Response, error) {
+	return http.Get("http://app:3000/verify-email?token=" + url.QueryEscape(token))
+}
+
+func signup(t *testing.T, email string) string {
+	input := map[string]string{
+		"name":     "Gustavo B",
+		"email":    email,
+		"document": GenerateCPF(),
+		"password": "Vq7!mZt2Lp9x",
+	}
+	inputJson, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post("http://app:3000/signup", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var response map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response["accountId"]
+}
+
+func accountStatus(t *testing.T, accountID, session string) interface{} {
+	resp, err := authorizedRequest(http.MethodGet, "http://app:3000/accounts/"+accountID, session, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response["status"]
+}
+
+func TestSignupRequiresEmailVerification(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	accountID := signup(t, email)
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+	assert.Equal(t, "pending", accountStatus(t, accountID, session))
+	token, err := LastMailedToken(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// When
+	resp, err := VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "active", accountStatus(t, accountID, session))
+
+	resp, err = VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "token_already_used", response["code"])
+}
+
+func TestVerifyEmailRejectsInvalidToken(t *testing.T) {
+	// When
+	resp, err := VerifyEmail("not-a-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Then
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "invalid_token", response["code"])
+}
+
+func TestDepositBlockedUntilEmailVerified(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	accountID := signup(t, email)
+	_, session := Login(t, email, "Vq7!mZt2Lp9x")
+	input := map[string]string{
+		"accountId": accountID,
+		"assetId":   "BTC",
+		"quantity":  "1",
+	}
+	inputJson, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// When
+	resp, err := authorizedRequest(http.MethodPost, "http://app:3000/deposit", session, inputJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Then
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "email_not_verified", response["code"])
+}
+
+func TestResendVerificationIsRateLimited(t *testing.T) {
+	// Given
+	email := fmt.Sprintf("gustavo-%d@example.com", time.Now().UnixNano())
+	signup(t, email)
+	inputJson, err := json.Marshal(map[string]string{"email": email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// When
+	resp, err := http.Post("http://app:3000/verify-email/resend", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Then the signup email is still inside the cooldown
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	inputJson, err = json.Marshal(map[string]string{"email": "nobody-" + email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post("http://app:3000/verify-email/resend", "application/json", bytes.NewBuffer(inputJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
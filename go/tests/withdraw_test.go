@@ -1,9 +1,7 @@
 package tests
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"testing"
 
@@ -14,7 +12,7 @@ import (
 
 func TestWithdrawEndpoint(t *testing.T) {
 	// Given
-	newAccountID, err := CreateValidAccount(CreateAccountOptions{
+	newAccountID, session, err := CreateValidAccount(CreateAccountOptions{
 		AddAsset: true,
 		Asset:    types.Asset{AssetID: "BTC", Quantity: decimal.NewFromInt(10)},
 	})
@@ -33,7 +31,7 @@ func TestWithdrawEndpoint(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	resp, err := http.Post("http://app:3000/withdraw", "application/json", bytes.NewBuffer(inputWithdrawJson))
+	resp, err := authorizedRequest(http.MethodPost, "http://app:3000/withdraw", session, inputWithdrawJson)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -42,7 +40,7 @@ func TestWithdrawEndpoint(t *testing.T) {
 	// Then
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "Expected status code 200 for withdraw")
 
-	resp, err = http.Get(fmt.Sprintf("http://app:3000/accounts/%s", newAccountID))
+	resp, err = authorizedRequest(http.MethodGet, "http://app:3000/accounts/"+newAccountID, session, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,7 +60,7 @@ func TestWithdrawEndpoint(t *testing.T) {
 }
 
 func TestWithdrawInvalidCases(t *testing.T) {
-	newAccountID, err := CreateValidAccount(CreateAccountOptions{
+	newAccountID, session, err := CreateValidAccount(CreateAccountOptions{
 		AddAsset: true,
 		Asset:    types.Asset{AssetID: "BTC", Quantity: decimal.NewFromInt(10)},
 	})
@@ -83,7 +81,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				"assetId":   "BTC",
 				"quantity":  "15",
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "Withdraw negative quantity",
@@ -92,7 +90,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				"assetId":   "BTC",
 				"quantity":  "-5",
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "Withdraw with invalid asset",
@@ -101,7 +99,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				"assetId":   "INVALID",
 				"quantity":  "5",
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "Withdraw with invalid accountId",
@@ -110,7 +108,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				"assetId":   "BTC",
 				"quantity":  "5",
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "Withdraw with empty accountId",
@@ -119,7 +117,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				"assetId":   "BTC",
 				"quantity":  "5",
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "Withdraw with empty assetId",
@@ -128,7 +126,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				"assetId":   "",
 				"quantity":  "5",
 			},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name: "Withdraw with empty quantity",
@@ -166,7 +164,7 @@ func TestWithdrawInvalidCases(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			resp, err := http.Post("http://app:3000/withdraw", "application/json", bytes.NewBuffer(inputJson))
+			resp, err := authorizedRequest(http.MethodPost, "http://app:3000/withdraw", session, inputJson)
 			if err != nil {
 				t.Fatal(err)
 			}